@@ -66,8 +66,25 @@ func main() {
 		}
 	}()
 
+	// flag missed payment plan installments
+	go shared.PaymentPlanMonitor()
+
+	go shared.DunningMonitor()
+
+	go shared.AlertEscalationMonitor()
+
+	// refund the online payments of approved reversals
+	go handlers.RefundMonitor()
+
 	// create server
 	srv := shared.NewServer(AppName, logger, cfg, dbc)
+	srv.Middleware = append(srv.Middleware, handlers.IdempotencyMw(dbc, logger.Sugar(), []string{
+		"/api/db/paymentForm",
+		"/api/db/paymentPending",
+		"/api/db/billGenerate",
+		"/api/ctl/paystack",
+		"/api/ctl/pay",
+	}))
 	sList := map[string]service.IService{}
 	hList := []et.Handler{
 		&et.CrudAPI{Path: "/api/db", Models: models},
@@ -76,6 +93,7 @@ func main() {
 		&handlers.NewResidentRegistration{Path: "/api/db/newresidents"},
 		&handlers.Controller{Path: "/api/ctl"},
 		&handlers.ResidentUtil{Path: "/api/resident"},
+		&handlers.GateAPI{Path: "/api/gate"},
 	}
 
 	if err := srv.Start(hList, sList); err != nil {
@@ -153,6 +171,7 @@ func registerModels() []et.ModelInfo {
 		{Type: &model.Visitor{}, Name: "Visitor", Exclude: "SiteID,Security,Resident", MinAccessType: model.SecurityUser,
 			BeforeReadHook: handlers.BeforeReadVisitor,
 			BeforeSaveHook: handlers.BeforeSaveVisitor,
+			AfterSaveHook:  handlers.AfterSaveVisitor,
 		},
 
 		{Type: &model.BillGenerate{}, Name: "BillGenerate", Exclude: "SiteID", MinAccessType: model.OfficialUser,
@@ -161,6 +180,37 @@ func registerModels() []et.ModelInfo {
 		{
 			Type: &model.ResidentAlerts{}, Name: "ResidentAlert", Exclude: "SiteID", MinAccessType: model.SecurityUser,
 			BeforeSaveHook: handlers.BeforeResidentSaveAlerts,
+			AfterSaveHook:  handlers.AfterSaveResidentAlerts,
+		},
+		{Type: &model.AlertEscalationPolicy{}, Name: "AlertEscalationPolicy", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveAlertEscalationPolicy,
+		},
+		{Type: &model.AlertEscalation{}, Name: "AlertEscalation", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveAlertEscalation,
+		},
+		{Type: &model.GuardShift{}, Name: "GuardShift", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeReadHook: handlers.BeforeReadPatrol,
+			BeforeListHook: handlers.BeforeListGuardShift,
+			BeforeSaveHook: handlers.BeforeSaveGuardShift,
+			DeleteHook:     handlers.DeleteGuardShift,
+		},
+		{Type: &model.PatrolCheckpoint{}, Name: "PatrolCheckpoint", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeReadHook: handlers.BeforeReadPatrol,
+			BeforeListHook: handlers.BeforeListPatrol,
+			BeforeSaveHook: handlers.BeforeSavePatrolCheckpoint,
+			DeleteHook:     handlers.DeletePatrolCheckpoint,
+		},
+		{Type: &model.PatrolScan{}, Name: "PatrolScan", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeReadHook: handlers.BeforeReadPatrol,
+			BeforeListHook: handlers.BeforeListPatrol,
+			BeforeSaveHook: handlers.BeforeSavePatrolScan,
+			DeleteHook:     handlers.DeletePatrolScan,
+		},
+		{Type: &model.Incident{}, Name: "Incident", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeReadHook: handlers.BeforeReadIncident,
+			BeforeListHook: handlers.BeforeListIncident,
+			BeforeSaveHook: handlers.BeforeSaveIncident,
+			DeleteHook:     handlers.DeleteIncident,
 		},
 
 		{Type: &model.Invoice{}, Name: "Invoice", Exclude: "SiteID,PaidDues", MinAccessType: model.ResidentUser,
@@ -175,12 +225,88 @@ func registerModels() []et.ModelInfo {
 			DeleteHook:     handlers.DeletePendingPayment,
 		},
 		{Type: &model.PaymentLog{}, Name: "PaymentLog", Exclude: "", MinAccessType: model.OfficialUser},
+		{Type: &model.Wallet{}, Name: "Wallet", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveWallet,
+			DeleteHook:     handlers.DeleteWallet,
+		},
+		{Type: &model.WalletMovement{}, Name: "WalletMovement", Exclude: "SiteID", MinAccessType: model.ResidentUser,
+			BeforeListHook: handlers.BeforeListWalletMovement,
+			BeforeSaveHook: handlers.BeforeSaveWalletMovement,
+			DeleteHook:     handlers.DeleteWalletMovement,
+		},
+		{Type: &model.PaymentPlan{}, Name: "PaymentPlan", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSavePaymentPlan,
+			DeleteHook:     handlers.DeletePaymentPlan,
+		},
+		{Type: &model.PaymentPlanInstallment{}, Name: "PaymentPlanInstallment", Exclude: "SiteID", MinAccessType: model.ResidentUser,
+			BeforeListHook: handlers.BeforeListPaymentPlan,
+			BeforeSaveHook: handlers.BeforeSavePaymentPlanInstallment,
+			DeleteHook:     handlers.DeletePaymentPlanInstallment,
+		},
+		{Type: &model.PaymentReversal{}, Name: "PaymentReversal", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSavePaymentReversal,
+			DeleteHook:     handlers.DeletePaymentReversal,
+		},
+		{Type: &model.DunningPolicy{}, Name: "DunningPolicy", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveDunningPolicy,
+		},
+		{Type: &model.ResidentDunning{}, Name: "ResidentDunning", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveResidentDunning,
+		},
+		{Type: &model.CreditNote{}, Name: "CreditNote", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveCreditNote,
+			DeleteHook:     handlers.DeleteCreditNote,
+		},
+		{Type: &model.InvoiceSeries{}, Name: "InvoiceSeries", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveInvoiceSeries,
+			DeleteHook:     handlers.DeleteInvoiceSeries,
+		},
+		{Type: &model.LedgerAccount{}, Name: "LedgerAccount", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveLedgerAccount,
+			DeleteHook:     handlers.DeleteLedgerAccount,
+		},
+		{Type: &model.Journal{}, Name: "Journal", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveJournal,
+			DeleteHook:     handlers.DeleteJournal,
+		},
+		{Type: &model.ExpenseCategory{}, Name: "ExpenseCategory", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &model.Vendor{}, Name: "Vendor", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &model.Budget{}, Name: "Budget", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &model.Expense{}, Name: "Expense", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveExpense,
+			DeleteHook:     handlers.DeleteExpense,
+		},
+		{Type: &model.SitePaymentProvider{}, Name: "SitePaymentProvider", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveSitePaymentProvider,
+			AfterReadHook:  handlers.AfterReadSitePaymentProvider,
+			AfterListHook:  handlers.AfterListSitePaymentProvider,
+		},
+		{Type: &model.BankStatement{}, Name: "BankStatement", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveBankStatement,
+			DeleteHook:     handlers.DeleteBankStatement,
+		},
 		{Type: &model.Content{}, Name: "Content", Exclude: "SiteID", MinAccessType: model.OfficialUser,
 			BeforeSaveHook: handlers.BeforeSaveContent},
 
 		{Type: &view.InvoiceList{}, Name: "InvoiceList", Exclude: "SiteID", MinAccessType: model.ResidentUser,
 			BeforeListHook: handlers.BeforeInvoiceList,
 		},
+		{Type: &view.PaymentPlanList{}, Name: "PaymentPlanList", Exclude: "SiteID", MinAccessType: model.ResidentUser,
+			BeforeListHook: handlers.BeforeListPaymentPlan,
+		},
+		{Type: &view.LedgerList{}, Name: "LedgerList", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &view.TrialBalance{}, Name: "TrialBalance", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &view.ExpenseList{}, Name: "ExpenseList", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &view.BudgetVsActual{}, Name: "BudgetVsActual", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &view.BankStatementLineList{}, Name: "BankStatementLineList", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &view.PaymentReversalList{}, Name: "PaymentReversalList", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &view.WalletList{}, Name: "WalletList", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &view.DunningHistoryList{}, Name: "DunningHistoryList", Exclude: "SiteID", MinAccessType: model.ResidentUser,
+			BeforeListHook: handlers.BeforeListDunningHistory,
+		},
+		{Type: &view.CreditNoteList{}, Name: "CreditNoteList", Exclude: "SiteID", MinAccessType: model.ResidentUser,
+			BeforeListHook: handlers.BeforeListCreditNote,
+		},
 		{Type: &view.UserView{}, Name: "UserView", Exclude: "SiteID", MinAccessType: model.OfficialUser},
 		{Type: &view.ResidentView{}, Name: "ResidentView", Exclude: "", MinAccessType: model.ResidentUser},
 		{Type: &view.UnitStreetView{}, Name: "UnitStreetView", Exclude: "", MinAccessType: model.OfficialUser},
@@ -197,6 +323,29 @@ func registerModels() []et.ModelInfo {
 			BeforeListHook: handlers.BeforeUnitList,
 		},
 		{Type: &view.AvailableUnitsList{}, Name: "AvailableUnitsList", Exclude: "SiteID", MinAccessType: model.OfficialUser},
+		{Type: &model.GatePassLog{}, Name: "GatePassLog", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeSaveHook: handlers.BeforeSaveGatePassLog,
+		},
+		{Type: &model.Vehicle{}, Name: "Vehicle", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeListHook: handlers.BeforeListVehicle,
+			BeforeSaveHook: handlers.BeforeSaveVehicle,
+			DeleteHook:     handlers.DeleteVehicle,
+		},
+		{Type: &view.VehicleList{}, Name: "VehicleList", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeListHook: handlers.BeforeListVehicle,
+		},
+		{Type: &model.VehicleLog{}, Name: "VehicleLog", Exclude: "SiteID", MinAccessType: model.OfficialUser,
+			BeforeSaveHook: handlers.BeforeSaveVehicleLog,
+		},
+		{Type: &model.Watchlist{}, Name: "Watchlist", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeReadHook: handlers.BeforeReadWatchlist,
+			BeforeListHook: handlers.BeforeListWatchlist,
+			BeforeSaveHook: handlers.BeforeSaveWatchlist,
+		},
+		{Type: &model.WatchlistHit{}, Name: "WatchlistHit", Exclude: "SiteID", MinAccessType: model.SecurityUser,
+			BeforeListHook: handlers.BeforeListWatchlist,
+			BeforeSaveHook: handlers.BeforeSaveWatchlistHit,
+		},
 		{Type: &view.GatePassList{}, Name: "GatePassList", Exclude: "SiteID", MinAccessType: model.SecurityUser,
 			BeforeListHook: handlers.BeforeListGatePass,
 			AfterListHook:  handlers.AfterListGatePass,
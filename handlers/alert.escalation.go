@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"eve/service/model"
+	"eve/shared"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// AlertResponseTimes are the median seconds security took to acknowledge and resolve the
+// alerts of a guard or a shift
+type AlertResponseTimes struct {
+	Key                  string  `json:"key"`
+	Name                 string  `json:"name"`
+	Alerts               int     `json:"alerts"`
+	MedianAckSeconds     float64 `json:"median_ack_seconds"`
+	MedianResolveSeconds float64 `json:"median_resolve_seconds"`
+}
+
+// BeforeSaveAlertEscalationPolicy a site has one escalation policy, its tiers must be in
+// order of seconds waited
+func BeforeSaveAlertEscalationPolicy(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.AlertEscalationPolicy)
+
+	if err := validateEscalationTiers(record); err != nil {
+		return true, err
+	}
+
+	if len(oid) > 0 && oid != "new" {
+		_, err := tx.Model(record).
+			Column("active", "tiers", "on_shift_only").
+			Where("id = ? and site_id = ?", oid, siteID).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	count, err := tx.Model((*model.AlertEscalationPolicy)(nil)).Where("site_id = ?", siteID).Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, errors.New("the site already has an escalation policy")
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+func validateEscalationTiers(record *model.AlertEscalationPolicy) error {
+	tiers := []model.AlertEscalationTier{}
+	if len(record.Tiers) > 0 {
+		if err := json.Unmarshal(record.Tiers, &tiers); err != nil {
+			return errors.New("invalid tiers")
+		}
+	}
+
+	if len(tiers) == 0 {
+		return errors.New("an escalation policy needs at least one tier")
+	}
+
+	last := 0
+	for i, t := range tiers {
+		if t.AfterSeconds <= last {
+			return fmt.Errorf("tier %d must start after %d seconds", i+1, last)
+		}
+		if t.Target != model.EscalateSecurity && t.Target != model.EscalateOfficials {
+			return fmt.Errorf("tier %d must target security or officials", i+1)
+		}
+		if t.Target == model.EscalateOfficials && !t.Push && !t.Email {
+			return fmt.Errorf("tier %d must notify officials by push or email", i+1)
+		}
+		last = t.AfterSeconds
+	}
+
+	return nil
+}
+
+// BeforeSaveAlertEscalation escalations are recorded by the escalation monitor
+func BeforeSaveAlertEscalation(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	return true, errors.New("alert escalations are recorded by the server")
+}
+
+// stampAlertStatus records who acknowledged and resolved an alert and when, the stamps
+// are only set the first time
+func stampAlertStatus(alert *model.ResidentAlerts, status model.ResidentAlert, userID string) {
+	now := utils.DateTime{}.Now()
+
+	if status >= model.AlertResponded && alert.TimeResponded.IsZero() {
+		alert.TimeResponded = now
+		alert.RespondedBy = userID
+	}
+
+	if status >= model.AlertResolved && alert.TimeResolved.IsZero() {
+		alert.TimeResolved = now
+		alert.ResolvedBy = userID
+	}
+
+	alert.Status = status
+}
+
+// publishAlert queues the push of new alerts to the guards and returns the function that
+// sends the alert event to the guards the alert is routed to, the officials and the
+// resident. Inside a transaction the event is sent once it commits
+func publishAlert(db orm.DB, eventType string, alert *model.ResidentAlerts) (func(), error) {
+	guards, err := shared.AlertGuards(db, alert.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if eventType == "alert.new" {
+		_, err = shared.QueueGuardPush(db, alert.SiteID, guards, "Emergency alert",
+			fmt.Sprintf("%s (%s) raised a %s alert", alert.Name, alert.Address, alert.Category),
+			map[string]string{"type": "alert", "alert_id": alert.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	channels := append(shared.GuardChannels(guards), shared.RoleChannel(model.OfficialUser), shared.UserChannel(alert.ResidentID))
+	publish := func() {
+		shared.Publish(alert.SiteID, eventType, alert, channels...)
+	}
+
+	return publish, nil
+}
+
+// AlertResponseReport returns the median acknowledge and resolve times of the alerts
+// raised between ?from= and ?to= (the last 30 days by default), by guard and by shift
+func (s *Controller) AlertResponseReport(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	period, err := reportPeriod(c)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	summary := struct {
+		Alerts         int     `json:"alerts"`
+		Unacknowledged int     `json:"unacknowledged"`
+		Escalated      int     `json:"escalated"`
+		MedianAck      float64 `json:"median_ack_seconds"`
+		MedianResolve  float64 `json:"median_resolve_seconds"`
+	}{}
+	_, err = dbc.QueryOne(&summary, `
+		select
+			count(*) as alerts,
+			count(*) filter (where time_responded is null) as unacknowledged,
+			count(*) filter (where escalation_level > 0) as escalated,
+			coalesce(percentile_cont(0.5) within group (order by extract(epoch from time_responded - time_logged)), 0) as median_ack,
+			coalesce(percentile_cont(0.5) within group (order by extract(epoch from time_resolved - time_logged)), 0) as median_resolve
+		from
+			resident_alerts
+		where
+			site_id = ? and time_logged >= ? and time_logged < ?
+	`, period...)
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	guards := []AlertResponseTimes{}
+	_, err = dbc.Query(&guards, `
+		select
+			a.responded_by as key, concat(u.first_name, ' ', u.last_name) as name, count(*) as alerts,
+			percentile_cont(0.5) within group (order by extract(epoch from a.time_responded - a.time_logged)) as median_ack_seconds,
+			coalesce(percentile_cont(0.5) within group (order by extract(epoch from a.time_resolved - a.time_logged)), 0) as median_resolve_seconds
+		from
+			resident_alerts as a
+		left join "user" as u
+			on u.id = a.responded_by
+		where
+			a.site_id = ? and a.time_logged >= ? and a.time_logged < ? and a.time_responded is not null
+		group by
+			a.responded_by, u.first_name, u.last_name
+		order by
+			median_ack_seconds
+	`, period...)
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	// alerts are grouped by the name of the shift of the guard who answered them, alerts
+	// answered off shift fall in the day (06:00 to 18:00) or night band
+	shifts := []AlertResponseTimes{}
+	_, err = dbc.Query(&shifts, `
+		select
+			shift as key, shift as name, count(*) as alerts,
+			percentile_cont(0.5) within group (order by extract(epoch from time_responded - time_logged)) as median_ack_seconds,
+			coalesce(percentile_cont(0.5) within group (order by extract(epoch from time_resolved - time_logged)), 0) as median_resolve_seconds
+		from (
+			select
+				r.*, coalesce(
+					(select coalesce(nullif(gs.name, ''), 'unnamed') from guard_shift as gs
+						where
+							gs.guard_id = r.responded_by and gs.status <> ? and
+							r.time_responded between coalesce(gs.clock_in, gs.date_start) and coalesce(gs.clock_out, gs.date_end)
+						limit 1),
+					case when extract(hour from r.time_logged) between 6 and 17 then 'day' else 'night' end
+				) as shift
+			from
+				resident_alerts as r
+			where
+				r.site_id = ? and r.time_logged >= ? and r.time_logged < ? and r.time_responded is not null
+		) as a
+		group by
+			shift
+	`, append([]interface{}{model.ShiftCancelled}, period...)...)
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	response.Set("summary", summary)
+	response.Set("guards", guards)
+	response.Set("shifts", shifts)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// reportPeriod returns the site and the dates of ?from= and ?to= as query params, the
+// period defaults to the last 30 days and includes the to date
+func reportPeriod(c echo.Context) ([]interface{}, error) {
+	var err error
+
+	to := time.Now().AddDate(0, 0, 1)
+	if val := c.QueryParam("to"); len(val) > 0 {
+		if to, err = time.Parse("2006-01-02", val); err != nil {
+			return nil, errors.New("to must be a date")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	from := to.AddDate(0, 0, -31)
+	if val := c.QueryParam("from"); len(val) > 0 {
+		if from, err = time.Parse("2006-01-02", val); err != nil {
+			return nil, errors.New("from must be a date")
+		}
+	}
+
+	return []interface{}{getSiteID(c), from.Format("2006-01-02"), to.Format("2006-01-02")}, nil
+}
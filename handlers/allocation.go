@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/go-pg/pg"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// openItem is the outstanding balance of a due on an invoice
+type openItem struct {
+	InvoiceID string
+	DueID     string
+	Name      string
+	Balance   decimal.Decimal
+}
+
+// allocation is the portion of a payment applied to a due on an invoice, an
+// empty DueID is unallocated credit held in the residents wallet
+type allocation struct {
+	InvoiceID string
+	DueID     string
+	Name      string
+	Amount    decimal.Decimal
+}
+
+// lockInvoices locks the invoices of a resident until the transaction ends, so payments,
+// wallet use and credit notes read the same open balances one after the other
+func lockInvoices(tx *pg.Tx, residentID string) error {
+	_, err := tx.Exec(`
+		select id from invoice where resident_id = ? order by id for update
+	`, residentID)
+	if err != nil {
+		utils.Env.Log.Debug(err)
+	}
+
+	return err
+}
+
+// openItems returns the residents unpaid invoice dues, oldest invoice first. Payments
+// recorded before allocation (not linked to an invoice) are applied to the oldest items of their due.
+// The residents invoices are locked
+func openItems(tx *pg.Tx, residentID string) ([]openItem, error) {
+	log := utils.Env.Log
+
+	if err := lockInvoices(tx, residentID); err != nil {
+		return nil, err
+	}
+
+	items := []openItem{}
+	_, err := tx.Query(&items, `
+		select
+			t.invoice_id, t.due_id, d.name, sum(t.amount) * -1 as balance
+		from
+			transaction as t
+		left join invoice as i
+			on i.id = t.invoice_id
+		left join due as d
+			on d.id = t.due_id
+		where
+			t.resident_id = ? and t.invoice_id is not null and t.due_id is not null
+		group by
+			t.invoice_id, t.due_id, d.name, i.year, i.month, i.date_created
+		order by
+			i.year, i.month, i.date_created
+	`, residentID)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	unlinked := []InvDue{}
+	_, err = tx.Query(&unlinked, `
+		select
+			due_id, sum(amount) as amount
+		from
+			transaction
+		where
+			resident_id = ? and invoice_id is null and due_id is not null
+		group by
+			due_id
+		having
+			sum(amount) > 0
+	`, residentID)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	for _, u := range unlinked {
+		left := u.Amount
+		for i := range items {
+			if left.Sign() <= 0 {
+				break
+			}
+			if items[i].DueID != u.DueID || items[i].Balance.Sign() <= 0 {
+				continue
+			}
+
+			amt := decimal.Min(left, items[i].Balance)
+			items[i].Balance = items[i].Balance.Sub(amt)
+			left = left.Sub(amt)
+		}
+	}
+
+	open := []openItem{}
+	for _, i := range items {
+		if i.Balance.Sign() > 0 {
+			open = append(open, i)
+		}
+	}
+
+	return open, nil
+}
+
+// allocateFIFO pays the oldest items first
+func allocateFIFO(items []openItem, amount decimal.Decimal) ([]allocation, decimal.Decimal) {
+	list := []allocation{}
+	left := amount
+
+	for _, i := range items {
+		if left.Sign() <= 0 {
+			break
+		}
+
+		amt := decimal.Min(left, i.Balance)
+		list = append(list, allocation{InvoiceID: i.InvoiceID, DueID: i.DueID, Name: i.Name, Amount: amt})
+		left = left.Sub(amt)
+	}
+
+	return list, left
+}
+
+// allocateProportional spreads the amount across all items relative to their balance,
+// rounding differences go to the oldest items
+func allocateProportional(items []openItem, amount decimal.Decimal) ([]allocation, decimal.Decimal) {
+	total := decimal.Zero
+	for _, i := range items {
+		total = total.Add(i.Balance)
+	}
+
+	if amount.GreaterThanOrEqual(total) {
+		return allocateFIFO(items, amount)
+	}
+
+	left := amount
+	shares := make([]decimal.Decimal, len(items))
+	for k, i := range items {
+		shares[k] = amount.Mul(i.Balance).Div(total).Truncate(2)
+		left = left.Sub(shares[k])
+	}
+
+	for k, i := range items {
+		if left.Sign() <= 0 {
+			break
+		}
+
+		amt := decimal.Min(left, i.Balance.Sub(shares[k]))
+		shares[k] = shares[k].Add(amt)
+		left = left.Sub(amt)
+	}
+
+	list := []allocation{}
+	for k, i := range items {
+		if shares[k].Sign() > 0 {
+			list = append(list, allocation{InvoiceID: i.InvoiceID, DueID: i.DueID, Name: i.Name, Amount: shares[k]})
+		}
+	}
+
+	return list, left
+}
+
+// allocateExplicit applies the amounts chosen for each due to that dues oldest items,
+// any excess on a due is kept against the due as an advance payment
+func allocateExplicit(items []openItem, amount decimal.Decimal, dues []InvDue) ([]allocation, decimal.Decimal, error) {
+	list := []allocation{}
+	left := amount
+
+	merged := []InvDue{}
+	for _, d := range dues {
+		merged = addDue(merged, d)
+	}
+
+	for _, d := range merged {
+		if d.Amount.Sign() <= 0 {
+			continue
+		}
+		if d.Amount.GreaterThan(left) {
+			return nil, left, errors.New("dues exceed the amount paid")
+		}
+
+		dueLeft := d.Amount
+		for _, i := range items {
+			if dueLeft.Sign() <= 0 {
+				break
+			}
+			if i.DueID != d.DueID {
+				continue
+			}
+
+			amt := decimal.Min(dueLeft, i.Balance)
+			list = append(list, allocation{InvoiceID: i.InvoiceID, DueID: i.DueID, Name: i.Name, Amount: amt})
+			dueLeft = dueLeft.Sub(amt)
+		}
+
+		if dueLeft.Sign() > 0 {
+			list = append(list, allocation{DueID: d.DueID, Name: d.Name, Amount: dueLeft})
+		}
+
+		left = left.Sub(d.Amount)
+	}
+
+	return list, left, nil
+}
+
+// allocatePayment splits a payment across the residents unpaid dues and posts the
+// transaction records, anything left over goes to the residents wallet
+func allocatePayment(tx *pg.Tx, payment *model.Payment, dateTrx utils.DateTime, dues []InvDue) error {
+	log := utils.Env.Log
+
+	if payment.Allocation == 0 {
+		payment.Allocation = model.AllocateFIFO
+		if len(dues) > 0 {
+			payment.Allocation = model.AllocateExplicit
+		}
+	}
+
+	items, err := openItems(tx, payment.ResidentID)
+	if err != nil {
+		return err
+	}
+
+	var list []allocation
+	var left decimal.Decimal
+
+	switch payment.Allocation {
+	case model.AllocateFIFO:
+		list, left = allocateFIFO(items, payment.Amount)
+	case model.AllocateProportional:
+		list, left = allocateProportional(items, payment.Amount)
+	case model.AllocateExplicit:
+		list, left, err = allocateExplicit(items, payment.Amount, dues)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown allocation strategy %d", payment.Allocation)
+	}
+
+	if left.Sign() > 0 {
+		list = append(list, allocation{Name: "Wallet", Amount: left})
+	}
+
+	j := newJournal(payment.SiteID, payment.ResidentID, model.JournalPayment, payment.ID,
+		"Payment", dateTrx)
+	j.debit(model.LedgerBank, strconv.Itoa(payment.PayMode), payment.Amount)
+
+	summary := []InvDue{}
+	for _, a := range list {
+		trx := &model.Transaction{
+			ID:         xid.New().String(),
+			SiteID:     payment.SiteID,
+			Type:       model.TrxPayment,
+			ResidentID: payment.ResidentID,
+			PaymentID:  payment.ID,
+			DateTrx:    dateTrx,
+			InvoiceID:  a.InvoiceID,
+			DueID:      a.DueID,
+			Amount:     a.Amount,
+		}
+		if _, err := tx.Model(trx).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		summary = addDue(summary, InvDue{DueID: a.DueID, Name: a.Name, Amount: a.Amount})
+
+		if len(a.DueID) > 0 {
+			j.credit(model.LedgerReceivable, a.DueID, a.Amount)
+		} else {
+			j.credit(model.LedgerWallet, "", a.Amount)
+		}
+	}
+
+	if err := j.post(tx); err != nil {
+		return err
+	}
+
+	// anything left over funds the residents wallet
+	if left.Sign() > 0 {
+		_, err := moveWallet(tx, payment.SiteID, payment.ResidentID, &model.WalletMovement{
+			Type:      model.WalletFunded,
+			Amount:    left,
+			PaymentID: payment.ID,
+			Narration: "Over-payment",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := matchInstallments(tx, payment); err != nil {
+		return err
+	}
+
+	// dues paid are shown on the receipt
+	payment.Dues, err = json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Model(payment).
+		Column("dues", "allocation").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return nil
+}
+
+func addDue(list []InvDue, due InvDue) []InvDue {
+	for k, i := range list {
+		if i.DueID == due.DueID {
+			list[k].Amount = i.Amount.Add(due.Amount)
+			return list
+		}
+	}
+
+	return append(list, due)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func amount(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func sameAllocations(t *testing.T, got []allocation, want []allocation) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("allocations = %+v, want %+v", got, want)
+	}
+	for k := range want {
+		if got[k].InvoiceID != want[k].InvoiceID || got[k].DueID != want[k].DueID || !got[k].Amount.Equal(want[k].Amount) {
+			t.Errorf("allocation %d = %+v, want %+v", k, got[k], want[k])
+		}
+	}
+}
+
+func testItems() []openItem {
+	return []openItem{
+		{InvoiceID: "i1", DueID: "levy", Balance: amount("100")},
+		{InvoiceID: "i1", DueID: "water", Balance: amount("50")},
+		{InvoiceID: "i2", DueID: "levy", Balance: amount("100")},
+	}
+}
+
+func TestAllocateFIFO(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  []openItem
+		amount string
+		want   []allocation
+		left   string
+	}{
+		{"no open items", nil, "80", []allocation{}, "80"},
+		{"part of the oldest item", testItems(), "60", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("60")},
+		}, "0"},
+		{"oldest items first", testItems(), "180.50", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("100")},
+			{InvoiceID: "i1", DueID: "water", Amount: amount("50")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("30.50")},
+		}, "0"},
+		{"exact balance", testItems(), "250", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("100")},
+			{InvoiceID: "i1", DueID: "water", Amount: amount("50")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("100")},
+		}, "0"},
+		{"overpayment is left over", testItems(), "300", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("100")},
+			{InvoiceID: "i1", DueID: "water", Amount: amount("50")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("100")},
+		}, "50"},
+		{"nothing paid", testItems(), "0", []allocation{}, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, left := allocateFIFO(tt.items, amount(tt.amount))
+			sameAllocations(t, got, tt.want)
+			if !left.Equal(amount(tt.left)) {
+				t.Errorf("left = %s, want %s", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestAllocateProportional(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount string
+		want   []allocation
+		left   string
+	}{
+		{"spread by balance", "125", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("50")},
+			{InvoiceID: "i1", DueID: "water", Amount: amount("25")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("50")},
+		}, "0"},
+		{"rounding goes to the oldest item", "100", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("40")},
+			{InvoiceID: "i1", DueID: "water", Amount: amount("20")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("40")},
+		}, "0"},
+		{"odd cents", "0.11", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("0.05")},
+			{InvoiceID: "i1", DueID: "water", Amount: amount("0.02")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("0.04")},
+		}, "0"},
+		{"overpayment pays everything", "260", []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("100")},
+			{InvoiceID: "i1", DueID: "water", Amount: amount("50")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("100")},
+		}, "10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, left := allocateProportional(testItems(), amount(tt.amount))
+			sameAllocations(t, got, tt.want)
+			if !left.Equal(amount(tt.left)) {
+				t.Errorf("left = %s, want %s", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestAllocateExplicit(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount string
+		dues   []InvDue
+		want   []allocation
+		left   string
+		ok     bool
+	}{
+		{"oldest items of the due", "150", []InvDue{{DueID: "levy", Amount: amount("150")}}, []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("100")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("50")},
+		}, "0", true},
+		{"excess is an advance on the due", "80", []InvDue{{DueID: "water", Amount: amount("80")}}, []allocation{
+			{InvoiceID: "i1", DueID: "water", Amount: amount("50")},
+			{DueID: "water", Amount: amount("30")},
+		}, "0", true},
+		{"repeated dues are merged", "120", []InvDue{{DueID: "levy", Amount: amount("60")}, {DueID: "levy", Amount: amount("60")}}, []allocation{
+			{InvoiceID: "i1", DueID: "levy", Amount: amount("100")},
+			{InvoiceID: "i2", DueID: "levy", Amount: amount("20")},
+		}, "0", true},
+		{"unchosen amount is left over", "100", []InvDue{{DueID: "water", Amount: amount("40")}}, []allocation{
+			{InvoiceID: "i1", DueID: "water", Amount: amount("40")},
+		}, "60", true},
+		{"dues exceed the payment", "50", []InvDue{{DueID: "levy", Amount: amount("60")}}, nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, left, err := allocateExplicit(testItems(), amount(tt.amount), tt.dues)
+			if (err == nil) != tt.ok {
+				t.Fatalf("allocateExplicit() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			sameAllocations(t, got, tt.want)
+			if !left.Equal(amount(tt.left)) {
+				t.Errorf("left = %s, want %s", left, tt.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"eve/service/model"
+	"eve/service/view"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// ImportBankStatement imports the credits of a csv or ofx statement and matches them to
+// pending payments and residents. Lines already imported are skipped
+func (s *Controller) ImportBankStatement(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	// data is the file as a data uri or plain base64
+	frm := struct {
+		FileName string `json:"file_name"`
+		Data     string `json:"data"`
+	}{}
+	if err := c.Bind(&frm); err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	data := frm.Data
+	if i := strings.Index(data, ";base64,"); i >= 0 {
+		data = data[i+8:]
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return et.APIError(c, fmt.Errorf("invalid statement file"), http.StatusBadRequest)
+	}
+
+	parsed, err := utils.ParseBankStatement(frm.FileName, raw)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	siteID := ses.String("admin_site_id")
+	stmt := &model.BankStatement{
+		ID:       xid.New().String(),
+		SiteID:   siteID,
+		FileName: frm.FileName,
+		Format:   parsed.Format,
+		Account:  parsed.Account,
+		ImportedBy: model.UserDetails{
+			UserID:   ses.String("admin_id"),
+			UserType: ses.Int("admin_type"),
+			Name:     ses.String("admin_name"),
+		},
+		DateCreated: utils.DateTime{}.Now(),
+	}
+
+	matched := 0
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) error {
+		if _, err := tx.Model(stmt).Insert(); err != nil {
+			return err
+		}
+
+		matcher, err := newStatementMatcher(tx, siteID)
+		if err != nil {
+			return err
+		}
+
+		seen := map[string]bool{}
+		for _, l := range parsed.Lines {
+			// debits are payments made by the association, they are recorded as expenses
+			if l.Amount.Sign() <= 0 {
+				continue
+			}
+
+			if stmt.DateFrom.IsZero() || l.Date.Before(stmt.DateFrom.Time) {
+				stmt.DateFrom = utils.NewDateTime(l.Date)
+			}
+			if l.Date.After(stmt.DateTo.Time) {
+				stmt.DateTo = utils.NewDateTime(l.Date)
+			}
+
+			ref := l.LineReference()
+			count, err := tx.Model((*model.BankStatementLine)(nil)).
+				Where("site_id = ? and reference = ?", siteID, ref).
+				Count()
+			if err != nil {
+				return err
+			}
+			if count > 0 || seen[ref] {
+				stmt.Duplicates++
+				continue
+			}
+			seen[ref] = true
+
+			line := &model.BankStatementLine{
+				ID:          xid.New().String(),
+				SiteID:      siteID,
+				StatementID: stmt.ID,
+				DateTrx:     utils.NewDateTime(l.Date),
+				Amount:      l.Amount,
+				Narration:   l.Narration,
+				Reference:   ref,
+			}
+			matcher.match(line)
+			if line.Status == model.StatementLineMatched {
+				matched++
+			}
+
+			if _, err := tx.Model(line).Insert(); err != nil {
+				return err
+			}
+			stmt.Credits++
+		}
+
+		_, err = tx.Model(stmt).
+			Column("date_from", "date_to", "credits", "duplicates").
+			WherePK().
+			Update()
+		return err
+	})
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	response.Set("id", stmt.ID)
+	response.Set("credits", stmt.Credits)
+	response.Set("duplicates", stmt.Duplicates)
+	response.Set("matched", matched)
+	response.Set("unmatched", stmt.Credits-matched)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// GetBankStatement returns a statement with its lines and the pending payments still open
+func (s *Controller) GetBankStatement(c echo.Context) error {
+	dbc := s.env.Dbc
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	siteID := ses.String("admin_site_id")
+
+	stmt := model.BankStatement{}
+	err = dbc.Model(&stmt).
+		Where("id = ? and site_id = ?", c.Param("id"), siteID).
+		Select()
+	if err != nil {
+		return et.APIError(c, fmt.Errorf("unknown statement"), http.StatusBadRequest)
+	}
+
+	lines := []view.BankStatementLineList{}
+	err = dbc.Model(&lines).
+		Where("statement_id = ?", stmt.ID).
+		Order("date_trx", "amount").
+		Select()
+	if err != nil {
+		s.log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	pending := []model.PaymentPending{}
+	err = dbc.Model(&pending).
+		Where("site_id = ?", siteID).
+		Order("date_trx").
+		Select()
+	if err != nil {
+		s.log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	response.Set("statement", stmt)
+	response.Set("list", lines)
+	response.Set("pending", pending)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// ReconcileBankStatement confirms statement lines in bulk. A line is reconciled to the
+// given pending payment or resident, or to the suggested match when none is given.
+// Reconciled lines are posted as bank transfer payments
+func (s *Controller) ReconcileBankStatement(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	frm := struct {
+		Lines []struct {
+			ID         string `json:"id"`
+			PendingID  string `json:"pending_id"`
+			ResidentID string `json:"resident_id"`
+			// "ignore" for credits that are not resident payments
+			Action string `json:"action"`
+		} `json:"lines"`
+	}{}
+	if err := c.Bind(&frm); err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+	if len(frm.Lines) == 0 {
+		return et.APIError(c, fmt.Errorf("no lines to reconcile"), http.StatusBadRequest)
+	}
+
+	siteID := ses.String("admin_site_id")
+	by := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	reconciled := 0
+	ignored := 0
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) error {
+		for _, f := range frm.Lines {
+			line := &model.BankStatementLine{}
+			err := tx.Model(line).
+				Where("id = ? and site_id = ?", f.ID, siteID).
+				For("update").
+				Select()
+			if err != nil {
+				return fmt.Errorf("unknown statement line %s", f.ID)
+			}
+
+			if line.Status == model.StatementLineReconciled {
+				return fmt.Errorf("line %s has already been reconciled", line.Reference)
+			}
+
+			if f.Action == "ignore" {
+				line.Status = model.StatementLineIgnored
+				line.ReconciledBy = by
+				line.DateReconciled = utils.DateTime{}.Now()
+				_, err := tx.Model(line).
+					Column("status", "reconciled_by", "date_reconciled").
+					WherePK().
+					Update()
+				if err != nil {
+					return err
+				}
+
+				ignored++
+				continue
+			}
+
+			if len(f.PendingID) > 0 {
+				line.MatchType, line.PendingID = model.MatchPendingPayment, f.PendingID
+			} else if len(f.ResidentID) > 0 {
+				line.MatchType, line.PendingID, line.ResidentID = model.MatchResident, "", f.ResidentID
+			}
+
+			if err := reconcileStatementLine(tx, ses, line); err != nil {
+				return fmt.Errorf("line %s: %s", line.Reference, err)
+			}
+
+			line.Status = model.StatementLineReconciled
+			line.ReconciledBy = by
+			line.DateReconciled = utils.DateTime{}.Now()
+			_, err = tx.Model(line).
+				Column("status", "match_type", "pending_id", "resident_id", "payment_id",
+					"reconciled_by", "date_reconciled").
+				WherePK().
+				Update()
+			if err != nil {
+				return err
+			}
+
+			reconciled++
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	response.Set("reconciled", reconciled)
+	response.Set("ignored", ignored)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// reconcileStatementLine posts the payment for a matched line, a pending payment is
+// approved with the amount received and removed
+func reconcileStatementLine(tx *pg.Tx, ses *et.SessionMgr, line *model.BankStatementLine) error {
+	log := utils.Env.Log
+
+	pending := &model.PaymentPending{}
+
+	switch line.MatchType {
+	case model.MatchPendingPayment:
+		err := tx.Model(pending).
+			Where("id = ? and site_id = ?", line.PendingID, line.SiteID).
+			For("update").
+			Select()
+		if err != nil {
+			log.Debug(err)
+			return errors.New("unknown pending payment")
+		}
+
+		// the dues of the pending payment no longer add up, allocate what was received
+		if !pending.Amount.Equal(line.Amount) {
+			pending.Amount = line.Amount
+			pending.Allocation = model.AllocateFIFO
+			pending.Dues = nil
+		}
+
+	case model.MatchResident:
+		count, err := tx.Model((*model.Resident)(nil)).
+			Join("left join residency as rs on rs.id = resident.residency_id").
+			Where("resident.id = ? and resident.type = ? and rs.site_id = ?", line.ResidentID, model.PrimaryResident, line.SiteID).
+			Count()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+		if count == 0 {
+			return errors.New("unknown resident")
+		}
+
+		pending = &model.PaymentPending{
+			SiteID:     line.SiteID,
+			ResidentID: line.ResidentID,
+			Narration:  fmt.Sprintf("bank transfer %s", line.Narration),
+			Amount:     line.Amount,
+			Allocation: model.AllocateFIFO,
+		}
+
+		attr, err := json.Marshal(map[string]string{"bank_reference": line.Reference})
+		if err != nil {
+			return err
+		}
+		pending.Attr = attr
+
+	default:
+		return errors.New("no pending payment or resident to reconcile to")
+	}
+
+	payment, err := postBankPayment(tx, ses, pending, line.DateTrx)
+	if err != nil {
+		return err
+	}
+	line.ResidentID = payment.ResidentID
+	line.PaymentID = payment.ID
+
+	if line.MatchType == model.MatchPendingPayment {
+		if _, err := tx.Model(pending).WherePK().Delete(); err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/go-pg/pg"
+	"github.com/shopspring/decimal"
+)
+
+// scores needed for a statement line to be matched, officials confirm matches
+// when reconciling
+const (
+	pendingMatchScore  = 60
+	residentMatchScore = 50
+)
+
+// words banks add to transfer narrations, they say nothing about the payer
+var narrationNoise = map[string]bool{
+	"trf": true, "transfer": true, "from": true, "to": true, "nip": true, "frm": true,
+	"mob": true, "web": true, "ussd": true, "pos": true, "inflow": true, "payment": true,
+	"for": true, "the": true, "and": true, "ref": true, "via": true, "ltd": true,
+}
+
+type residentBalance struct {
+	ID      string
+	Name    string
+	Balance decimal.Decimal
+}
+
+// statementMatcher suggests a pending payment or resident for each credit of a statement
+type statementMatcher struct {
+	pending   []model.PaymentPending
+	residents []residentBalance
+	used      map[string]bool
+}
+
+func newStatementMatcher(tx *pg.Tx, siteID string) (*statementMatcher, error) {
+	log := utils.Env.Log
+
+	m := &statementMatcher{used: map[string]bool{}}
+
+	// pending payments already suggested for another line are left out
+	err := tx.Model(&m.pending).
+		Where("site_id = ?", siteID).
+		Where(`not exists (
+			select 1 from bank_statement_line as l
+			where l.pending_id = payment_pending.id and l.status in (?, ?)
+		)`, model.StatementLineMatched, model.StatementLineReconciled).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	_, err = tx.Query(&m.residents, `
+		select id, name, balance
+		from resident_account_status
+		where site_id = ?
+	`, siteID)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// match scores the line against the open pending payments first and then against
+// the residents of the site, lines with no good match are left unmatched
+func (m *statementMatcher) match(line *model.BankStatementLine) {
+	line.Status = model.StatementLineUnmatched
+	line.MatchType = 0
+	line.PendingID = ""
+	line.ResidentID = ""
+	line.Score = 0
+
+	tokens := narrationTokens(line.Narration)
+
+	best := -1
+	for i, p := range m.pending {
+		if m.used[p.ID] {
+			continue
+		}
+
+		score := amountScore(line.Amount, p.Amount) + dateScore(line.DateTrx.Time, p.DateTrx.Time) +
+			nameScore(tokens, p.ResidentName+" "+p.Narration)*25/100
+		if score > line.Score {
+			best, line.Score = i, score
+		}
+	}
+
+	if best >= 0 && line.Score >= pendingMatchScore {
+		p := m.pending[best]
+		m.used[p.ID] = true
+
+		line.Status = model.StatementLineMatched
+		line.MatchType = model.MatchPendingPayment
+		line.PendingID = p.ID
+		line.ResidentID = p.ResidentID
+		return
+	}
+
+	line.Score = 0
+	for _, r := range m.residents {
+		score := nameScore(tokens, r.Name) * 60 / 100
+		if score == 0 {
+			continue
+		}
+
+		// paying exactly what is owed
+		if r.Balance.Sign() < 0 && r.Balance.Neg().Equal(line.Amount) {
+			score += 20
+		}
+
+		if score > line.Score {
+			line.Score = score
+			line.ResidentID = r.ID
+		}
+	}
+
+	if line.Score >= residentMatchScore {
+		line.Status = model.StatementLineMatched
+		line.MatchType = model.MatchResident
+		return
+	}
+
+	line.ResidentID = ""
+}
+
+func amountScore(a, b decimal.Decimal) int {
+	if a.Equal(b) {
+		return 50
+	}
+
+	// within 1%, bank charges deducted from the transfer
+	if b.Sign() > 0 && a.Sub(b).Abs().LessThanOrEqual(b.Div(decimal.New(100, 0))) {
+		return 25
+	}
+
+	return 0
+}
+
+func dateScore(a, b time.Time) int {
+	days := a.Sub(b).Hours() / 24
+	if days < 0 {
+		days = -days
+	}
+
+	switch {
+	case a.Year() == b.Year() && a.YearDay() == b.YearDay():
+		return 25
+	case days <= 3:
+		return 15
+	case days <= 7:
+		return 5
+	}
+
+	return 0
+}
+
+// nameScore returns the percentage of the name tokens found in the narration
+func nameScore(narration []string, name string) int {
+	tokens := narrationTokens(name)
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	found := 0
+	for _, t := range tokens {
+		for _, n := range narration {
+			if t == n || (len(t) >= 5 && len(n) >= 5 && levenshtein(t, n) <= 1) {
+				found++
+				break
+			}
+		}
+	}
+
+	return found * 100 / len(tokens)
+}
+
+func narrationTokens(s string) []string {
+	tokens := []string{}
+	for _, t := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(t) < 3 || narrationNoise[t] {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+)
+
+// BeforeSaveBankStatement statements are only created by importing a statement file
+func BeforeSaveBankStatement(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	return true, errors.New("bank statements are imported, they cannot be edited")
+}
+
+// DeleteBankStatement removes an import that has no reconciled lines
+func DeleteBankStatement(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	count, err := tx.Model((*model.BankStatementLine)(nil)).
+		Where("statement_id = ? and site_id = ? and status = ?", c.Param("id"), getSiteID(c), model.StatementLineReconciled).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, errors.New("statement has reconciled lines")
+	}
+
+	return false, nil
+}
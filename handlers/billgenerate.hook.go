@@ -209,6 +209,11 @@ func generateBill(id string, tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm in
 			Amount:      bill.Total.Div(portion),
 			Dues:        bill.Items,
 		}
+		invoice.InvoiceNo, err = nextInvoiceNo(tx, siteID, invoice.DateCreated.Time)
+		if err != nil {
+			return false, err
+		}
+
 		if _, err := tx.Model(invoice).Insert(); err != nil {
 			log.Debug(err)
 			return false, err
@@ -237,6 +242,15 @@ func generateBill(id string, tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm in
 			}
 		}
 
+		if err := journalInvoice(tx, invoice); err != nil {
+			return false, err
+		}
+
+		// settle the new invoice from the residents wallet
+		if _, err := applyWallet(tx, siteID, r.ID, true, model.UserDetails{}); err != nil {
+			return false, err
+		}
+
 		// email Invoice
 		invEml, err := shared.MakeInvoice(tx, invoice.ID)
 		if err != nil {
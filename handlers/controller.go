@@ -1,8 +1,7 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"eve/service/form"
 	"eve/service/model"
 	"eve/service/view"
@@ -10,13 +9,13 @@ import (
 	"eve/utils"
 	et "eve/utils/echotools"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/go-pg/pg"
 	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 )
 
@@ -48,6 +47,7 @@ func (s *Controller) Initialize(env *et.Env) error {
 		{Path: s.Path, Role: et.RoleEveryone, Permission: et.PermissionAll},
 		{Path: s.Path, Role: et.RoleEveryone, Permission: et.PermissionAll},
 		{Path: utils.URLJoin(s.Path, "/paystack"), Role: et.RoleUser, Permission: et.PermissionReadWrite},
+		{Path: utils.URLJoin(s.Path, "/pay"), Role: et.RoleUser, Permission: et.PermissionReadWrite},
 	})
 
 	acOpts := et.AccessControllerOptions{
@@ -66,6 +66,21 @@ func (s *Controller) Initialize(env *et.Env) error {
 	grp.GET("/pvdrs/:id", s.GetProviders)
 	grp.POST("/email", s.VerifyEmail)
 	grp.POST("/paystack", s.VerifyPaystack)
+	grp.POST("/pay/:provider", s.InitializePayment)
+	grp.POST("/webhook/:provider", s.PaymentWebhook)
+	grp.POST("/webhook/:provider/:site", s.PaymentWebhook)
+	grp.POST("/wallet/:id/apply", s.ApplyResidentWallet)
+	grp.GET("/statement/:id", s.GetStatement)
+	grp.POST("/statement/:id/email", s.EmailStatement)
+	grp.GET("/ledger/trial-balance", s.GetTrialBalance)
+	grp.GET("/ledger/:id", s.GetLedger)
+	grp.POST("/bank/statement", s.ImportBankStatement)
+	grp.GET("/bank/statement/:id", s.GetBankStatement)
+	grp.POST("/bank/reconcile", s.ReconcileBankStatement)
+	grp.POST("/dunning/run", s.RunDunning)
+	grp.GET("/alerts/response", s.AlertResponseReport)
+	grp.GET("/incidents/report", s.IncidentReport)
+	grp.GET("/shifts/report", s.ShiftReport)
 
 	return nil
 }
@@ -152,24 +167,17 @@ func (s *Controller) GetPublicKey(c echo.Context) (err error) {
 	param := c.Param("id")
 	ID, _ := strconv.Atoi(param)
 
-	provider := model.GetProvider(model.PayProvider(ID))
-
-	ProviderSection, err := utils.Getkey("", "ProviderSection")
+	keys, err := siteKeys(s.env.Dbc, getSiteID(c), model.PayProvider(ID))
 	if err != nil {
 		return err
 	}
-
-	publicKey, err := utils.Getkey(ProviderSection, fmt.Sprintf("%s_public", provider.Name))
-	if err != nil {
-		return err
+	if len(keys.Public) == 0 {
+		return errors.New("empty key")
 	}
+	publicKey := keys.Public
 
 	if ID == int(model.ProviderFlutterwave) {
-		encryptionKey, _ := utils.Getkey(ProviderSection, fmt.Sprintf("%s_encryption_key", provider.Name))
-		if err != nil {
-			return err
-		}
-		response.Set("encryption_key", encryptionKey)
+		response.Set("encryption_key", keys.Encryption)
 	}
 
 	response.Set("public_key", publicKey)
@@ -191,6 +199,30 @@ func (s *Controller) GetTpl(c echo.Context) (err error) {
 	typ := c.QueryParam("typ")
 	var eml *shared.EMailMsg
 
+	// printable copy for download
+	if c.QueryParam("format") == "pdf" {
+		var pdf []byte
+
+		err = utils.Transact(dbc, log, func(tx *pg.Tx) error {
+			if typ == "invoice" {
+				pdf, err = shared.MakeInvoicePDF(tx, rid)
+			} else if typ == "receipt" {
+				pdf, err = shared.MakeReceiptPDF(tx, rid)
+			} else {
+				err = fmt.Errorf("url parameter &typ=\"???\" not provided")
+			}
+
+			return err
+		})
+		if err != nil {
+			return et.APIError(c, err, http.StatusBadRequest)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition,
+			fmt.Sprintf("attachment; filename=\"%s-%s.pdf\"", typ, rid))
+		return c.Blob(http.StatusOK, "application/pdf", pdf)
+	}
+
 	utils.Transact(dbc, log, func(tx *pg.Tx) error {
 		if typ == "invoice" {
 			eml, err = shared.MakeInvoice(tx, rid)
@@ -215,74 +247,23 @@ func (s *Controller) GetTpl(c echo.Context) (err error) {
 	return nil
 }
 
+// VerifyPaystack initializes a paystack payment, the amount is in kobo
 func (s *Controller) VerifyPaystack(c echo.Context) (err error) {
-	log := utils.Env.Log
-	response := utils.Response{}
-
 	form := model.InitializePaystackRequest{}
 
 	if err := c.Bind(&form); err != nil {
 		return err
 	}
 
-	field := fmt.Sprintf("%s_secret", "paystack")
-
-	secretKey, err := utils.Getkey("testpayments", field)
-	if err != nil {
-		return err
-	}
-
-	// log.Debug("secret Key", secretKey)
-	// log.Debug("data", )
-
-	byteData, err := json.Marshal(form)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, "https://api.paystack.co/transaction/initialize", bytes.NewBuffer(byteData))
-	if err != nil {
-		return
-	}
-
-	// setting the header
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secretKey))
-
-	client := &http.Client{}
-
-	// send request
-	resp, err := client.Do(req)
-
+	amount, err := decimal.NewFromString(form.Amount)
 	if err != nil {
-		return
+		return et.APIError(c, fmt.Errorf("invalid amount"), http.StatusBadRequest)
 	}
 
-	var byteRes []byte
-
-	// read response as byte
-	byteRes, err = ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		return
-
-	}
-
-	log.Debug("got response from paystack")
-
-	paystackRes := model.InitializePaystackResponse{}
-
-	err = json.Unmarshal(byteRes, &paystackRes)
-
-	if err != nil {
-		return err
-	}
-
-	response.SetStore(paystackRes.Data)
-
-	if err = c.JSON(http.StatusOK, response); err != nil {
-		s.log.Error(err)
-		return
-	}
-
-	return
+	return s.initializePayment(c, model.ProviderPaystack, model.InitializePaymentRequest{
+		Email:     form.Email,
+		Amount:    amount.Div(decimal.New(100, 0)),
+		Reference: form.Reference,
+		Metadata:  form.Metadata,
+	})
 }
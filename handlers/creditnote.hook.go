@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// BeforeSaveCreditNote creates a credit note pending approval or, when the record
+// already exists, a second official approves / rejects it. Approved credit notes post
+// credit transactions
+func BeforeSaveCreditNote(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.CreditNote)
+
+	if len(oid) == 0 || oid == "new" {
+		if err := createCreditNote(tx, ses, siteID, record); err != nil {
+			return true, err
+		}
+
+		resp.Set("id", record.ID)
+		return true, nil
+	}
+
+	if err := reviewCreditNote(tx, ses, siteID, oid, record.Status); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// BeforeListCreditNote ...
+func BeforeListCreditNote(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrID := ses.String("admin_id")
+	usrType := ses.Int("admin_type")
+	usrSubType := ses.Int("admin_subtype")
+
+	// if this user is a secondary resident
+	if usrType == model.ResidentUser && usrSubType == 1 {
+		res := model.Resident{}
+		err := dbc.Model(&res).Where("id = ?", usrID).Select()
+		if err != nil {
+			log.Debug(err)
+			return false, err
+		}
+
+		(*filter)["resident_id"] = res.PrimaryID
+	} else if usrType == model.ResidentUser {
+		(*filter)["resident_id"] = usrID
+	}
+
+	return false, nil
+}
+
+// DeleteCreditNote only pending credit notes can be deleted, approved ones are part of
+// the residents account history
+func DeleteCreditNote(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	record := model.CreditNote{}
+	err = tx.Model(&record).
+		Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	if record.Status == model.CreditNoteApproved {
+		err := errors.New("approved credit notes cannot be deleted")
+		return true, err
+	}
+
+	return false, nil
+}
+
+func createCreditNote(tx *pg.Tx, ses *et.SessionMgr, siteID string, record *model.CreditNote) error {
+	log := utils.Env.Log
+
+	count, err := tx.Model((*model.Resident)(nil)).
+		Join("left join residency as rs on rs.id = resident.residency_id").
+		Where("resident.id = ? and resident.type = ? and rs.site_id = ?", record.ResidentID, model.PrimaryResident, siteID).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+	if count == 0 {
+		return errors.New("unknown resident")
+	}
+
+	// dues that can be credited, an invoice limits the credit to what is still owed on
+	// the invoiced dues otherwise the residents outstanding dues are used
+	creditable, err := creditableDues(tx, siteID, record.ResidentID, record.InvoiceID, "")
+	if err != nil {
+		return err
+	}
+
+	dues := []InvDue{}
+	if len(record.Dues) > 0 {
+		if err := json.Unmarshal(record.Dues, &dues); err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	// a plain amount with no dues funds the residents wallet
+	if record.Percentage.Sign() == 0 && len(dues) == 0 && record.Amount.Sign() <= 0 {
+		return errors.New("dues, a percentage or an amount must be provided")
+	}
+
+	if record.Percentage.GreaterThan(decimal.Zero) {
+		if record.Percentage.GreaterThan(decimal.New(100, 0)) {
+			return errors.New("percentage cannot be greater than 100")
+		}
+
+		pct := record.Percentage.Div(decimal.New(100, 0))
+		dues = []InvDue{}
+		for _, d := range creditable {
+			dues = append(dues, InvDue{DueID: d.DueID, Name: d.Name, Amount: d.Amount.Mul(pct).Round(2)})
+		}
+	}
+
+	total, err := checkCreditLimit(creditable, dues)
+	if err != nil {
+		return err
+	}
+
+	if len(dues) == 0 {
+		total = record.Amount
+	}
+
+	if total.Equal(decimal.Zero) {
+		return errors.New("nothing to credit")
+	}
+
+	if record.Type == 0 {
+		record.Type = model.CreditNoteCredit
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.Status = model.CreditNotePending
+	record.Amount = total
+	record.DateCreated = utils.DateTime{}.Now()
+	record.RequestedBy = model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+	record.Dues, err = json.Marshal(dues)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return nil
+}
+
+func reviewCreditNote(tx *pg.Tx, ses *et.SessionMgr, siteID, oid string, status int) error {
+	log := utils.Env.Log
+
+	record := &model.CreditNote{}
+	err := tx.Model(record).
+		Where("id = ? and site_id = ?", oid, siteID).
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if record.Status != model.CreditNotePending {
+		return errors.New("credit note has already been reviewed")
+	}
+
+	if status != model.CreditNoteApproved && status != model.CreditNoteRejected {
+		return errors.New("a credit note can only be approved or rejected")
+	}
+
+	by := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	if by.UserID == record.RequestedBy.UserID {
+		return errors.New("a credit note must be approved by a second official")
+	}
+
+	// the dues may have been paid or credited since the credit note was raised
+	if status == model.CreditNoteApproved {
+		dues := []InvDue{}
+		if err := json.Unmarshal(record.Dues, &dues); err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		if len(dues) > 0 {
+			creditable, err := creditableDues(tx, siteID, record.ResidentID, record.InvoiceID, record.ID)
+			if err != nil {
+				return err
+			}
+			if _, err := checkCreditLimit(creditable, dues); err != nil {
+				return err
+			}
+		}
+	}
+
+	record.Status = status
+	record.DateApproved = utils.DateTime{}.Now()
+	record.ApprovedBy = by
+
+	_, err = tx.Model(record).
+		Column("status", "date_approved", "approved_by").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if status == model.CreditNoteApproved {
+		return postCreditNote(tx, record)
+	}
+
+	return nil
+}
+
+// postCreditNote creates a credit transaction record for each due in the credit note,
+// credit notes with no dues fund the residents wallet
+func postCreditNote(tx *pg.Tx, record *model.CreditNote) error {
+	log := utils.Env.Log
+
+	dues := []InvDue{}
+	if err := json.Unmarshal(record.Dues, &dues); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	j := newJournal(record.SiteID, record.ResidentID, model.JournalCreditNote, record.ID,
+		fmt.Sprintf("Credit note %s", record.Reference), utils.DateTime{}.Now())
+	j.createdBy(record.ApprovedBy)
+
+	if len(dues) == 0 {
+		j.debit(model.LedgerAllowance, strconv.Itoa(record.Type), record.Amount)
+		j.credit(model.LedgerWallet, "", record.Amount)
+		if err := j.post(tx); err != nil {
+			return err
+		}
+
+		trx := &model.Transaction{
+			ID:           xid.New().String(),
+			SiteID:       record.SiteID,
+			ResidentID:   record.ResidentID,
+			Type:         model.TrxCreditNote,
+			DateTrx:      utils.DateTime{}.Now(),
+			CreditNoteID: record.ID,
+			Amount:       record.Amount,
+		}
+		if _, err := tx.Model(trx).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		_, err := moveWallet(tx, record.SiteID, record.ResidentID, &model.WalletMovement{
+			Type:         model.WalletFunded,
+			Amount:       record.Amount,
+			CreditNoteID: record.ID,
+			Narration:    fmt.Sprintf("Credit note %s", record.Reference),
+			CreatedBy:    record.ApprovedBy,
+		})
+		return err
+	}
+
+	for _, d := range dues {
+		trx := &model.Transaction{
+			ID:           xid.New().String(),
+			SiteID:       record.SiteID,
+			ResidentID:   record.ResidentID,
+			Type:         model.TrxCreditNote,
+			DateTrx:      utils.DateTime{}.Now(),
+			InvoiceID:    record.InvoiceID,
+			CreditNoteID: record.ID,
+			DueID:        d.DueID,
+			Amount:       d.Amount,
+		}
+		if _, err := tx.Model(trx).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		j.debit(model.LedgerAllowance, strconv.Itoa(record.Type), d.Amount)
+		j.credit(model.LedgerReceivable, d.DueID, d.Amount)
+	}
+
+	return j.post(tx)
+}
+
+// creditableDues returns the dues (and amounts) a credit note can be raised against, net
+// of payments, approved credit notes and the pending credit notes other than excludeID.
+// The residents invoices are locked so concurrent credit notes see the same limit
+func creditableDues(tx *pg.Tx, siteID, residentID, invoiceID, excludeID string) ([]InvDue, error) {
+	log := utils.Env.Log
+	dues := []InvDue{}
+
+	if err := lockInvoices(tx, residentID); err != nil {
+		return nil, err
+	}
+
+	if len(invoiceID) > 0 {
+		inv := model.Invoice{}
+		err := tx.Model(&inv).
+			Where("id = ? and site_id = ? and resident_id = ?", invoiceID, siteID, residentID).
+			Select()
+		if err != nil {
+			log.Debug(err)
+			return nil, errors.New("invoice does not belong to this resident")
+		}
+
+		_, err = tx.Query(&dues, `
+			select
+				t.due_id, d.name, sum(t.amount) * -1 as amount
+			from
+				transaction as t
+			left join due as d
+				on d.id = t.due_id
+			where
+				t.invoice_id = ? and t.due_id is not null
+			group by
+				t.due_id, d.name
+			having
+				sum(t.amount) < 0
+		`, invoiceID)
+		if err != nil {
+			log.Debug(err)
+			return nil, err
+		}
+	} else {
+		_, err := tx.Query(&dues, `
+			select
+				due_id, due as name, balance * -1 as amount
+			from
+				resident_due_status
+			where
+				id = ? and site_id = ? and balance < 0
+		`, residentID, siteID)
+		if err != nil {
+			log.Debug(err)
+			return nil, err
+		}
+	}
+
+	pending := []model.CreditNote{}
+	q := tx.Model(&pending).
+		Where("site_id = ? and resident_id = ? and status = ? and id <> ?", siteID, residentID, model.CreditNotePending, excludeID)
+	if len(invoiceID) > 0 {
+		q = q.Where("invoice_id = ?", invoiceID)
+	}
+	if err := q.Select(); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	held := []InvDue{}
+	for _, p := range pending {
+		list := []InvDue{}
+		if len(p.Dues) > 0 {
+			if err := json.Unmarshal(p.Dues, &list); err != nil {
+				log.Debug(err)
+				return nil, err
+			}
+		}
+		held = append(held, list...)
+	}
+
+	return deductDues(dues, held), nil
+}
+
+// deductDues takes the amounts held by other credit notes off the creditable dues
+func deductDues(creditable, held []InvDue) []InvDue {
+	list := []InvDue{}
+	for _, c := range creditable {
+		for _, h := range held {
+			if h.DueID == c.DueID {
+				c.Amount = c.Amount.Sub(h.Amount)
+			}
+		}
+
+		if c.Amount.Sign() > 0 {
+			list = append(list, c)
+		}
+	}
+
+	return list
+}
+
+// checkCreditLimit every due credited must be creditable and within its limit, a due
+// listed more than once is held to the limit in total. It names the dues and returns the
+// total credited
+func checkCreditLimit(creditable, dues []InvDue) (decimal.Decimal, error) {
+	total := decimal.Zero
+	credited := []InvDue{}
+	for i, d := range dues {
+		limit, found := findDue(creditable, d.DueID)
+		if !found {
+			return total, fmt.Errorf("due %s has nothing left to credit for this resident", d.DueID)
+		}
+
+		credited = addDue(credited, InvDue{DueID: d.DueID, Amount: d.Amount})
+		sum, _ := findDue(credited, d.DueID)
+		if d.Amount.LessThanOrEqual(decimal.Zero) || sum.Amount.GreaterThan(limit.Amount) {
+			return total, fmt.Errorf("invalid credit amount for %s", limit.Name)
+		}
+
+		dues[i].Name = limit.Name
+		total = total.Add(d.Amount)
+	}
+
+	return total, nil
+}
+
+func findDue(list []InvDue, id string) (InvDue, bool) {
+	for _, i := range list {
+		if i.DueID == id {
+			return i, true
+		}
+	}
+
+	return InvDue{}, false
+}
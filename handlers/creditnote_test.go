@@ -0,0 +1,88 @@
+package handlers
+
+import "testing"
+
+func TestDeductDues(t *testing.T) {
+	creditable := []InvDue{
+		{DueID: "levy", Name: "Levy", Amount: amount("100")},
+		{DueID: "water", Name: "Water", Amount: amount("50")},
+	}
+
+	tests := []struct {
+		name string
+		held []InvDue
+		want []InvDue
+	}{
+		{"nothing held", nil, creditable},
+		{"part held", []InvDue{{DueID: "levy", Amount: amount("30")}}, []InvDue{
+			{DueID: "levy", Amount: amount("70")},
+			{DueID: "water", Amount: amount("50")},
+		}},
+		{"held by several notes", []InvDue{{DueID: "levy", Amount: amount("30")}, {DueID: "levy", Amount: amount("20")}}, []InvDue{
+			{DueID: "levy", Amount: amount("50")},
+			{DueID: "water", Amount: amount("50")},
+		}},
+		{"fully held dues are dropped", []InvDue{{DueID: "water", Amount: amount("50")}}, []InvDue{
+			{DueID: "levy", Amount: amount("100")},
+		}},
+		{"other dues are ignored", []InvDue{{DueID: "power", Amount: amount("10")}}, creditable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deductDues(creditable, tt.held)
+			if len(got) != len(tt.want) {
+				t.Fatalf("deductDues() = %+v, want %+v", got, tt.want)
+			}
+			for k := range tt.want {
+				if got[k].DueID != tt.want[k].DueID || !got[k].Amount.Equal(tt.want[k].Amount) {
+					t.Errorf("due %d = %+v, want %+v", k, got[k], tt.want[k])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCreditLimit(t *testing.T) {
+	creditable := []InvDue{
+		{DueID: "levy", Name: "Levy", Amount: amount("100")},
+		{DueID: "water", Name: "Water", Amount: amount("50")},
+	}
+
+	tests := []struct {
+		name  string
+		dues  []InvDue
+		total string
+		ok    bool
+	}{
+		{"within the limits", []InvDue{{DueID: "levy", Amount: amount("40")}, {DueID: "water", Amount: amount("10.50")}}, "50.50", true},
+		{"the whole limit", []InvDue{{DueID: "levy", Amount: amount("100")}}, "100", true},
+		{"over the limit", []InvDue{{DueID: "water", Amount: amount("50.01")}}, "", false},
+		{"repeated due over the limit", []InvDue{{DueID: "levy", Amount: amount("60")}, {DueID: "levy", Amount: amount("60")}}, "", false},
+		{"repeated due within the limit", []InvDue{{DueID: "levy", Amount: amount("60")}, {DueID: "levy", Amount: amount("40")}}, "100", true},
+		{"nothing to credit", []InvDue{{DueID: "power", Amount: amount("10")}}, "", false},
+		{"zero amount", []InvDue{{DueID: "levy", Amount: amount("0")}}, "", false},
+		{"negative amount", []InvDue{{DueID: "levy", Amount: amount("-5")}}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, err := checkCreditLimit(creditable, tt.dues)
+			if (err == nil) != tt.ok {
+				t.Fatalf("checkCreditLimit() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			if !total.Equal(amount(tt.total)) {
+				t.Errorf("total = %s, want %s", total, tt.total)
+			}
+			for _, d := range tt.dues {
+				if limit, _ := findDue(creditable, d.DueID); d.Name != limit.Name {
+					t.Errorf("due %s is named %q, want %q", d.DueID, d.Name, limit.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"eve/service/model"
+	"eve/shared"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+)
+
+// RunDunning runs the dunning policy of the site now instead of waiting for its hour
+func (s *Controller) RunDunning(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	policy := model.DunningPolicy{}
+	err = dbc.Model(&policy).Where("site_id = ?", getSiteID(c)).Select()
+	if err == pg.ErrNoRows {
+		return et.APIError(c, fmt.Errorf("the site has no dunning policy"), http.StatusNotFound)
+	}
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	sent, err := shared.RunDunningPolicy(policy.ID)
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	response.Set("notified", sent)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// BeforeSaveDunningPolicy a site has one dunning policy, its stages must be in order of
+// days overdue
+func BeforeSaveDunningPolicy(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.DunningPolicy)
+
+	if err := validateDunningPolicy(record); err != nil {
+		return true, err
+	}
+
+	if len(oid) > 0 && oid != "new" {
+		_, err := tx.Model(record).
+			Column("name", "active", "min_balance", "run_hour", "stages").
+			Where("id = ? and site_id = ?", oid, siteID).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	count, err := tx.Model((*model.DunningPolicy)(nil)).Where("site_id = ?", siteID).Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, errors.New("the site already has a dunning policy")
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+func validateDunningPolicy(record *model.DunningPolicy) error {
+	if record.RunHour < 0 || record.RunHour > 23 {
+		return errors.New("run hour must be between 0 and 23")
+	}
+
+	if record.MinBalance.Sign() < 0 {
+		return errors.New("minimum balance cannot be negative")
+	}
+
+	stages := []model.DunningStage{}
+	if len(record.Stages) > 0 {
+		if err := json.Unmarshal(record.Stages, &stages); err != nil {
+			return errors.New("invalid stages")
+		}
+	}
+
+	if len(stages) == 0 {
+		return errors.New("a dunning policy needs at least one stage")
+	}
+
+	last := 0
+	for i, s := range stages {
+		if len(s.Name) == 0 {
+			return fmt.Errorf("stage %d needs a name", i+1)
+		}
+		if s.Days <= last {
+			return fmt.Errorf("stage %s must start after %d days overdue", s.Name, last)
+		}
+		if !s.Email && !s.Push && !s.RestrictGatePass && !s.FlagAtGate {
+			return fmt.Errorf("stage %s does nothing", s.Name)
+		}
+		last = s.Days
+	}
+
+	return nil
+}
+
+// BeforeSaveResidentDunning the dunning stage of residents is only set by the dunning run
+func BeforeSaveResidentDunning(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	return true, errors.New("dunning stages are updated by the dunning run")
+}
+
+// BeforeListDunningHistory residents only see their own history
+func BeforeListDunningHistory(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrID := ses.String("admin_id")
+	usrType := ses.Int("admin_type")
+	usrSubType := ses.Int("admin_subtype")
+
+	// if this user is a secondary resident
+	if usrType == model.ResidentUser && usrSubType == 1 {
+		res := model.Resident{}
+		err := dbc.Model(&res).Where("id = ?", usrID).Select()
+		if err != nil {
+			log.Debug(err)
+			return false, err
+		}
+
+		(*filter)["resident_id"] = res.PrimaryID
+	} else if usrType == model.ResidentUser {
+		(*filter)["resident_id"] = usrID
+	}
+
+	return false, nil
+}
+
+// residentDunning returns the dunning stage of the primary resident of a resident, nil
+// when the account is not being chased
+func residentDunning(db *pg.DB, res model.Resident) (*model.ResidentDunning, error) {
+	primaryID := res.ID
+	if res.Type == model.SecondaryResident && len(res.PrimaryID) > 0 {
+		primaryID = res.PrimaryID
+	}
+
+	state := &model.ResidentDunning{}
+	err := db.Model(state).Where("resident_id = ?", primaryID).Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return nil, err
+	}
+
+	return state, nil
+}
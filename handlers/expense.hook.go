@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// BeforeSaveExpense records a new expense for approval, updates a pending expense or,
+// when the status is set, approves / rejects it. Approved expenses are posted to the ledger
+func BeforeSaveExpense(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.Expense)
+
+	if len(oid) > 0 && oid != "new" {
+		current := &model.Expense{}
+		err := tx.Model(current).
+			Where("id = ? and site_id = ?", oid, siteID).
+			For("update").
+			Select()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		if current.Status != model.ExpensePending {
+			return true, errors.New("expense has already been reviewed")
+		}
+
+		if record.Status != model.ExpensePending {
+			return true, reviewExpense(tx, ses, current, record.Status)
+		}
+
+		record.ID = current.ID
+		if err := checkExpense(tx, siteID, record); err != nil {
+			return true, err
+		}
+
+		_, err = tx.Model(record).
+			Column("category_id", "vendor_id", "due_id", "date_trx", "amount", "description",
+				"reference", "pay_mode", "receipts").
+			WherePK().
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	if err := checkExpense(tx, siteID, record); err != nil {
+		return true, err
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.Status = model.ExpensePending
+	record.DateCreated = utils.DateTime{}.Now()
+	record.RequestedBy = model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+// DeleteExpense only pending expenses can be deleted, their receipts are removed
+func DeleteExpense(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	record := model.Expense{}
+	err = tx.Model(&record).
+		Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	if record.Status == model.ExpenseApproved {
+		return true, errors.New("approved expenses cannot be deleted")
+	}
+
+	receipts := []struct {
+		Receipt json.RawMessage `json:"receipt"`
+	}{}
+	if err := json.Unmarshal(record.Receipts, &receipts); err == nil {
+		for _, r := range receipts {
+			if err := utils.DeleteImageData(utils.Env.Cfg, r.Receipt); err != nil {
+				log.Debug(err)
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// checkExpense validates an expense and stores new receipts (data uris) as files
+func checkExpense(tx *pg.Tx, siteID string, record *model.Expense) error {
+	log := utils.Env.Log
+
+	if record.Amount.Sign() <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if record.DateTrx.IsZero() {
+		record.DateTrx = utils.DateTime{}.Now()
+	}
+
+	category := model.ExpenseCategory{}
+	err := tx.Model(&category).
+		Where("id = ? and site_id = ?", record.CategoryID, siteID).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return errors.New("unknown expense category")
+	}
+
+	if len(record.VendorID) > 0 {
+		count, err := tx.Model((*model.Vendor)(nil)).
+			Where("id = ? and site_id = ?", record.VendorID, siteID).
+			Count()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+		if count == 0 {
+			return errors.New("unknown vendor")
+		}
+	}
+
+	// expenses are budgeted against the due that funds their category
+	if len(record.DueID) == 0 {
+		record.DueID = category.DueID
+	}
+
+	if len(record.Receipts) == 0 {
+		record.Receipts = json.RawMessage("[]")
+	}
+
+	return utils.SaveJSONImageData(utils.Env.Cfg, "receipt", &record.Receipts)
+}
+
+func reviewExpense(tx *pg.Tx, ses *et.SessionMgr, record *model.Expense, status int) error {
+	log := utils.Env.Log
+
+	if status != model.ExpenseApproved && status != model.ExpenseRejected {
+		return errors.New("an expense can only be approved or rejected")
+	}
+
+	record.Status = status
+	record.DateApproved = utils.DateTime{}.Now()
+	record.ApprovedBy = model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	_, err := tx.Model(record).
+		Column("status", "date_approved", "approved_by").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if status != model.ExpenseApproved {
+		return nil
+	}
+
+	narration := record.Description
+	if len(narration) == 0 {
+		narration = "Expense"
+	}
+
+	j := newJournal(record.SiteID, "", model.JournalExpense, record.ID, narration, record.DateTrx)
+	j.createdBy(record.ApprovedBy)
+	j.debit(model.LedgerExpense, record.CategoryID, record.Amount)
+	j.credit(model.LedgerBank, strconv.Itoa(record.PayMode), record.Amount)
+
+	return j.post(tx)
+}
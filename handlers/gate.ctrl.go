@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// GateAPI is used by security at the gate
+type GateAPI struct {
+	log  *zap.SugaredLogger
+	env  *et.Env
+	Path string
+
+	AcsMgr *et.AccessMgr
+}
+
+// GateVerifyRequest direction is "in", "out" or empty to take the next step of the pass
+type GateVerifyRequest struct {
+	Token     string `json:"token"`
+	Direction string `json:"direction"`
+	Gate      string `json:"gate"`
+}
+
+// GateResident is shown to the guard
+type GateResident struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Phone  string `json:"phone"`
+	Type   int    `json:"type"`
+	Status int    `json:"status"`
+	Active bool   `json:"active"`
+	Unit   string `json:"unit"`
+	Street string `json:"street"`
+}
+
+// gateRejection is a scan that was refused, it is logged with the reason
+type gateRejection struct {
+	status int
+	reason string
+}
+
+func (s *gateRejection) Error() string { return s.reason }
+
+func rejectPass(status int, format string, a ...interface{}) error {
+	return &gateRejection{status: status, reason: fmt.Sprintf(format, a...)}
+}
+
+// Initialize ...
+func (s *GateAPI) Initialize(env *et.Env) error {
+	s.env = env
+	s.log = env.Log.Sugar()
+
+	s.AcsMgr = et.NewAccessMgr()
+	s.AcsMgr.AddRules([]et.AccessRule{
+		{Path: s.Path, Role: et.RoleEveryone, Permission: et.PermissionReadWrite},
+	})
+
+	acOpts := et.AccessControllerOptions{
+		RoleField:   "admin_role",
+		SiteIDField: "admin_site_id",
+	}
+
+	grp := env.Rtr.Group(s.Path, et.AccessController(s.AcsMgr, s.log, acOpts))
+	grp.POST("/verify", s.Verify)
+	grp.GET("/qr/:id", s.QRCode)
+	grp.GET("/key", s.Key)
+	grp.GET("/plate/:plate", s.LookupPlate)
+	grp.POST("/plate", s.LogPlate)
+	grp.GET("/shift", s.CurrentShift)
+	grp.POST("/shift/clockin", s.ClockIn)
+	grp.POST("/shift/clockout", s.ClockOut)
+	grp.POST("/patrol/scan", s.ScanCheckpoint)
+
+	return nil
+}
+
+// Verify checks a gate pass token and records the check in or check out. A pass moves
+// unused -> checked in -> checked out, scanning it again for the same step is refused
+func (s *GateAPI) Verify(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType != model.SecurityUser && usrType < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	form := GateVerifyRequest{}
+	if err := c.Bind(&form); err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	siteID := getSiteID(c)
+
+	// a scanned QR code carries the token in its signed claims
+	var claims *GatePassClaims
+	if strings.HasPrefix(strings.TrimSpace(form.Token), gatePassQRPrefix) {
+		claims, err = parseGatePassQR(strings.TrimSpace(form.Token), siteID)
+		if err != nil {
+			return et.APIError(c, err, http.StatusBadRequest)
+		}
+		form.Token = claims.Token
+	}
+
+	form.Token = normalizeToken(form.Token)
+	if len(form.Token) == 0 {
+		return et.APIError(c, errors.New("token is required"), http.StatusBadRequest)
+	}
+
+	scan := &model.GatePassLog{
+		ID:          xid.New().String(),
+		SiteID:      siteID,
+		Token:       form.Token,
+		SecurityID:  ses.String("admin_id"),
+		Gate:        form.Gate,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+
+	pass := &model.GatePass{}
+	resident := GateResident{}
+	flagged := false
+	matches := []WatchlistMatch{}
+
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) error {
+		err := tx.Model(pass).
+			Where("token = ?", form.Token).
+			OrderExpr("site_id = ? desc", siteID).
+			Limit(1).
+			For("update").
+			Select()
+		if err == pg.ErrNoRows {
+			return rejectPass(http.StatusNotFound, "unknown gate pass")
+		}
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		scan.GatePassID = pass.ID
+		scan.ResidentID = pass.ResidentID
+
+		if pass.SiteID != siteID {
+			scan.GatePassID = ""
+			return rejectPass(http.StatusForbidden, "gate pass belongs to another site")
+		}
+
+		if claims != nil && claims.PassID != pass.ID {
+			return rejectPass(http.StatusForbidden, "gate pass signature mismatch")
+		}
+
+		resident, err = gateResident(tx, pass.ResidentID)
+		if err != nil {
+			return err
+		}
+
+		if err := checkPass(pass, resident); err != nil {
+			return err
+		}
+
+		if scan.Action, err = nextGateAction(pass, form.Direction); err != nil {
+			return err
+		}
+
+		if scan.Action == model.GateCheckIn || pass.Type == model.GatePassExit {
+			if err := checkWindow(pass, time.Now()); err != nil {
+				return err
+			}
+		}
+
+		// visitors coming in are checked against the watchlist
+		if scan.Action == model.GateCheckIn {
+			visitor := struct {
+				Visitor     string `json:"visitor"`
+				Phone       string `json:"phone"`
+				PlateNumber string `json:"plate_number"`
+			}{}
+			if len(pass.Attr) > 0 {
+				json.Unmarshal(pass.Attr, &visitor)
+			}
+			if len(pass.PlateNumber) > 0 {
+				visitor.PlateNumber = pass.PlateNumber
+			}
+
+			if matches, err = matchWatchlist(tx, siteID, visitor.Visitor, visitor.Phone, visitor.PlateNumber); err != nil {
+				return err
+			}
+			if deny := watchlistDenial(matches); deny != nil {
+				return rejectPass(http.StatusForbidden, "visitor is on the watchlist: %s", deny.Reason)
+			}
+		}
+
+		if err := movePass(tx, pass, scan); err != nil {
+			return err
+		}
+
+		if _, err := tx.Model(scan).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		if err := logPassVehicle(tx, pass, scan); err != nil {
+			return err
+		}
+
+		state := model.ResidentDunning{}
+		err = tx.Model(&state).
+			Where("resident_id = (select case when r.type = ? and r.primary_id <> '' then r.primary_id else r.id end from resident as r where r.id = ?)",
+				model.SecondaryResident, pass.ResidentID).
+			Select()
+		if err != nil && err != pg.ErrNoRows {
+			log.Debug(err)
+			return err
+		}
+		flagged = state.FlagAtGate
+
+		return nil
+	})
+
+	if len(matches) > 0 {
+		recordWatchlistHits(siteID, "gate_pass", pass.ID, scan.SecurityID, matches)
+	}
+
+	if rejected, ok := err.(*gateRejection); ok {
+		scan.Action = model.GateRejected
+		scan.Reason = rejected.reason
+		if _, err := dbc.Model(scan).Insert(); err != nil {
+			log.Error(err)
+		}
+
+		return et.APIError(c, rejected, rejected.status)
+	}
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	response.Set("action", scan.Action)
+	response.Set("pass", pass)
+	response.Set("resident", resident)
+	response.Set("flagged", flagged)
+	response.Set("watchlist", matches)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// QRCode returns the QR code of a pass as a png or, with ?format=svg, an svg image.
+// Residents can only get the codes of their own residency
+func (s *GateAPI) QRCode(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	pass := &model.GatePass{}
+	err = dbc.Model(pass).
+		Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).
+		Select()
+	if err == pg.ErrNoRows {
+		return et.APIError(c, errors.New("unknown gate pass"), http.StatusNotFound)
+	}
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	if ses.Int("admin_type") == model.ResidentUser {
+		count, err := dbc.Model((*model.Resident)(nil)).
+			Where("id = ? and residency_id = (select residency_id from resident where id = ?)", pass.ResidentID, ses.String("admin_id")).
+			Count()
+		if err != nil {
+			log.Debug(err)
+			return et.APIError(c, err, http.StatusInternalServerError)
+		}
+		if count == 0 {
+			return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+		}
+	}
+
+	payload, err := signGatePass(pass)
+	if err != nil {
+		return et.APIError(c, err, http.StatusServiceUnavailable)
+	}
+
+	size, _ := strconv.Atoi(c.QueryParam("size"))
+	img, contentType, err := renderQR(payload, c.QueryParam("format"), size)
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.Blob(http.StatusOK, contentType, img)
+}
+
+// Key returns the public key of the site so guard apps can check QR codes offline, the
+// private key never leaves the server
+func (s *GateAPI) Key(c echo.Context) error {
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType != model.SecurityUser && usrType < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	siteID := getSiteID(c)
+	key, err := siteGateKey(siteID)
+	if err != nil {
+		return et.APIError(c, err, http.StatusServiceUnavailable)
+	}
+
+	response.Set("site_id", siteID)
+	response.Set("prefix", gatePassQRPrefix)
+	response.Set("algorithm", "EdDSA")
+	response.Set("key", base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// normalizeToken accepts tokens with or without dashes and in any case
+func normalizeToken(token string) string {
+	token = strings.ToUpper(strings.TrimSpace(token))
+	token = strings.Replace(token, " ", "", -1)
+
+	plain := strings.Replace(token, "-", "", -1)
+	if len(plain) == 12 {
+		return dashed(plain)
+	}
+
+	return token
+}
+
+func gateResident(tx *pg.Tx, residentID string) (GateResident, error) {
+	resident := GateResident{}
+	_, err := tx.QueryOne(&resident, `
+		select
+			r.id, concat(r.first_name, ' ', r.last_name) as name, r.phone, r.type, r.status,
+			coalesce(rs.active_status, 0) = 1 as active, u.label as unit, st.name as street
+		from
+			resident as r
+		left join residency as rs
+			on rs.id = r.residency_id
+		left join unit as u
+			on u.id = rs.unit_id
+		left join street as st
+			on st.id = u.street_id
+		where
+			r.id = ?
+	`, residentID)
+	if err == pg.ErrNoRows {
+		return resident, rejectPass(http.StatusConflict, "gate pass has no resident")
+	}
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return resident, err
+	}
+
+	return resident, nil
+}
+
+// checkPass refuses passes that expired, were revoked or whose resident can no longer
+// issue them
+func checkPass(pass *model.GatePass, resident GateResident) error {
+	if resident.Status == int(model.IsDisabled) {
+		return rejectPass(http.StatusConflict, "resident is disabled")
+	}
+
+	if !resident.Active {
+		return rejectPass(http.StatusConflict, "resident no longer lives on the site")
+	}
+
+	if pass.Status == model.GatePassExpired {
+		return rejectPass(http.StatusGone, "gate pass has expired")
+	}
+
+	if pass.Status == model.GatePassUsed {
+		return rejectPass(http.StatusConflict, "gate pass has already been used")
+	}
+
+	if pass.Status == model.GatePassRevoked {
+		return rejectPass(http.StatusGone, "gate pass has been revoked")
+	}
+
+	if pass.Status == model.GatePassUnused && time.Now().After(gatePassExpiry(pass)) {
+		return rejectPass(http.StatusGone, "gate pass has expired")
+	}
+
+	return nil
+}
+
+// nextGateAction works out the check in / check out a scan performs
+func nextGateAction(pass *model.GatePass, direction string) (int, error) {
+	entry := pass.Type != model.GatePassExit
+	exit := pass.Type != model.GatePassEntry
+	remaining := pass.Uses < maxUses(pass)
+
+	switch direction {
+	case "":
+		if pass.Status == model.GatePassCheckedIn || !entry {
+			direction = "out"
+		} else {
+			direction = "in"
+		}
+	case "in", "out":
+	default:
+		return 0, errors.New("direction must be in or out")
+	}
+
+	if direction == "in" {
+		switch {
+		case !entry:
+			return 0, rejectPass(http.StatusConflict, "gate pass is for exit only")
+		case pass.Status == model.GatePassCheckedIn:
+			return 0, rejectPass(http.StatusConflict, "gate pass is already checked in")
+		case !remaining:
+			return 0, rejectPass(http.StatusConflict, "gate pass has already been used")
+		}
+
+		return model.GateCheckIn, nil
+	}
+
+	switch {
+	case !exit:
+		return 0, rejectPass(http.StatusConflict, "gate pass is for entry only")
+	case entry && pass.Status != model.GatePassCheckedIn:
+		return 0, rejectPass(http.StatusConflict, "gate pass has not been checked in")
+	case !entry && !remaining:
+		return 0, rejectPass(http.StatusConflict, "gate pass has already been used")
+	}
+
+	return model.GateCheckOut, nil
+}
+
+// movePass records the scan on the pass, passes are used up once every use is spent
+func movePass(tx *pg.Tx, pass *model.GatePass, scan *model.GatePassLog) error {
+	entry := pass.Type != model.GatePassExit
+	exit := pass.Type != model.GatePassEntry
+
+	if scan.Action == model.GateCheckIn {
+		pass.Uses++
+		pass.Status = model.GatePassCheckedIn
+		pass.DateCheckin = scan.DateCreated
+		pass.CheckinBy = scan.SecurityID
+		if !exit && pass.Uses >= maxUses(pass) {
+			pass.Status = model.GatePassUsed
+		}
+	} else {
+		if !entry {
+			pass.Uses++
+		}
+		pass.Status = model.GatePassCheckedOut
+		pass.DateCheckout = scan.DateCreated
+		pass.CheckoutBy = scan.SecurityID
+		if pass.Uses >= maxUses(pass) {
+			pass.Status = model.GatePassUsed
+		}
+	}
+
+	_, err := tx.Model(pass).
+		Column("status", "uses", "date_checkin", "checkin_by", "date_checkout", "checkout_by").
+		WherePK().
+		Update()
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return err
+	}
+
+	return nil
+}
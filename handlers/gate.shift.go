@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"eve/service/model"
+	"eve/shared"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// guards can clock in this long before their shift starts
+const clockInEarly = "30 minutes"
+
+// PatrolScanRequest code is read from the checkpoint
+type PatrolScanRequest struct {
+	Code string `json:"code"`
+	Note string `json:"note"`
+}
+
+// CurrentShift returns the shift the guard is on, or the next one scheduled
+func (s *GateAPI) CurrentShift(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	if ses.Int("admin_type") != model.SecurityUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	guardID := ses.String("admin_id")
+
+	shift, err := guardOnDuty(dbc, guardID)
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	if shift != nil {
+		scans, err := dbc.Model((*model.PatrolScan)(nil)).Where("shift_id = ?", shift.ID).Count()
+		if err != nil {
+			log.Debug(err)
+			return et.APIError(c, err, http.StatusInternalServerError)
+		}
+
+		response.Set("on_duty", true)
+		response.Set("shift", shift)
+		response.Set("scans", scans)
+	} else {
+		next := &model.GuardShift{}
+		err := dbc.Model(next).
+			Where("guard_id = ? and status = ? and date_end > localtimestamp", guardID, model.ShiftScheduled).
+			Order("date_start").
+			Limit(1).
+			Select()
+		if err != nil && err != pg.ErrNoRows {
+			log.Debug(err)
+			return et.APIError(c, err, http.StatusInternalServerError)
+		}
+
+		response.Set("on_duty", false)
+		if err == nil {
+			response.Set("next", next)
+		}
+	}
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// ClockIn starts the scheduled shift of the guard, from 30 minutes before it starts until
+// it ends
+func (s *GateAPI) ClockIn(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	if ses.Int("admin_type") != model.SecurityUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	guardID := ses.String("admin_id")
+	shift := &model.GuardShift{}
+
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) error {
+		current, err := guardOnDuty(tx, guardID)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			return errors.New("you are already clocked in")
+		}
+
+		err = tx.Model(shift).
+			Where("guard_id = ? and site_id = ? and status = ?", guardID, getSiteID(c), model.ShiftScheduled).
+			Where("localtimestamp between date_start - interval '" + clockInEarly + "' and date_end").
+			Order("date_start").
+			Limit(1).
+			For("update").
+			Select()
+		if err == pg.ErrNoRows {
+			return errors.New("you have no shift scheduled now")
+		}
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		shift.Status = model.ShiftOnDuty
+		shift.ClockIn = utils.DateTime{}.Now()
+		_, err = tx.Model(shift).
+			Column("status", "clock_in").
+			WherePK().
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	shared.Publish(shift.SiteID, "shift.clockin", shift, shared.RoleChannel(model.OfficialUser))
+
+	response.Set("shift", shift)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// ClockOut ends the shift the guard is on
+func (s *GateAPI) ClockOut(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	if ses.Int("admin_type") != model.SecurityUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	guardID := ses.String("admin_id")
+
+	// clock out of the open shift even when it is past its grace period
+	shift := &model.GuardShift{}
+	err = dbc.Model(shift).
+		Where("guard_id = ? and site_id = ? and status = ? and clock_out is null", guardID, getSiteID(c), model.ShiftOnDuty).
+		Order("clock_in desc").
+		Limit(1).
+		Select()
+	if err == pg.ErrNoRows {
+		return et.APIError(c, errors.New("you are not clocked in"), http.StatusBadRequest)
+	}
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	shift.Status = model.ShiftCompleted
+	shift.ClockOut = utils.DateTime{}.Now()
+	_, err = dbc.Model(shift).
+		Column("status", "clock_out").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	shared.Publish(shift.SiteID, "shift.clockout", shift, shared.RoleChannel(model.OfficialUser))
+
+	response.Set("shift", shift)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// ScanCheckpoint records a guard on shift passing a patrol checkpoint
+func (s *GateAPI) ScanCheckpoint(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	if ses.Int("admin_type") != model.SecurityUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	form := PatrolScanRequest{}
+	if err := c.Bind(&form); err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	siteID := getSiteID(c)
+	guardID := ses.String("admin_id")
+
+	shift, err := guardOnDuty(dbc, guardID)
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+	if shift == nil {
+		return et.APIError(c, errors.New("clock in before patrolling"), http.StatusBadRequest)
+	}
+
+	checkpoint := &model.PatrolCheckpoint{}
+	err = dbc.Model(checkpoint).
+		Where("site_id = ? and code = ? and active", siteID, strings.ToUpper(strings.TrimSpace(form.Code))).
+		Select()
+	if err == pg.ErrNoRows {
+		return et.APIError(c, errors.New("unknown checkpoint"), http.StatusNotFound)
+	}
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	scan := &model.PatrolScan{
+		ID:           xid.New().String(),
+		SiteID:       siteID,
+		CheckpointID: checkpoint.ID,
+		ShiftID:      shift.ID,
+		GuardID:      guardID,
+		Note:         strings.TrimSpace(form.Note),
+		DateCreated:  utils.DateTime{}.Now(),
+	}
+	if _, err := dbc.Model(scan).Insert(); err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	shared.Publish(siteID, "patrol.scan", scan, shared.RoleChannel(model.OfficialUser))
+
+	response.Set("id", scan.ID)
+	response.Set("checkpoint", checkpoint)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// guardOnDuty returns the shift a guard is clocked in to, nil when the guard is off duty
+func guardOnDuty(db orm.DB, guardID string) (*model.GuardShift, error) {
+	shift := &model.GuardShift{}
+	err := db.Model(shift).
+		Where("guard_id = ? and status = ? and clock_out is null", guardID, model.ShiftOnDuty).
+		Where("localtimestamp < date_end + interval '" + shared.OnShiftGrace + "'").
+		Order("clock_in desc").
+		Limit(1).
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return nil, err
+	}
+
+	return shift, nil
+}
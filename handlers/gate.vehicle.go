@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"eve/service/model"
+	"eve/service/view"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// PlateLookup tells a guard who a plate belongs to
+type PlateLookup struct {
+	PlateNumber string            `json:"plate_number"`
+	Owner       string            `json:"owner"`
+	Vehicle     *view.VehicleList `json:"vehicle"`
+	Passes      []model.GatePass  `json:"passes"`
+	Watchlist   []WatchlistMatch  `json:"watchlist"`
+}
+
+// PlateLogRequest direction is "in" or "out"
+type PlateLogRequest struct {
+	PlateNumber string `json:"plate_number"`
+	Direction   string `json:"direction"`
+	Gate        string `json:"gate"`
+}
+
+// LookupPlate returns the resident vehicle or the gate passes valid now for a plate
+func (s *GateAPI) LookupPlate(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType != model.SecurityUser && usrType < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	plate := normalizePlate(c.Param("plate"))
+	if len(plate) == 0 {
+		return et.APIError(c, errors.New("plate number is required"), http.StatusBadRequest)
+	}
+
+	lookup, err := lookupPlate(dbc, getSiteID(c), plate)
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	response.Set("lookup", lookup)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// LogPlate records a vehicle entering or leaving the site
+func (s *GateAPI) LogPlate(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType != model.SecurityUser && usrType < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	form := PlateLogRequest{}
+	if err := c.Bind(&form); err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	direction := model.GateCheckIn
+	switch form.Direction {
+	case "in":
+	case "out":
+		direction = model.GateCheckOut
+	default:
+		return et.APIError(c, errors.New("direction must be in or out"), http.StatusBadRequest)
+	}
+
+	siteID := getSiteID(c)
+	plate := normalizePlate(form.PlateNumber)
+	if len(plate) == 0 {
+		return et.APIError(c, errors.New("plate number is required"), http.StatusBadRequest)
+	}
+
+	lookup, err := lookupPlate(dbc, siteID, plate)
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	entry := &model.VehicleLog{
+		ID:          xid.New().String(),
+		SiteID:      siteID,
+		PlateNumber: plate,
+		Owner:       lookup.Owner,
+		Direction:   direction,
+		Gate:        form.Gate,
+		SecurityID:  ses.String("admin_id"),
+		DateCreated: utils.DateTime{}.Now(),
+	}
+	if lookup.Vehicle != nil {
+		entry.VehicleID = lookup.Vehicle.ID
+	}
+	if len(lookup.Passes) > 0 {
+		entry.GatePassID = lookup.Passes[0].ID
+	}
+
+	if _, err := dbc.Model(entry).Insert(); err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	if len(lookup.Watchlist) > 0 && direction == model.GateCheckIn {
+		recordWatchlistHits(siteID, "vehicle_log", entry.ID, entry.SecurityID, lookup.Watchlist)
+	}
+
+	response.Set("id", entry.ID)
+	response.Set("lookup", lookup)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// lookupPlate a plate belongs to a resident when an active residency registered it, to a
+// visitor when a gate pass valid now carries it and otherwise to nobody
+func lookupPlate(db orm.DB, siteID, plate string) (*PlateLookup, error) {
+	log := utils.Env.Log
+
+	lookup := &PlateLookup{PlateNumber: plate, Owner: model.VehicleUnknown, Passes: []model.GatePass{}}
+
+	vehicle := &view.VehicleList{}
+	_, err := db.QueryOne(vehicle, `
+		select v.* from vehicle_list as v
+		join residency as rs
+			on rs.id = v.residency_id
+		where
+			v.site_id = ? and v.plate_number = ? and v.active and rs.active_status = 1
+	`, siteID, plate)
+	if err != nil && err != pg.ErrNoRows {
+		log.Debug(err)
+		return nil, err
+	}
+	if err == nil {
+		lookup.Vehicle = vehicle
+		lookup.Owner = model.VehicleResident
+	}
+
+	passes := []model.GatePass{}
+	_, err = db.Query(&passes, `
+		select * from gate_pass
+		where
+			site_id = ? and status in (?, ?, ?) and
+			regexp_replace(upper(coalesce(nullif(plate_number, ''), attr->>'plate_number', '')), '[^A-Z0-9]', '', 'g') = ?
+		order by
+			date_created desc
+	`, siteID, model.GatePassUnused, model.GatePassCheckedIn, model.GatePassCheckedOut, plate)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, p := range passes {
+		p := p
+		if gatePassLive(&p, now) && !now.Before(gatePassStart(&p)) {
+			lookup.Passes = append(lookup.Passes, p)
+		}
+	}
+	if lookup.Vehicle == nil && len(lookup.Passes) > 0 {
+		lookup.Owner = model.VehicleVisitor
+	}
+
+	if lookup.Watchlist, err = matchWatchlist(db, siteID, "", "", plate); err != nil {
+		return nil, err
+	}
+
+	return lookup, nil
+}
+
+// logPassVehicle records the vehicle of a gate pass scanned at the gate
+func logPassVehicle(tx *pg.Tx, pass *model.GatePass, scan *model.GatePassLog) error {
+	plate := normalizePlate(pass.PlateNumber)
+	if len(plate) == 0 {
+		visitor := struct {
+			PlateNumber string `json:"plate_number"`
+		}{}
+		if len(pass.Attr) > 0 {
+			json.Unmarshal(pass.Attr, &visitor)
+		}
+		plate = normalizePlate(visitor.PlateNumber)
+	}
+	if len(plate) == 0 {
+		return nil
+	}
+
+	entry := &model.VehicleLog{
+		ID:          xid.New().String(),
+		SiteID:      scan.SiteID,
+		PlateNumber: plate,
+		Owner:       model.VehicleVisitor,
+		GatePassID:  pass.ID,
+		Direction:   scan.Action,
+		Gate:        scan.Gate,
+		SecurityID:  scan.SecurityID,
+		DateCreated: scan.DateCreated,
+	}
+	if _, err := tx.Model(entry).Insert(); err != nil {
+		utils.Env.Log.Debug(err)
+		return err
+	}
+
+	return nil
+}
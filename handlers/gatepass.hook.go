@@ -39,11 +39,15 @@ func AfterReadGatePass(c echo.Context, mi *et.ModelInfo, frm interface{}, resp *
 	gp, _ := retv.(*view.GatePassList)
 	record.Resident = gp.Resident
 
-	now := time.Now()
-	if record.Status == 0 &&
-		now.Format("2006-01-02") != record.DateCreated.Format("2006-01-02") {
+	if record.QR, err = signGatePass(record); err != nil {
+		utils.Env.Log.Debug(err)
+		err = nil
+	}
+
+	if (record.Status == model.GatePassUnused || record.Status == model.GatePassCheckedOut) &&
+		!gatePassLive(record, time.Now()) {
 		// expired
-		record.Status = 4
+		record.Status = model.GatePassExpired
 	}
 
 	return nil
@@ -124,6 +128,10 @@ func BeforeSaveGatePass(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfa
 
 	pass := frm.(*model.GatePass)
 
+	if err := validateGatePass(pass); err != nil {
+		return true, err
+	}
+
 	// only residents can create tokens
 	if (len(pass.ID) == 0 || pass.ID == "new") && usrType == 3 {
 
@@ -149,20 +157,91 @@ func BeforeSaveGatePass(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfa
 			return true, dError
 		}
 
+		// the dunning policy of the site can restrict gate passes of debtors
+		dunning, err := residentDunning(dbc, res)
+		if err != nil {
+			return false, err
+		}
+		if dunning != nil && dunning.RestrictGatePass {
+			return true, errors.New("Cannot issue gatepass, the account is overdue")
+		}
+
 		pass.Token, err = gonanoid.Generate("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ", 12)
 		pass.Token = dashed(pass.Token)
 		pass.ResidentID = ses.String("admin_id")
 	}
 
+	// the use of a pass is only changed at the gate
+	if len(pass.ID) > 0 && pass.ID != "new" {
+		current := model.GatePass{}
+		if err := tx.Model(&current).Where("id = ?", pass.ID).Select(); err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		if current.Status == model.GatePassRevoked {
+			return true, errors.New("gate pass has been revoked")
+		}
+
+		// setting the status to revoked is the only change of status allowed
+		revoke := pass.Status == model.GatePassRevoked
+		if revoke && usrType == model.ResidentUser {
+			count, err := tx.Model((*model.Resident)(nil)).
+				Where("id = ? and residency_id = (select residency_id from resident where id = ?)", current.ResidentID, ses.String("admin_id")).
+				Count()
+			if err != nil {
+				log.Debug(err)
+				return true, err
+			}
+			if count == 0 {
+				return true, errors.New("Access denied")
+			}
+		}
+
+		pass.Status = current.Status
+		pass.Uses = current.Uses
+		pass.DateCheckin = current.DateCheckin
+		pass.DateCheckout = current.DateCheckout
+		pass.CheckinBy = current.CheckinBy
+		pass.CheckoutBy = current.CheckoutBy
+		pass.DateRevoked = current.DateRevoked
+		pass.RevokedBy = current.RevokedBy
+
+		if revoke {
+			pass.Status = model.GatePassRevoked
+			pass.DateRevoked = utils.DateTime{}.Now()
+			pass.RevokedBy = ses.String("admin_id")
+		}
+	}
+
 	return false, err
 }
 
+// BeforeSaveGatePassLog the gate pass log is written by /api/gate/verify
+func BeforeSaveGatePassLog(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	return true, errors.New("gate pass scans are recorded at the gate")
+}
+
 // AfterSaveGatePass ...
 func AfterSaveGatePass(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (stop bool, err error) {
 
 	pass := frm.(*model.GatePass)
 	resp.Set("token", pass.Token)
 
+	// the creation date and site are filled in by the database
+	if err := tx.Model(pass).WherePK().Select(); err != nil {
+		utils.Env.Log.Debug(err)
+		return false, nil
+	}
+
+	// passes still work with the token when signing is not configured
+	qr, err := signGatePass(pass)
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return false, nil
+	}
+	resp.Set("qr", qr)
+
 	return false, nil
 }
 
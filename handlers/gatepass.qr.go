@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// gatePassQRPrefix marks a signed gate pass payload, the number is the payload version.
+// Version 2 is signed with Ed25519 so guard apps only hold the public key
+const gatePassQRPrefix = "EVE2."
+
+// GatePassClaims is the signed content of a gate pass QR code
+type GatePassClaims struct {
+	PassID string `json:"i"`
+	Token  string `json:"t"`
+	SiteID string `json:"s"`
+	Expiry int64  `json:"e"`
+}
+
+// siteGateKey is the Ed25519 key the passes of a site are signed with. Its seed is derived
+// from the [gate] qr_secret config key, each site has its own key pair
+func siteGateKey(siteID string) (ed25519.PrivateKey, error) {
+	secret, err := utils.Getkey("gate", "qr_secret")
+	if err != nil || len(secret) == 0 {
+		return nil, errors.New("gate pass signing is not configured")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("gate-pass:" + siteID))
+	return ed25519.NewKeyFromSeed(mac.Sum(nil)), nil
+}
+
+// signGatePass returns the QR payload of a pass: prefix, base64 claims and base64 Ed25519
+// signature of the claims, the parts separated by dots
+func signGatePass(pass *model.GatePass) (string, error) {
+	key, err := siteGateKey(pass.SiteID)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(GatePassClaims{
+		PassID: pass.ID,
+		Token:  pass.Token,
+		SiteID: pass.SiteID,
+		Expiry: gatePassExpiry(pass).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(claims)
+	sig := ed25519.Sign(key, []byte(body))
+
+	return gatePassQRPrefix + body + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parseGatePassQR checks the signature and expiry of a QR payload
+func parseGatePassQR(payload, siteID string) (*GatePassClaims, error) {
+	parts := strings.Split(strings.TrimPrefix(payload, gatePassQRPrefix), ".")
+	if !strings.HasPrefix(payload, gatePassQRPrefix) || len(parts) != 2 {
+		return nil, errors.New("invalid gate pass code")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("invalid gate pass code")
+	}
+
+	claims := &GatePassClaims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, errors.New("invalid gate pass code")
+	}
+
+	if claims.SiteID != siteID {
+		return nil, errors.New("gate pass belongs to another site")
+	}
+
+	key, err := siteGateKey(claims.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("invalid gate pass code")
+	}
+
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(parts[0]), sig) {
+		return nil, errors.New("gate pass signature mismatch")
+	}
+
+	if time.Now().Unix() > claims.Expiry {
+		return nil, errors.New("gate pass has expired")
+	}
+
+	return claims, nil
+}
+
+// renderQR draws a payload as a png or svg image of about size pixels
+func renderQR(payload, format string, size int) ([]byte, string, error) {
+	if size < 64 || size > 1024 {
+		size = 256
+	}
+
+	if format == "svg" {
+		code, err := qrcode.New(payload, qrcode.Medium)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return qrSVG(code.Bitmap(), size), "image/svg+xml", nil
+	}
+
+	png, err := qrcode.Encode(payload, qrcode.Medium, size)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return png, "image/png", nil
+}
+
+// qrSVG draws each run of dark modules of a row as a single rect
+func qrSVG(bitmap [][]bool, size int) []byte {
+	var b bytes.Buffer
+
+	n := len(bitmap)
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, n, n)
+
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="1" fill="#000"/>`, start, y, x-start)
+		}
+	}
+
+	b.WriteString("</svg>")
+
+	return b.Bytes()
+}
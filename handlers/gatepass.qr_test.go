@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+)
+
+func testGatePass(siteID string, until time.Time) *model.GatePass {
+	return &model.GatePass{
+		ID:          "gp1",
+		SiteID:      siteID,
+		Token:       "123456",
+		DateCreated: dt(until.Add(-time.Hour)),
+		ValidUntil:  dt(until),
+	}
+}
+
+// forgeGatePass signs the claims with the key of another site
+func forgeGatePass(t *testing.T, claims GatePassClaims, keySite string) string {
+	key, err := siteGateKey(keySite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(claims)
+	body := base64.RawURLEncoding.EncodeToString(data)
+	return gatePassQRPrefix + body + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(body)))
+}
+
+func TestGatePassQR(t *testing.T) {
+	pass := testGatePass("s1", time.Now().Add(48*time.Hour).Truncate(time.Second))
+	expiry := gatePassExpiry(pass).Unix()
+
+	valid, err := signGatePass(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := signGatePass(testGatePass("s1", at(18, 17, 30)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(valid, gatePassQRPrefix), ".")
+	otherClaims, _ := json.Marshal(GatePassClaims{PassID: "gp2", Token: "654321", SiteID: "s1", Expiry: expiry})
+
+	tests := []struct {
+		name    string
+		payload string
+		siteID  string
+		ok      bool
+	}{
+		{"valid", valid, "s1", true},
+		{"other site", valid, "s2", false},
+		{"expired", expired, "s1", false},
+		{"changed claims", gatePassQRPrefix + base64.RawURLEncoding.EncodeToString(otherClaims) + "." + parts[1], "s1", false},
+		{"changed signature", gatePassQRPrefix + parts[0] + "." + base64.RawURLEncoding.EncodeToString(make([]byte, ed25519.SignatureSize)), "s1", false},
+		{"signed with the key of another site", forgeGatePass(t, GatePassClaims{PassID: "gp1", Token: "123456", SiteID: "s1", Expiry: expiry}, "s2"), "s1", false},
+		{"old version", "EVE1." + parts[0] + "." + parts[1], "s1", false},
+		{"no signature", gatePassQRPrefix + parts[0], "s1", false},
+		{"not base64", gatePassQRPrefix + "!!." + parts[1], "s1", false},
+		{"token only", "123456", "s1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := parseGatePassQR(tt.payload, tt.siteID)
+			if (err == nil) != tt.ok {
+				t.Fatalf("parseGatePassQR() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			want := GatePassClaims{PassID: "gp1", Token: "123456", SiteID: "s1", Expiry: expiry}
+			if *claims != want {
+				t.Errorf("claims = %+v, want %+v", *claims, want)
+			}
+		})
+	}
+}
+
+func TestSiteGateKey(t *testing.T) {
+	s1, err := siteGateKey("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := siteGateKey("s1")
+	s2, _ := siteGateKey("s2")
+
+	if !s1.Equal(again) {
+		t.Error("siteGateKey() is not stable for a site")
+	}
+	if s1.Equal(s2) {
+		t.Error("siteGateKey() returned the same key for two sites")
+	}
+
+	key := utils.Env.Cfg.Section("gate").Key("qr_secret")
+	secret := key.String()
+	key.SetValue("")
+	defer key.SetValue(secret)
+
+	if _, err := siteGateKey("s1"); err == nil {
+		t.Error("siteGateKey() signed without a secret")
+	}
+	if _, err := signGatePass(testGatePass("s1", time.Now().Add(time.Hour))); err == nil {
+		t.Error("signGatePass() signed without a secret")
+	}
+}
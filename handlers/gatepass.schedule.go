@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+)
+
+// wallClock timestamps are stored without a zone, they are read back as local time
+func wallClock(dt utils.DateTime) time.Time {
+	y, m, d := dt.Date()
+	return time.Date(y, m, d, dt.Hour(), dt.Minute(), dt.Second(), 0, time.Local)
+}
+
+// gatePassStart passes without a window are valid from the moment they are created
+func gatePassStart(pass *model.GatePass) time.Time {
+	if !pass.ValidFrom.IsZero() {
+		return wallClock(pass.ValidFrom)
+	}
+	return wallClock(pass.DateCreated)
+}
+
+// gatePassExpiry passes are valid until the end of the day they were created unless they
+// have a window, a window ending on a date runs to the end of that day
+func gatePassExpiry(pass *model.GatePass) time.Time {
+	until := pass.DateCreated
+	if !pass.ValidUntil.IsZero() {
+		until = pass.ValidUntil
+		if until.Hour() != 0 || until.Minute() != 0 || until.Second() != 0 {
+			return wallClock(until)
+		}
+	}
+
+	y, m, d := until.Date()
+	return time.Date(y, m, d, 23, 59, 59, 0, time.Local)
+}
+
+// hasWindow is true for passes that can be used on more than the day they were created
+func hasWindow(pass *model.GatePass) bool {
+	return !pass.ValidUntil.IsZero() || (len(pass.Schedule) > 0 && string(pass.Schedule) != "null")
+}
+
+// maxUses day passes without a limit can be used once, passes with a window as often as
+// their window allows
+func maxUses(pass *model.GatePass) int {
+	if pass.MaxUses > 0 {
+		return pass.MaxUses
+	}
+	if hasWindow(pass) {
+		return math.MaxInt32
+	}
+	return 1
+}
+
+func gatePassSchedule(pass *model.GatePass) (*model.GatePassSchedule, error) {
+	if len(pass.Schedule) == 0 || string(pass.Schedule) == "null" {
+		return nil, nil
+	}
+
+	schedule := &model.GatePassSchedule{}
+	if err := json.Unmarshal(pass.Schedule, schedule); err != nil {
+		return nil, errors.New("invalid gate pass schedule")
+	}
+
+	return schedule, nil
+}
+
+// validateGatePass checks the window, schedule and use limit of a pass
+func validateGatePass(pass *model.GatePass) error {
+	if pass.MaxUses < 0 {
+		return errors.New("max uses cannot be negative")
+	}
+
+	if !pass.ValidFrom.IsZero() && !pass.ValidUntil.IsZero() &&
+		!gatePassExpiry(pass).After(wallClock(pass.ValidFrom)) {
+		return errors.New("a gate pass must end after it starts")
+	}
+
+	schedule, err := gatePassSchedule(pass)
+	if err != nil || schedule == nil {
+		return err
+	}
+
+	for _, d := range schedule.Days {
+		if d < 0 || d > 6 {
+			return errors.New("schedule days must be between 0 (sunday) and 6 (saturday)")
+		}
+	}
+
+	if len(schedule.From) > 0 || len(schedule.To) > 0 {
+		from, err := time.Parse("15:04", schedule.From)
+		if err != nil {
+			return errors.New("schedule hours must be in 15:04 format")
+		}
+		to, err := time.Parse("15:04", schedule.To)
+		if err != nil {
+			return errors.New("schedule hours must be in 15:04 format")
+		}
+		if !to.After(from) {
+			return errors.New("a schedule must end after it starts")
+		}
+	}
+
+	return nil
+}
+
+// checkWindow refuses a pass outside its validity window or schedule. It applies to the
+// scan that starts a visit, a visitor who is in can always leave
+func checkWindow(pass *model.GatePass, now time.Time) error {
+	start := gatePassStart(pass)
+	if now.Before(start) {
+		return rejectPass(http.StatusConflict, "gate pass is not valid until %s", start.Format(utils.FormatYYYYMMDDHHmmSS))
+	}
+
+	if now.After(gatePassExpiry(pass)) {
+		return rejectPass(http.StatusGone, "gate pass has expired")
+	}
+
+	schedule, err := gatePassSchedule(pass)
+	if err != nil || schedule == nil {
+		return err
+	}
+
+	if len(schedule.Days) > 0 {
+		valid := false
+		for _, d := range schedule.Days {
+			valid = valid || time.Weekday(d) == now.Weekday()
+		}
+		if !valid {
+			return rejectPass(http.StatusConflict, "gate pass is not valid on %s", now.Weekday())
+		}
+	}
+
+	if len(schedule.From) > 0 {
+		clock := now.Format("15:04")
+		if clock < schedule.From || clock > schedule.To {
+			return rejectPass(http.StatusConflict, "gate pass is only valid between %s and %s", schedule.From, schedule.To)
+		}
+	}
+
+	return nil
+}
+
+// gatePassLive is true for passes that can still be used, now or later
+func gatePassLive(pass *model.GatePass, now time.Time) bool {
+	switch pass.Status {
+	case model.GatePassCheckedIn:
+		return true
+	case model.GatePassUnused, model.GatePassCheckedOut:
+		return !now.After(gatePassExpiry(pass)) && pass.Uses < maxUses(pass)
+	}
+
+	return false
+}
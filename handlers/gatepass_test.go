@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+)
+
+// monday 19 october 2026
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local)
+}
+
+func dt(t time.Time) utils.DateTime {
+	return utils.DateTime{Time: t}
+}
+
+func schedule(days []int, from, to string) json.RawMessage {
+	b, _ := json.Marshal(model.GatePassSchedule{Days: days, From: from, To: to})
+	return b
+}
+
+func rejectionStatus(err error) int {
+	if r, ok := err.(*gateRejection); ok {
+		return r.status
+	}
+	return 0
+}
+
+func TestCheckWindow(t *testing.T) {
+	dayPass := &model.GatePass{DateCreated: dt(at(19, 8, 0))}
+	window := &model.GatePass{DateCreated: dt(at(18, 8, 0)), ValidFrom: dt(at(19, 9, 0)), ValidUntil: dt(at(21, 17, 30))}
+	toDate := &model.GatePass{DateCreated: dt(at(18, 8, 0)), ValidUntil: dt(at(21, 0, 0))}
+	weekdays := &model.GatePass{DateCreated: dt(at(18, 8, 0)), ValidUntil: dt(at(31, 0, 0)), Schedule: schedule([]int{1, 2, 3, 4, 5}, "07:00", "18:00")}
+	badSchedule := &model.GatePass{DateCreated: dt(at(19, 8, 0)), Schedule: json.RawMessage(`{"days":"monday"}`)}
+
+	tests := []struct {
+		name   string
+		pass   *model.GatePass
+		now    time.Time
+		status int
+		ok     bool
+	}{
+		{"day pass on the day", dayPass, at(19, 23, 0), 0, true},
+		{"day pass the next day", dayPass, at(20, 0, 1), http.StatusGone, false},
+		{"day pass before it was created", dayPass, at(19, 7, 0), http.StatusConflict, false},
+		{"before the window", window, at(19, 8, 59), http.StatusConflict, false},
+		{"start of the window", window, at(19, 9, 0), 0, true},
+		{"end of the window", window, at(21, 17, 30), 0, true},
+		{"after the window", window, at(21, 17, 31), http.StatusGone, false},
+		{"window to a date runs to the end of the day", toDate, at(21, 23, 59), 0, true},
+		{"window to a date ends with the day", toDate, at(22, 0, 0), http.StatusGone, false},
+		{"scheduled day and hour", weekdays, at(20, 12, 0), 0, true},
+		{"start of the scheduled hours", weekdays, at(20, 7, 0), 0, true},
+		{"end of the scheduled hours", weekdays, at(20, 18, 0), 0, true},
+		{"before the scheduled hours", weekdays, at(20, 6, 59), http.StatusConflict, false},
+		{"after the scheduled hours", weekdays, at(20, 18, 1), http.StatusConflict, false},
+		{"day off the schedule", weekdays, at(25, 12, 0), http.StatusConflict, false},
+		{"invalid schedule", badSchedule, at(19, 9, 0), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWindow(tt.pass, tt.now)
+			if (err == nil) != tt.ok {
+				t.Fatalf("checkWindow() error = %v, want ok %v", err, tt.ok)
+			}
+			if got := rejectionStatus(err); got != tt.status {
+				t.Errorf("status = %d, want %d", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestValidateGatePass(t *testing.T) {
+	tests := []struct {
+		name string
+		pass *model.GatePass
+		ok   bool
+	}{
+		{"day pass", &model.GatePass{}, true},
+		{"window", &model.GatePass{ValidFrom: dt(at(19, 9, 0)), ValidUntil: dt(at(20, 9, 0))}, true},
+		{"window on one date", &model.GatePass{ValidFrom: dt(at(19, 9, 0)), ValidUntil: dt(at(19, 0, 0))}, true},
+		{"window ends before it starts", &model.GatePass{ValidFrom: dt(at(19, 9, 0)), ValidUntil: dt(at(19, 8, 0))}, false},
+		{"negative uses", &model.GatePass{MaxUses: -1}, false},
+		{"schedule", &model.GatePass{Schedule: schedule([]int{0, 6}, "09:00", "17:00")}, true},
+		{"schedule without hours", &model.GatePass{Schedule: schedule([]int{1}, "", "")}, true},
+		{"null schedule", &model.GatePass{Schedule: json.RawMessage("null")}, true},
+		{"day out of range", &model.GatePass{Schedule: schedule([]int{7}, "", "")}, false},
+		{"hours out of order", &model.GatePass{Schedule: schedule(nil, "17:00", "09:00")}, false},
+		{"missing end hour", &model.GatePass{Schedule: schedule(nil, "09:00", "")}, false},
+		{"invalid hour", &model.GatePass{Schedule: schedule(nil, "9am", "5pm")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateGatePass(tt.pass); (err == nil) != tt.ok {
+				t.Errorf("validateGatePass() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMaxUses(t *testing.T) {
+	tests := []struct {
+		name string
+		pass *model.GatePass
+		want int
+	}{
+		{"day pass", &model.GatePass{}, 1},
+		{"day pass with a limit", &model.GatePass{MaxUses: 3}, 3},
+		{"window", &model.GatePass{ValidUntil: dt(at(21, 0, 0))}, math.MaxInt32},
+		{"window with a limit", &model.GatePass{ValidUntil: dt(at(21, 0, 0)), MaxUses: 5}, 5},
+		{"schedule", &model.GatePass{Schedule: schedule([]int{1}, "", "")}, math.MaxInt32},
+		{"null schedule", &model.GatePass{Schedule: json.RawMessage("null")}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxUses(tt.pass); got != tt.want {
+				t.Errorf("maxUses() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatePassLive(t *testing.T) {
+	now := at(19, 12, 0)
+	created := dt(at(19, 8, 0))
+	until := dt(at(21, 0, 0))
+
+	tests := []struct {
+		name string
+		pass *model.GatePass
+		want bool
+	}{
+		{"unused day pass", &model.GatePass{DateCreated: created, Status: model.GatePassUnused}, true},
+		{"day pass of yesterday", &model.GatePass{DateCreated: dt(at(18, 8, 0)), Status: model.GatePassUnused}, false},
+		{"checked in after expiry", &model.GatePass{DateCreated: dt(at(18, 8, 0)), Status: model.GatePassCheckedIn, Uses: 1}, true},
+		{"checked out with uses left", &model.GatePass{DateCreated: created, Status: model.GatePassCheckedOut, MaxUses: 2, Uses: 1}, true},
+		{"checked out without uses left", &model.GatePass{DateCreated: created, Status: model.GatePassCheckedOut, MaxUses: 2, Uses: 2}, false},
+		{"window in use", &model.GatePass{DateCreated: created, ValidUntil: until, Status: model.GatePassCheckedOut, Uses: 10}, true},
+		{"window not started", &model.GatePass{DateCreated: created, ValidFrom: dt(at(20, 9, 0)), ValidUntil: until}, true},
+		{"used", &model.GatePass{DateCreated: created, Status: model.GatePassUsed}, false},
+		{"expired", &model.GatePass{DateCreated: created, Status: model.GatePassExpired}, false},
+		{"revoked", &model.GatePass{DateCreated: created, Status: model.GatePassRevoked}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gatePassLive(tt.pass, now); got != tt.want {
+				t.Errorf("gatePassLive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextGateAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		pass      *model.GatePass
+		direction string
+		action    int
+		ok        bool
+	}{
+		{"first entry", &model.GatePass{}, "", model.GateCheckIn, true},
+		{"exit after entry", &model.GatePass{Status: model.GatePassCheckedIn, Uses: 1}, "", model.GateCheckOut, true},
+		{"second entry of a single use pass", &model.GatePass{Status: model.GatePassCheckedOut, Uses: 1}, "in", 0, false},
+		{"second entry within the limit", &model.GatePass{Status: model.GatePassCheckedOut, MaxUses: 2, Uses: 1}, "", model.GateCheckIn, true},
+		{"entry past the limit", &model.GatePass{Status: model.GatePassCheckedOut, MaxUses: 2, Uses: 2}, "in", 0, false},
+		{"entry while checked in", &model.GatePass{Status: model.GatePassCheckedIn, Uses: 1}, "in", 0, false},
+		{"exit before entry", &model.GatePass{}, "out", 0, false},
+		{"exit only pass", &model.GatePass{Type: model.GatePassExit}, "", model.GateCheckOut, true},
+		{"exit only pass used up", &model.GatePass{Type: model.GatePassExit, Uses: 1}, "out", 0, false},
+		{"entry on an exit only pass", &model.GatePass{Type: model.GatePassExit}, "in", 0, false},
+		{"exit on an entry only pass", &model.GatePass{Type: model.GatePassEntry, Status: model.GatePassCheckedIn}, "out", 0, false},
+		{"unknown direction", &model.GatePass{}, "up", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := nextGateAction(tt.pass, tt.direction)
+			if (err == nil) != tt.ok {
+				t.Fatalf("nextGateAction() error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && action != tt.action {
+				t.Errorf("action = %d, want %d", action, tt.action)
+			}
+		})
+	}
+}
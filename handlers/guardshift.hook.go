@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// longest shift that can be scheduled
+const maxShiftHours = 24
+
+// BeforeSaveGuardShift officials schedule the shifts of the guards of the site, a shift can
+// only be changed or cancelled before the guard clocks in
+func BeforeSaveGuardShift(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.GuardShift)
+
+	if len(oid) > 0 && oid != "new" {
+		current := &model.GuardShift{}
+		err := tx.Model(current).
+			Where("id = ? and site_id = ?", oid, siteID).
+			For("update").
+			Select()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		if current.Status != model.ShiftScheduled {
+			return true, errors.New("only scheduled shifts can be changed")
+		}
+		if record.Status != model.ShiftScheduled && record.Status != model.ShiftCancelled {
+			return true, errors.New("guards clock in and out from the app")
+		}
+
+		record.ID = current.ID
+		record.SiteID = siteID
+		if record.Status == model.ShiftScheduled {
+			if err := checkGuardShift(tx, record); err != nil {
+				return true, err
+			}
+		}
+
+		_, err = tx.Model(record).
+			Column("guard_id", "name", "date_start", "date_end", "status", "note").
+			WherePK().
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.Status = model.ShiftScheduled
+	record.ClockIn = utils.DateTime{}
+	record.ClockOut = utils.DateTime{}
+	record.CreatedBy = model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if err := checkGuardShift(tx, record); err != nil {
+		return true, err
+	}
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+// checkGuardShift the guard must be an enabled security user of the site, not already
+// scheduled at the same time
+func checkGuardShift(tx *pg.Tx, record *model.GuardShift) error {
+	log := utils.Env.Log
+
+	record.Name = strings.TrimSpace(record.Name)
+
+	if record.DateStart.IsZero() || record.DateEnd.IsZero() {
+		return errors.New("a shift needs a start and an end")
+	}
+	length := record.DateEnd.Sub(record.DateStart.Time)
+	if length <= 0 {
+		return errors.New("a shift must end after it starts")
+	}
+	if length.Hours() > maxShiftHours {
+		return fmt.Errorf("a shift cannot be longer than %d hours", maxShiftHours)
+	}
+
+	count, err := tx.Model((*model.User)(nil)).
+		Where("id = ? and site_id = ? and type = ? and status = ?", record.GuardID, record.SiteID, model.SecurityUser, model.IsEnabled).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+	if count == 0 {
+		return errors.New("shifts can only be scheduled for the security users of the site")
+	}
+
+	count, err = tx.Model((*model.GuardShift)(nil)).
+		Where("guard_id = ? and id <> ? and status <> ?", record.GuardID, record.ID, model.ShiftCancelled).
+		Where("date_start < ? and date_end > ?", record.DateEnd.Time, record.DateStart.Time).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+	if count > 0 {
+		return errors.New("the guard is already scheduled at that time")
+	}
+
+	return nil
+}
+
+// BeforeListGuardShift residents cannot see shifts, guards only see their own
+func BeforeListGuardShift(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return false, err
+	}
+
+	switch ses.Int("admin_type") {
+	case model.ResidentUser:
+		return true, fmt.Errorf("Access denied")
+	case model.SecurityUser:
+		(*filter)["guard_id"] = ses.String("admin_id")
+	}
+
+	return false, nil
+}
+
+// DeleteGuardShift officials can delete shifts the guard has not clocked in to
+func DeleteGuardShift(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	count, err := tx.Model((*model.GuardShift)(nil)).
+		Where("id = ? and site_id = ? and clock_in is null", c.Param("id"), getSiteID(c)).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count == 0 {
+		return true, errors.New("shifts the guard clocked in to cannot be deleted")
+	}
+
+	return false, nil
+}
+
+// BeforeSavePatrolCheckpoint officials manage the checkpoints of the site, a code is
+// generated when none is given
+func BeforeSavePatrolCheckpoint(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.PatrolCheckpoint)
+	isNew := len(oid) == 0 || oid == "new"
+
+	record.Name = strings.TrimSpace(record.Name)
+	if len(record.Name) == 0 {
+		return true, errors.New("a name is required")
+	}
+
+	record.Code = strings.ToUpper(strings.TrimSpace(record.Code))
+	if len(record.Code) == 0 {
+		record.Code = strings.ToUpper(xid.New().String())
+	}
+
+	count, err := tx.Model((*model.PatrolCheckpoint)(nil)).
+		Where("site_id = ? and code = ? and id <> ?", siteID, record.Code, oid).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, fmt.Errorf("%s is already used by another checkpoint", record.Code)
+	}
+
+	if len(record.StreetID) > 0 {
+		count, err := tx.Model((*model.Street)(nil)).
+			Where("id = ? and site_id = ?", record.StreetID, siteID).
+			Count()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+		if count == 0 {
+			return true, errors.New("unknown street")
+		}
+	}
+
+	if !isNew {
+		_, err := tx.Model(record).
+			Column("name", "code", "location", "street_id", "active").
+			Where("id = ? and site_id = ?", oid, siteID).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.Active = true
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+	resp.Set("code", record.Code)
+
+	return true, nil
+}
+
+// BeforeListPatrol residents cannot see checkpoints and patrol logs
+func BeforeListPatrol(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") == model.ResidentUser {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	return false, nil
+}
+
+// BeforeReadPatrol residents cannot see checkpoints and patrol logs
+func BeforeReadPatrol(c echo.Context, mi *et.ModelInfo, field, value string, filter *utils.Options, resp *utils.Response) (bool, error) {
+	return BeforeListPatrol(c, filter, resp)
+}
+
+// BeforeSavePatrolScan patrol scans are recorded by the guard app
+func BeforeSavePatrolScan(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	return true, errors.New("checkpoints are scanned from the guard app")
+}
+
+// DeletePatrolCheckpoint officials can delete checkpoints that were never scanned, others
+// are deactivated
+func DeletePatrolCheckpoint(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	count, err := tx.Model((*model.PatrolScan)(nil)).Where("checkpoint_id = ?", c.Param("id")).Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, errors.New("checkpoints with patrol scans cannot be deleted, deactivate them instead")
+	}
+
+	return false, nil
+}
+
+// DeletePatrolScan patrol logs cannot be removed
+func DeletePatrolScan(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	return true, errors.New("patrol scans cannot be deleted")
+}
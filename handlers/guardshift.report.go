@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ShiftReportLine is a shift with its attendance and what the guard did during it
+type ShiftReportLine struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	GuardID      string         `json:"guard_id"`
+	Guard        string         `json:"guard"`
+	DateStart    utils.DateTime `json:"date_start"`
+	DateEnd      utils.DateTime `json:"date_end"`
+	ClockIn      utils.DateTime `json:"clock_in"`
+	ClockOut     utils.DateTime `json:"clock_out"`
+	Status       int            `json:"status"`
+	Missed       bool           `json:"missed"`
+	LateMinutes  int            `json:"late_minutes"`
+	EarlyMinutes int            `json:"early_minutes"`
+	Minutes      int            `json:"minutes"`
+	Scans        int            `json:"scans"`
+	Alerts       int            `json:"alerts"`
+	Incidents    int            `json:"incidents"`
+}
+
+// GuardShiftSummary totals the shifts of a guard
+type GuardShiftSummary struct {
+	GuardID   string `json:"guard_id"`
+	Guard     string `json:"guard"`
+	Shifts    int    `json:"shifts"`
+	Attended  int    `json:"attended"`
+	Missed    int    `json:"missed"`
+	Late      int    `json:"late"`
+	Minutes   int    `json:"minutes"`
+	Scans     int    `json:"scans"`
+	Alerts    int    `json:"alerts"`
+	Incidents int    `json:"incidents"`
+}
+
+// CheckpointSummary is how often a checkpoint was scanned
+type CheckpointSummary struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Scans       int            `json:"scans"`
+	LastScanned utils.DateTime `json:"last_scanned"`
+}
+
+// ShiftReport returns the shifts that started between ?from= and ?to= (the last 30 days by
+// default) with attendance, patrols and alerts answered, totals per guard and checkpoint
+func (s *Controller) ShiftReport(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	period, err := reportPeriod(c)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	// the guard is accountable from the clock in (or the start) to the clock out (or the end)
+	args := append([]interface{}{model.ShiftScheduled}, period...)
+	args = append(args, model.ShiftCancelled)
+
+	shifts := []ShiftReportLine{}
+	_, err = dbc.Query(&shifts, `
+		select
+			gs.id, gs.name, gs.guard_id, concat(u.first_name, ' ', u.last_name) as guard,
+			gs.date_start, gs.date_end, gs.clock_in, gs.clock_out, gs.status,
+			gs.status = ? and gs.date_end < localtimestamp as missed,
+			greatest(0, extract(epoch from gs.clock_in - gs.date_start) / 60)::int as late_minutes,
+			greatest(0, extract(epoch from gs.date_end - gs.clock_out) / 60)::int as early_minutes,
+			coalesce(extract(epoch from gs.clock_out - gs.clock_in) / 60, 0)::int as minutes,
+			(select count(*) from patrol_scan as ps where ps.shift_id = gs.id) as scans,
+			(select count(*) from resident_alerts as a
+				where a.responded_by = gs.guard_id and
+					a.time_responded between coalesce(gs.clock_in, gs.date_start) and coalesce(gs.clock_out, gs.date_end)) as alerts,
+			(select count(*) from incident as i
+				where i.reported_by->>'user_id' = gs.guard_id and
+					i.date_created between coalesce(gs.clock_in, gs.date_start) and coalesce(gs.clock_out, gs.date_end)) as incidents
+		from
+			guard_shift as gs
+		left join "user" as u
+			on u.id = gs.guard_id
+		where
+			gs.site_id = ? and gs.date_start >= ? and gs.date_start < ? and gs.status <> ?
+		order by
+			gs.date_start, guard
+	`, args...)
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	guards := []*GuardShiftSummary{}
+	byGuard := map[string]*GuardShiftSummary{}
+	for _, l := range shifts {
+		g, ok := byGuard[l.GuardID]
+		if !ok {
+			g = &GuardShiftSummary{GuardID: l.GuardID, Guard: l.Guard}
+			byGuard[l.GuardID] = g
+			guards = append(guards, g)
+		}
+
+		g.Shifts++
+		if !l.ClockIn.IsZero() {
+			g.Attended++
+		}
+		if l.Missed {
+			g.Missed++
+		}
+		if l.LateMinutes > 0 {
+			g.Late++
+		}
+		g.Minutes += l.Minutes
+		g.Scans += l.Scans
+		g.Alerts += l.Alerts
+		g.Incidents += l.Incidents
+	}
+
+	checkpoints := []CheckpointSummary{}
+	_, err = dbc.Query(&checkpoints, `
+		select
+			cp.id, cp.name, count(ps.id) as scans, max(ps.date_created) as last_scanned
+		from
+			patrol_checkpoint as cp
+		left join patrol_scan as ps
+			on ps.checkpoint_id = cp.id and ps.date_created >= ? and ps.date_created < ?
+		where
+			cp.site_id = ? and cp.active
+		group by
+			cp.id, cp.name
+		order by
+			scans, cp.name
+	`, period[1], period[2], period[0])
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	response.Set("shifts", shifts)
+	response.Set("guards", guards)
+	response.Set("checkpoints", checkpoints)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
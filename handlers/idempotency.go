@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// HeaderIdempotencyKey ...
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+const (
+	// keys are replayed for a day, after that the key can be used again
+	idempotencyTTL = 24 * time.Hour
+	// a request that has not completed by then is assumed to have died with the server
+	idempotencyStale = 5 * time.Minute
+)
+
+// responseRecorder keeps a copy of the response written by the handler
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// IdempotencyMw makes POST requests to the given paths safe to retry. A request carrying an
+// Idempotency-Key header is executed once per site, user and key, later requests with the
+// same key get the stored response back
+func IdempotencyMw(dbc *pg.DB, log *zap.SugaredLogger, paths []string) echo.MiddlewareFunc {
+	for i := range paths {
+		paths[i] = strings.ToLower(strings.TrimSuffix(paths[i], "/"))
+	}
+
+	covered := func(path string) bool {
+		path = strings.ToLower(path)
+		for _, p := range paths {
+			if path == p || strings.HasPrefix(path, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := strings.TrimSpace(req.Header.Get(HeaderIdempotencyKey))
+
+			if req.Method != http.MethodPost || len(key) == 0 || !covered(req.URL.Path) {
+				return next(c)
+			}
+
+			if len(key) > 200 {
+				return et.APIError(c, errors.New("Idempotency-Key is too long"), http.StatusBadRequest)
+			}
+
+			ses, err := et.NewSessionMgr(c, "")
+			if err != nil {
+				log.Debug(err)
+				return next(c)
+			}
+
+			// keys are only kept for signed in users, the access controller rejects the rest
+			userID := ses.String("admin_id")
+			if len(userID) == 0 {
+				return next(c)
+			}
+
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return et.APIError(c, err, http.StatusBadRequest)
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			record := model.IdempotencyKey{
+				ID:          xid.New().String(),
+				SiteID:      getSiteID(c),
+				UserID:      userID,
+				Key:         key,
+				Method:      req.Method,
+				Path:        req.URL.Path,
+				RequestHash: idempotencyHash(req.Method, req.URL.RequestURI(), body),
+				Status:      model.IdempotencyInProgress,
+				DateCreated: utils.DateTime{}.Now(),
+			}
+
+			claimed, err := claimIdempotencyKey(dbc, &record)
+			if err != nil {
+				log.Error(err)
+				return et.APIError(c, err, http.StatusInternalServerError)
+			}
+
+			if !claimed {
+				return replayIdempotencyKey(c, dbc, record)
+			}
+
+			rec := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = rec
+
+			err = next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError || !c.Response().Committed {
+				// failures are not stored so the client can retry with the same key
+				if _, err := dbc.Model(&record).WherePK().Delete(); err != nil {
+					log.Error(err)
+				}
+				return nil
+			}
+
+			record.Status = model.IdempotencyComplete
+			record.ResponseStatus = status
+			record.ContentType = c.Response().Header().Get(echo.HeaderContentType)
+			record.ResponseBody = rec.body.Bytes()
+
+			_, err = dbc.Model(&record).
+				Column("status", "response_status", "content_type", "response_body").
+				WherePK().
+				Update()
+			if err != nil {
+				log.Error(err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// idempotencyHash identifies a request by its method, uri and body
+func idempotencyHash(method, uri string, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(method + " " + uri + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// claimIdempotencyKey inserts the key, false means another request already holds it
+func claimIdempotencyKey(dbc *pg.DB, record *model.IdempotencyKey) (bool, error) {
+	now := time.Now()
+
+	// expired keys and keys of requests that never completed are released
+	_, err := dbc.Model((*model.IdempotencyKey)(nil)).
+		Where("site_id = ? and user_id = ? and key = ?", record.SiteID, record.UserID, record.Key).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.Where("date_created < ?", now.Add(-idempotencyTTL)).
+				WhereOr("status = ? and date_created < ?", model.IdempotencyInProgress, now.Add(-idempotencyStale))
+			return q, nil
+		}).
+		Delete()
+	if err != nil {
+		return false, err
+	}
+
+	res, err := dbc.Model(record).OnConflict("do nothing").Insert()
+	if err != nil {
+		return false, err
+	}
+
+	return res.RowsAffected() > 0, nil
+}
+
+// replayIdempotencyKey returns the stored response of the request that first used the key
+func replayIdempotencyKey(c echo.Context, dbc *pg.DB, record model.IdempotencyKey) error {
+	stored := model.IdempotencyKey{}
+	err := dbc.Model(&stored).
+		Where("site_id = ? and user_id = ? and key = ?", record.SiteID, record.UserID, record.Key).
+		Select()
+	if err == pg.ErrNoRows {
+		return et.APIError(c, errors.New("request is still being processed, retry shortly"), http.StatusConflict)
+	}
+	if err != nil {
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	return replayStoredResponse(c, stored, record)
+}
+
+// replayStoredResponse writes the stored response back when the request matches the one
+// that first used the key
+func replayStoredResponse(c echo.Context, stored, record model.IdempotencyKey) error {
+	if stored.RequestHash != record.RequestHash {
+		return et.APIError(c, errors.New("Idempotency-Key was used with a different request"), http.StatusUnprocessableEntity)
+	}
+
+	if stored.Status != model.IdempotencyComplete {
+		return et.APIError(c, errors.New("request is still being processed, retry shortly"), http.StatusConflict)
+	}
+
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+	return c.Blob(stored.ResponseStatus, stored.ContentType, stored.ResponseBody)
+}
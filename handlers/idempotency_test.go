@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve/service/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestIdempotencyHash(t *testing.T) {
+	hash := idempotencyHash(http.MethodPost, "/api/payment", []byte(`{"amount":100}`))
+
+	tests := []struct {
+		name   string
+		method string
+		uri    string
+		body   string
+		same   bool
+	}{
+		{"same request", http.MethodPost, "/api/payment", `{"amount":100}`, true},
+		{"different body", http.MethodPost, "/api/payment", `{"amount":200}`, false},
+		{"different path", http.MethodPost, "/api/invoice", `{"amount":100}`, false},
+		{"different query", http.MethodPost, "/api/payment?apply=1", `{"amount":100}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idempotencyHash(tt.method, tt.uri, []byte(tt.body))
+			if (got == hash) != tt.same {
+				t.Errorf("idempotencyHash() same = %v, want %v", got == hash, tt.same)
+			}
+		})
+	}
+}
+
+func TestReplayStoredResponse(t *testing.T) {
+	stored := model.IdempotencyKey{
+		Key:            "k1",
+		RequestHash:    "h1",
+		Status:         model.IdempotencyComplete,
+		ResponseStatus: http.StatusCreated,
+		ContentType:    echo.MIMEApplicationJSONCharsetUTF8,
+		ResponseBody:   []byte(`{"id":"p1"}`),
+	}
+
+	inProgress := stored
+	inProgress.Status = model.IdempotencyInProgress
+
+	tests := []struct {
+		name     string
+		stored   model.IdempotencyKey
+		hash     string
+		status   int
+		body     string
+		replayed bool
+	}{
+		{"replay", stored, "h1", http.StatusCreated, `{"id":"p1"}`, true},
+		{"different request", stored, "h2", http.StatusUnprocessableEntity, "", false},
+		{"still running", inProgress, "h1", http.StatusConflict, "", false},
+		{"different request still running", inProgress, "h2", http.StatusUnprocessableEntity, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/api/payment", nil), rec)
+
+			record := model.IdempotencyKey{Key: "k1", RequestHash: tt.hash}
+			if err := replayStoredResponse(c, tt.stored, record); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+			if len(tt.body) > 0 && rec.Body.String() != tt.body {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
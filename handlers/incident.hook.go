@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+var alertCategories = map[string]bool{
+	model.AlertPanic:     true,
+	model.AlertMedical:   true,
+	model.AlertFire:      true,
+	model.AlertIntrusion: true,
+	model.AlertNoise:     true,
+}
+
+// alertCategory alerts and incidents without a category are panic alerts
+func alertCategory(category string) (string, error) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if len(category) == 0 {
+		return model.AlertPanic, nil
+	}
+	if !alertCategories[category] {
+		return "", fmt.Errorf("unknown category %s", category)
+	}
+
+	return category, nil
+}
+
+// alertLocation returns the unit and street of the residency of a resident
+func alertLocation(db orm.DB, residentID string) (string, string, error) {
+	loc := struct {
+		UnitID   string
+		StreetID string
+	}{}
+
+	_, err := db.QueryOne(&loc, `
+		select u.id as unit_id, u.street_id from resident as r
+		join residency as rs
+			on rs.id = r.residency_id
+		join unit as u
+			on u.id = rs.unit_id
+		where
+			r.id = ?
+	`, residentID)
+	if err != nil && err != pg.ErrNoRows {
+		utils.Env.Log.Debug(err)
+		return "", "", err
+	}
+
+	return loc.UnitID, loc.StreetID, nil
+}
+
+// prepareAlert checks the category of a new alert, locates it and stores its photos (data
+// uris) as files
+func prepareAlert(db orm.DB, alert *model.ResidentAlerts) error {
+	category, err := alertCategory(alert.Category)
+	if err != nil {
+		return err
+	}
+	alert.Category = category
+	alert.Note = strings.TrimSpace(alert.Note)
+
+	if alert.UnitID, alert.StreetID, err = alertLocation(db, alert.ResidentID); err != nil {
+		return err
+	}
+
+	if len(alert.Photos) == 0 {
+		alert.Photos = json.RawMessage("[]")
+	}
+
+	return utils.SaveJSONImageData(utils.Env.Cfg, "photo", &alert.Photos)
+}
+
+// BeforeSaveIncident guards file incidents and submit them, officials sign them off or
+// return them to the guard with a note. Signed off incidents cannot be changed
+func BeforeSaveIncident(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType != model.SecurityUser && usrType < model.OfficialUser {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.Incident)
+	user := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: usrType,
+		Name:     ses.String("admin_name"),
+	}
+
+	if len(oid) > 0 && oid != "new" {
+		current := &model.Incident{}
+		err := tx.Model(current).
+			Where("id = ? and site_id = ?", oid, siteID).
+			For("update").
+			Select()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		if record.Status == model.IncidentSignedOff || record.Status == model.IncidentReturned {
+			if usrType < model.OfficialUser {
+				return true, fmt.Errorf("Access denied")
+			}
+			return true, reviewIncident(tx, user, current, record.Status, record.ReviewNote)
+		}
+
+		if current.Status != model.IncidentDraft && current.Status != model.IncidentReturned {
+			return true, errors.New("only draft and returned incidents can be changed")
+		}
+		if usrType < model.OfficialUser && current.ReportedBy.UserID != user.UserID {
+			return true, fmt.Errorf("Access denied")
+		}
+
+		record.ID = current.ID
+		record.SiteID = siteID
+		record.AlertID = current.AlertID
+		if err := checkIncident(tx, record); err != nil {
+			return true, err
+		}
+
+		_, err = tx.Model(record).
+			Column("category", "title", "description", "location", "unit_id", "street_id",
+				"date_occurred", "attachments", "status", "date_submitted").
+			WherePK().
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.ReportedBy = user
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if len(record.AlertID) > 0 {
+		alert := model.ResidentAlerts{}
+		err := tx.Model(&alert).Where("id = ? and site_id = ?", record.AlertID, siteID).Select()
+		if err == pg.ErrNoRows {
+			return true, errors.New("unknown alert")
+		}
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		count, err := tx.Model((*model.Incident)(nil)).Where("alert_id = ?", alert.ID).Count()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+		if count > 0 {
+			return true, errors.New("an incident has already been filed for this alert")
+		}
+
+		// the report starts from what the resident raised
+		if len(record.Category) == 0 {
+			record.Category = alert.Category
+		}
+		if len(record.UnitID) == 0 && len(record.StreetID) == 0 {
+			record.UnitID = alert.UnitID
+			record.StreetID = alert.StreetID
+		}
+		if len(record.Location) == 0 {
+			record.Location = alert.Address
+		}
+		if record.DateOccurred.IsZero() {
+			record.DateOccurred = alert.TimeLogged
+		}
+	}
+
+	if err := checkIncident(tx, record); err != nil {
+		return true, err
+	}
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+// checkIncident validates an incident, locates its unit and stores new attachments (data
+// uris) as files
+func checkIncident(tx *pg.Tx, record *model.Incident) error {
+	log := utils.Env.Log
+
+	category, err := alertCategory(record.Category)
+	if err != nil {
+		return err
+	}
+	record.Category = category
+
+	record.Title = strings.TrimSpace(record.Title)
+	if len(record.Title) == 0 {
+		return errors.New("a title is required")
+	}
+
+	if record.Status != model.IncidentDraft && record.Status != model.IncidentSubmitted {
+		return errors.New("an incident can only be saved as a draft or submitted")
+	}
+	if record.Status == model.IncidentSubmitted {
+		record.DateSubmitted = utils.DateTime{}.Now()
+	}
+
+	if record.DateOccurred.IsZero() {
+		record.DateOccurred = utils.DateTime{}.Now()
+	}
+
+	if len(record.UnitID) > 0 {
+		unit := model.Unit{}
+		err := tx.Model(&unit).Where("id = ? and site_id = ?", record.UnitID, record.SiteID).Select()
+		if err == pg.ErrNoRows {
+			return errors.New("unknown unit")
+		}
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+		record.StreetID = unit.StreetID
+	}
+
+	if len(record.StreetID) > 0 {
+		count, err := tx.Model((*model.Street)(nil)).
+			Where("id = ? and site_id = ?", record.StreetID, record.SiteID).
+			Count()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+		if count == 0 {
+			return errors.New("unknown street")
+		}
+	}
+
+	if len(record.Attachments) == 0 {
+		record.Attachments = json.RawMessage("[]")
+	}
+
+	return utils.SaveJSONImageData(utils.Env.Cfg, "attachment", &record.Attachments)
+}
+
+func reviewIncident(tx *pg.Tx, user model.UserDetails, record *model.Incident, status int, note string) error {
+	log := utils.Env.Log
+
+	if record.Status != model.IncidentSubmitted {
+		return errors.New("only submitted incidents can be reviewed")
+	}
+
+	note = strings.TrimSpace(note)
+	if status == model.IncidentReturned && len(note) == 0 {
+		return errors.New("a note is required to return an incident")
+	}
+
+	record.Status = status
+	record.ReviewNote = note
+	record.ReviewedBy = user
+	record.DateReviewed = utils.DateTime{}.Now()
+
+	_, err := tx.Model(record).
+		Column("status", "review_note", "reviewed_by", "date_reviewed").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return nil
+}
+
+// BeforeListIncident residents cannot see incident reports
+func BeforeListIncident(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") == model.ResidentUser {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	return false, nil
+}
+
+// BeforeReadIncident residents cannot see incident reports
+func BeforeReadIncident(c echo.Context, mi *et.ModelInfo, field, value string, filter *utils.Options, resp *utils.Response) (bool, error) {
+	return BeforeListIncident(c, filter, resp)
+}
+
+// DeleteIncident only drafts can be deleted, by the guard who filed them or an official.
+// Their attachments are removed
+func DeleteIncident(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType != model.SecurityUser && usrType < model.OfficialUser {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	record := model.Incident{}
+	err = tx.Model(&record).
+		Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	if record.Status != model.IncidentDraft {
+		return true, errors.New("only draft incidents can be deleted")
+	}
+	if usrType < model.OfficialUser && record.ReportedBy.UserID != ses.String("admin_id") {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	attachments := []struct {
+		Attachment json.RawMessage `json:"attachment"`
+	}{}
+	if err := json.Unmarshal(record.Attachments, &attachments); err == nil {
+		for _, a := range attachments {
+			if err := utils.DeleteImageData(utils.Env.Cfg, a.Attachment); err != nil {
+				log.Debug(err)
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IncidentCount is the number of alerts or incidents of a category or street
+type IncidentCount struct {
+	Key       string `json:"key"`
+	Name      string `json:"name"`
+	Alerts    int    `json:"alerts"`
+	Incidents int    `json:"incidents"`
+	SignedOff int    `json:"signed_off"`
+	Pending   int    `json:"pending"`
+}
+
+// IncidentReport returns the alerts raised and incidents that occurred between ?from= and
+// ?to= (the last 30 days by default) by category and by street
+func (s *Controller) IncidentReport(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	period, err := reportPeriod(c)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+	args := []interface{}{model.IncidentSignedOff, model.IncidentSubmitted}
+	args = append(args, period...)
+	args = append(args, period...)
+
+	// alerts and incidents counted side by side, pending incidents wait for sign off
+	counts := `
+		select
+			%[1]s as key, %[2]s as name,
+			count(*) filter (where src = 'alert') as alerts,
+			count(*) filter (where src = 'incident') as incidents,
+			count(*) filter (where src = 'incident' and status = ?) as signed_off,
+			count(*) filter (where src = 'incident' and status = ?) as pending
+		from (
+			select 'alert' as src, category, street_id, status from resident_alerts
+			where site_id = ? and time_logged >= ? and time_logged < ?
+			union all
+			select 'incident' as src, category, street_id, status from incident
+			where site_id = ? and date_occurred >= ? and date_occurred < ?
+		) as a
+		left join street as st
+			on st.id = a.street_id
+		group by
+			1, 2
+		order by
+			count(*) desc
+	`
+
+	categories := []IncidentCount{}
+	if _, err := dbc.Query(&categories, fmt.Sprintf(counts, "a.category", "a.category"), args...); err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	streets := []IncidentCount{}
+	_, err = dbc.Query(&streets, fmt.Sprintf(counts, "coalesce(a.street_id, '')", "coalesce(st.name, 'Unknown')"), args...)
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	response.Set("categories", categories)
+	response.Set("streets", streets)
+
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
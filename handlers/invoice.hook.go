@@ -123,6 +123,11 @@ func BeforeSaveInvoice(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfac
 		Amount:      record.Amount,
 		Dues:        record.Dues,
 	}
+	invoice.InvoiceNo, err = nextInvoiceNo(tx, siteID, invoice.DateCreated.Time)
+	if err != nil {
+		return false, err
+	}
+
 	if _, err := tx.Model(invoice).Insert(); err != nil {
 		log.Debug(err)
 		return false, err
@@ -152,6 +157,11 @@ func BeforeSaveInvoice(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfac
 		}
 	}
 
+	//5: post to the general ledger
+	if err := journalInvoice(tx, invoice); err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// defaultInvoiceFormat is used by sites that have not configured their series
+const defaultInvoiceFormat = "{prefix}-{year}-{number}"
+
+// BeforeSaveInvoiceSeries a site has a single series, the next number can not be moved
+// back so invoice numbers stay unique
+func BeforeSaveInvoiceSeries(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	record := frm.(*model.InvoiceSeries)
+
+	record.Prefix = strings.TrimSpace(record.Prefix)
+	if len(record.Format) == 0 {
+		record.Format = defaultInvoiceFormat
+	}
+	if !strings.Contains(record.Format, "{number}") {
+		return true, errors.New("invoice format must contain {number}")
+	}
+	if record.ResetYearly && !strings.Contains(record.Format, "{year}") {
+		return true, errors.New("a yearly reset needs {year} in the invoice format")
+	}
+	if record.Padding < 1 || record.Padding > 12 {
+		record.Padding = 4
+	}
+	series, err := siteInvoiceSeries(tx, siteID)
+	if err != nil {
+		return true, err
+	}
+
+	series.Prefix = record.Prefix
+	series.Format = record.Format
+	series.Padding = record.Padding
+	series.ResetYearly = record.ResetYearly
+
+	if err := setSeriesNumber(series, record.NextNumber, time.Now()); err != nil {
+		return true, err
+	}
+
+	_, err = tx.Model(series).
+		Column("prefix", "format", "padding", "reset_yearly", "year", "next_number").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", series.ID)
+	resp.Set("record", series)
+
+	return true, nil
+}
+
+// setSeriesNumber moves the next number of a series, no number keeps the current one. A
+// lower number is only allowed when a yearly series has not issued a number this year, the
+// number set then belongs to this year so the first invoice does not reset it
+func setSeriesNumber(series *model.InvoiceSeries, next int64, now time.Time) error {
+	if next < 1 || next == series.NextNumber {
+		return nil
+	}
+
+	newYear := series.ResetYearly && series.Year != now.Year()
+	if next < series.NextNumber && !newYear {
+		return errors.New("next number can not be lower than the last number issued")
+	}
+
+	series.NextNumber = next
+	if newYear {
+		series.Year = now.Year()
+	}
+
+	return nil
+}
+
+// DeleteInvoiceSeries ...
+func DeleteInvoiceSeries(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	err := errors.New("an invoice series can not be deleted")
+	return true, err
+}
+
+// siteInvoiceSeries returns the (locked) invoice series of a site, creating it when missing
+func siteInvoiceSeries(tx *pg.Tx, siteID string) (*model.InvoiceSeries, error) {
+	log := utils.Env.Log
+
+	series := &model.InvoiceSeries{}
+	err := tx.Model(series).
+		Where("site_id = ?", siteID).
+		For("update").
+		Select()
+	if err == nil {
+		return series, nil
+	}
+	if err != pg.ErrNoRows {
+		log.Debug(err)
+		return nil, err
+	}
+
+	site := model.Site{}
+	if err := tx.Model(&site).Where("id = ?", siteID).Select(); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	series = &model.InvoiceSeries{
+		ID:          xid.New().String(),
+		SiteID:      siteID,
+		Prefix:      strings.ToUpper(site.SiteCode),
+		Format:      defaultInvoiceFormat,
+		Padding:     4,
+		ResetYearly: true,
+		NextNumber:  1,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+	if len(series.Prefix) == 0 {
+		series.Prefix = "INV"
+	}
+
+	// a concurrent insert loses on the unique site_id and retries the lock
+	_, err = tx.Model(series).OnConflict("(site_id) do nothing").Insert()
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	err = tx.Model(series).
+		Where("site_id = ?", siteID).
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// nextInvoiceNo issues the next number of the sites series. The series row stays locked
+// until the transaction ends so numbers are gapless
+func nextInvoiceNo(tx *pg.Tx, siteID string, date time.Time) (string, error) {
+	log := utils.Env.Log
+
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	series, err := siteInvoiceSeries(tx, siteID)
+	if err != nil {
+		return "", err
+	}
+
+	rollSeriesYear(series, date)
+
+	number := series.NextNumber
+	series.NextNumber++
+
+	_, err = tx.Model(series).
+		Column("year", "next_number").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return "", err
+	}
+
+	return formatInvoiceNo(series, number), nil
+}
+
+// rollSeriesYear moves the series to the year of the invoice date, a yearly series starts
+// again from 1 in a year it has not issued or been set for
+func rollSeriesYear(series *model.InvoiceSeries, date time.Time) {
+	if series.Year == date.Year() {
+		return
+	}
+
+	if series.ResetYearly && series.Year != 0 {
+		series.NextNumber = 1
+	}
+	series.Year = date.Year()
+}
+
+func formatInvoiceNo(series *model.InvoiceSeries, number int64) string {
+	format := series.Format
+	if len(format) == 0 {
+		format = defaultInvoiceFormat
+	}
+
+	r := strings.NewReplacer(
+		"{prefix}", series.Prefix,
+		"{year}", strconv.Itoa(series.Year),
+		"{number}", fmt.Sprintf("%0*d", series.Padding, number),
+	)
+
+	return r.Replace(format)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"eve/service/model"
+)
+
+func TestSetSeriesNumber(t *testing.T) {
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name   string
+		series model.InvoiceSeries
+		next   int64
+		want   model.InvoiceSeries
+		ok     bool
+	}{
+		{"no number keeps the current one",
+			model.InvoiceSeries{ResetYearly: true, Year: 2025, NextNumber: 350}, 0,
+			model.InvoiceSeries{Year: 2025, NextNumber: 350}, true},
+		{"same number keeps the year",
+			model.InvoiceSeries{ResetYearly: true, Year: 2025, NextNumber: 350}, 350,
+			model.InvoiceSeries{Year: 2025, NextNumber: 350}, true},
+		{"higher number",
+			model.InvoiceSeries{Year: 2026, NextNumber: 12}, 100,
+			model.InvoiceSeries{Year: 2026, NextNumber: 100}, true},
+		{"lower number this year",
+			model.InvoiceSeries{ResetYearly: true, Year: 2026, NextNumber: 12}, 5,
+			model.InvoiceSeries{}, false},
+		{"lower number without a yearly reset",
+			model.InvoiceSeries{Year: 2025, NextNumber: 350}, 5,
+			model.InvoiceSeries{}, false},
+		{"start number for the new year",
+			model.InvoiceSeries{ResetYearly: true, Year: 2025, NextNumber: 350}, 10,
+			model.InvoiceSeries{Year: 2026, NextNumber: 10}, true},
+		{"higher number for the new year",
+			model.InvoiceSeries{ResetYearly: true, Year: 2025, NextNumber: 350}, 1000,
+			model.InvoiceSeries{Year: 2026, NextNumber: 1000}, true},
+		{"series that never issued",
+			model.InvoiceSeries{ResetYearly: true, NextNumber: 1}, 50,
+			model.InvoiceSeries{Year: 2026, NextNumber: 50}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := tt.series
+			err := setSeriesNumber(&series, tt.next, now)
+			if (err == nil) != tt.ok {
+				t.Fatalf("setSeriesNumber() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			if series.Year != tt.want.Year || series.NextNumber != tt.want.NextNumber {
+				t.Errorf("series = %d/%d, want %d/%d", series.Year, series.NextNumber, tt.want.Year, tt.want.NextNumber)
+			}
+		})
+	}
+}
+
+func TestRollSeriesYear(t *testing.T) {
+	date := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name   string
+		series model.InvoiceSeries
+		year   int
+		next   int64
+	}{
+		{"same year", model.InvoiceSeries{ResetYearly: true, Year: 2026, NextNumber: 12}, 2026, 12},
+		{"yearly reset", model.InvoiceSeries{ResetYearly: true, Year: 2025, NextNumber: 350}, 2026, 1},
+		{"no yearly reset", model.InvoiceSeries{Year: 2025, NextNumber: 350}, 2026, 350},
+		{"first invoice", model.InvoiceSeries{ResetYearly: true, NextNumber: 40}, 2026, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := tt.series
+			rollSeriesYear(&series, date)
+			if series.Year != tt.year || series.NextNumber != tt.next {
+				t.Errorf("series = %d/%d, want %d/%d", series.Year, series.NextNumber, tt.year, tt.next)
+			}
+		})
+	}
+
+	// a start number set for the new year survives its first invoice
+	series := model.InvoiceSeries{ResetYearly: true, Year: 2025, NextNumber: 350}
+	if err := setSeriesNumber(&series, 10, date); err != nil {
+		t.Fatal(err)
+	}
+	rollSeriesYear(&series, date)
+	if series.NextNumber != 10 {
+		t.Errorf("next number = %d after the first invoice of the year, want 10", series.NextNumber)
+	}
+}
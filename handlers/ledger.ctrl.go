@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"eve/service/model"
+	"eve/service/view"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+// GetTrialBalance returns the balance of every account of the site as at ?to=YYYY-MM-DD
+func (s *Controller) GetTrialBalance(c echo.Context) error {
+	dbc := s.env.Dbc
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	to := time.Now()
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return et.APIError(c, fmt.Errorf("invalid to date"), http.StatusBadRequest)
+		}
+	}
+
+	rows := []view.TrialBalance{}
+	_, err = dbc.Query(&rows, `
+		select
+			a.id, a.site_id, a.code, a.name, a.type, a.kind,
+			coalesce(sum(l.debit), 0) as debit,
+			coalesce(sum(l.credit), 0) as credit,
+			coalesce(sum(l.debit - l.credit), 0) as balance
+		from
+			ledger_account as a
+		left join journal_line as l
+			on l.account_id = a.id
+			and exists (select 1 from journal as j where j.id = l.journal_id and j.date_trx < ?)
+		where
+			a.site_id = ?
+		group by
+			a.id
+		order by
+			a.code
+	`, to.AddDate(0, 0, 1), ses.String("admin_site_id"))
+	if err != nil {
+		s.log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	debit := decimal.Zero
+	credit := decimal.Zero
+	for _, r := range rows {
+		if r.Balance.Sign() > 0 {
+			debit = debit.Add(r.Balance)
+		} else {
+			credit = credit.Sub(r.Balance)
+		}
+	}
+
+	response.Set("date", to.Format("2006-01-02"))
+	response.Set("list", rows)
+	response.Set("debit", debit)
+	response.Set("credit", credit)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// GetLedger returns the postings to an account for the period ?from=YYYY-MM-DD&to=YYYY-MM-DD
+// with the opening and closing balance
+func (s *Controller) GetLedger(c echo.Context) error {
+	dbc := s.env.Dbc
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	account := model.LedgerAccount{}
+	err = dbc.Model(&account).
+		Where("id = ? and site_id = ?", c.Param("id"), ses.String("admin_site_id")).
+		Select()
+	if err != nil {
+		return et.APIError(c, fmt.Errorf("unknown account"), http.StatusBadRequest)
+	}
+
+	var opening decimal.Decimal
+	_, err = dbc.QueryOne(pg.Scan(&opening), `
+		select coalesce(sum(l.debit - l.credit), 0)
+		from journal_line as l
+		join journal as j on j.id = l.journal_id
+		where l.account_id = ? and j.date_trx < ?
+	`, account.ID, from)
+	if err != nil {
+		s.log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	lines := []view.LedgerList{}
+	err = dbc.Model(&lines).
+		Where("account_id = ? and date_trx >= ? and date_trx < ?", account.ID, from, to.AddDate(0, 0, 1)).
+		Order("date_trx").
+		Select()
+	if err != nil {
+		s.log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	// running balance within the period
+	balance := opening
+	for i := range lines {
+		balance = balance.Add(lines[i].Debit).Sub(lines[i].Credit)
+		lines[i].Balance = balance
+	}
+
+	response.Set("account", account)
+	response.Set("opening_balance", opening)
+	response.Set("closing_balance", balance)
+	response.Set("list", lines)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// queryPeriod reads ?from= and ?to=, the period defaults to the current year
+func queryPeriod(c echo.Context) (time.Time, time.Time, error) {
+	var err error
+
+	now := time.Now()
+	from := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	if v := c.QueryParam("from"); v != "" {
+		if from, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return from, to, fmt.Errorf("invalid from date")
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return from, to, fmt.Errorf("invalid to date")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("invalid period")
+	}
+
+	return from, to, nil
+}
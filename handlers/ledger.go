@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/go-pg/pg"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// ledgerAccounts describes the accounts the system posts to, by kind
+var ledgerAccounts = map[int]struct {
+	Type int
+	Base int
+}{
+	model.LedgerBank:       {model.AccountAsset, 1000},
+	model.LedgerReceivable: {model.AccountAsset, 1200},
+	model.LedgerWallet:     {model.AccountLiability, 2100},
+	model.LedgerIncome:     {model.AccountIncome, 4000},
+	model.LedgerAllowance:  {model.AccountExpense, 5100},
+	model.LedgerExpense:    {model.AccountExpense, 6000},
+}
+
+// journalEntry collects the lines of a journal before it is posted
+type journalEntry struct {
+	journal model.Journal
+	lines   []journalAmount
+}
+
+// journalAmount is an amount posted to a system account, debits are positive
+type journalAmount struct {
+	Kind   int
+	Ref    string
+	Amount decimal.Decimal
+}
+
+func newJournal(siteID, residentID string, source int, sourceID, narration string, date utils.DateTime) *journalEntry {
+	return &journalEntry{
+		journal: model.Journal{
+			ID:          xid.New().String(),
+			SiteID:      siteID,
+			ResidentID:  residentID,
+			DateTrx:     date,
+			SourceType:  source,
+			SourceID:    sourceID,
+			Narration:   narration,
+			DateCreated: utils.DateTime{}.Now(),
+		},
+	}
+}
+
+// createdBy records who posted the journal
+func (j *journalEntry) createdBy(by model.UserDetails) {
+	j.journal.CreatedBy = by
+}
+
+func (j *journalEntry) debit(kind int, ref string, amount decimal.Decimal) {
+	j.lines = append(j.lines, journalAmount{kind, ref, amount})
+}
+
+func (j *journalEntry) credit(kind int, ref string, amount decimal.Decimal) {
+	j.lines = append(j.lines, journalAmount{kind, ref, amount.Neg()})
+}
+
+// post resolves the accounts and writes the journal, lines to the same account are
+// merged. Journals that do not balance are rejected
+func (j *journalEntry) post(tx *pg.Tx) error {
+	totals := map[string]decimal.Decimal{}
+	order := []string{}
+	sum := decimal.Zero
+
+	for _, l := range j.lines {
+		if l.Amount.IsZero() {
+			continue
+		}
+
+		account, err := ledgerAccount(tx, j.journal.SiteID, l.Kind, l.Ref)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := totals[account.ID]; !ok {
+			order = append(order, account.ID)
+		}
+		totals[account.ID] = totals[account.ID].Add(l.Amount)
+		sum = sum.Add(l.Amount)
+	}
+
+	if !sum.IsZero() {
+		return fmt.Errorf("journal %s does not balance by %s", j.journal.Narration, sum.StringFixed(2))
+	}
+
+	lines := []model.JournalLine{}
+	for _, id := range order {
+		amt := totals[id]
+		if amt.IsZero() {
+			continue
+		}
+
+		line := model.JournalLine{
+			ID:        xid.New().String(),
+			SiteID:    j.journal.SiteID,
+			JournalID: j.journal.ID,
+			AccountID: id,
+		}
+		if amt.Sign() > 0 {
+			line.Debit = amt
+		} else {
+			line.Credit = amt.Neg()
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return insertJournal(tx, &j.journal, lines)
+}
+
+func insertJournal(tx *pg.Tx, journal *model.Journal, lines []model.JournalLine) error {
+	log := utils.Env.Log
+
+	if _, err := tx.Model(journal).Insert(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if len(lines) > 0 {
+		if _, err := tx.Model(&lines).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	journal.Lines = lines
+
+	return nil
+}
+
+// ledgerAccount returns the system account of a kind, creating it when missing. Accounts
+// are created under a lock per site so concurrent postings do not pick the same code
+func ledgerAccount(tx *pg.Tx, siteID string, kind int, ref string) (*model.LedgerAccount, error) {
+	log := utils.Env.Log
+
+	def, ok := ledgerAccounts[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown ledger account kind %d", kind)
+	}
+
+	account := &model.LedgerAccount{}
+	find := func() error {
+		return tx.Model(account).
+			Where("site_id = ? and kind = ? and ref = ?", siteID, kind, ref).
+			Select()
+	}
+
+	err := find()
+	if err == nil {
+		return account, nil
+	}
+	if err != pg.ErrNoRows {
+		log.Debug(err)
+		return nil, err
+	}
+
+	// another transaction may have created the account while this one waited
+	if err := lockLedgerAccounts(tx, siteID); err != nil {
+		return nil, err
+	}
+
+	err = find()
+	if err == nil {
+		return account, nil
+	}
+	if err != pg.ErrNoRows {
+		log.Debug(err)
+		return nil, err
+	}
+
+	account = &model.LedgerAccount{
+		ID:          xid.New().String(),
+		SiteID:      siteID,
+		Type:        def.Type,
+		Kind:        kind,
+		Ref:         ref,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+
+	switch kind {
+	case model.LedgerBank, model.LedgerAllowance:
+		n, _ := strconv.Atoi(ref)
+		account.Code = strconv.Itoa(def.Base + n)
+		account.Name = accountName(kind, n)
+
+	case model.LedgerWallet:
+		account.Code = strconv.Itoa(def.Base)
+		account.Name = "Resident wallets"
+
+	case model.LedgerReceivable, model.LedgerIncome:
+		due := model.Due{}
+		if err := tx.Model(&due).Where("id = ?", ref).Select(); err != nil {
+			log.Debug(err)
+			return nil, err
+		}
+
+		account.Name = due.Name
+		if kind == model.LedgerReceivable {
+			account.Name = fmt.Sprintf("%s receivable", due.Name)
+		}
+
+	case model.LedgerExpense:
+		category := model.ExpenseCategory{}
+		if err := tx.Model(&category).Where("id = ?", ref).Select(); err != nil {
+			log.Debug(err)
+			return nil, err
+		}
+
+		account.Name = category.Name
+	}
+
+	// accounts per due or category are numbered in sequence, skipping codes officials
+	// have given their own accounts
+	if len(account.Code) == 0 {
+		var code int
+		_, err := tx.QueryOne(pg.Scan(&code), `
+			select coalesce(max(code::int), ?) + 1 from ledger_account where site_id = ? and kind = ?
+		`, def.Base, siteID, kind)
+		if err != nil {
+			log.Debug(err)
+			return nil, err
+		}
+
+		for {
+			count, err := tx.Model((*model.LedgerAccount)(nil)).
+				Where("site_id = ? and code = ?", siteID, strconv.Itoa(code)).
+				Count()
+			if err != nil {
+				log.Debug(err)
+				return nil, err
+			}
+			if count == 0 {
+				break
+			}
+			code++
+		}
+
+		account.Code = strconv.Itoa(code)
+	}
+
+	if _, err := tx.Model(account).Insert(); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// lockLedgerAccounts serializes the creation of the accounts of a site, the lock is held
+// until the transaction ends
+func lockLedgerAccounts(tx *pg.Tx, siteID string) error {
+	_, err := tx.Exec("select pg_advisory_xact_lock(hashtext(?))", "ledger_account:"+siteID)
+	if err != nil {
+		utils.Env.Log.Debug(err)
+	}
+
+	return err
+}
+
+func accountName(kind, n int) string {
+	if kind == model.LedgerBank {
+		switch n {
+		case model.ManualPayment:
+			return "Cash"
+		case model.OnlinePayment:
+			return "Online collections"
+		}
+		return "Bank"
+	}
+
+	switch n {
+	case model.CreditNoteCredit:
+		return "Credit notes"
+	case model.CreditNoteDiscount:
+		return "Discounts"
+	}
+	return "Waivers"
+}
+
+// journalInvoice posts an invoice, receivable against income for each due
+func journalInvoice(tx *pg.Tx, invoice *model.Invoice) error {
+	log := utils.Env.Log
+
+	trxs := []model.Transaction{}
+	err := tx.Model(&trxs).
+		Where("invoice_id = ? and type = ? and due_id is not null", invoice.ID, model.TrxInvoice).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	j := newJournal(invoice.SiteID, invoice.ResidentID, model.JournalInvoice, invoice.ID,
+		fmt.Sprintf("Invoice %s", invoice.InvoiceNo), invoice.DateCreated)
+	for _, t := range trxs {
+		j.debit(model.LedgerReceivable, t.DueID, t.Amount.Neg())
+		j.credit(model.LedgerIncome, t.DueID, t.Amount.Neg())
+	}
+
+	return j.post(tx)
+}
+
+// reverseJournals posts the opposite of the open journals of a document
+func reverseJournals(tx *pg.Tx, siteID, sourceID, narration string, by model.UserDetails) error {
+	log := utils.Env.Log
+
+	journals := []model.Journal{}
+	err := tx.Model(&journals).
+		Where("site_id = ? and source_id = ? and reversed = false and reversal_of is null", siteID, sourceID).
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	for i := range journals {
+		if err := reverseJournal(tx, &journals[i], narration, by); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reverseJournal(tx *pg.Tx, journal *model.Journal, narration string, by model.UserDetails) error {
+	log := utils.Env.Log
+
+	if journal.Reversed || len(journal.ReversalOf) > 0 {
+		return errors.New("journal has already been reversed")
+	}
+
+	lines := []model.JournalLine{}
+	if err := tx.Model(&lines).Where("journal_id = ?", journal.ID).Select(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	reversal := &model.Journal{
+		ID:          xid.New().String(),
+		SiteID:      journal.SiteID,
+		ResidentID:  journal.ResidentID,
+		DateTrx:     utils.DateTime{}.Now(),
+		SourceType:  journal.SourceType,
+		SourceID:    journal.SourceID,
+		Narration:   fmt.Sprintf("%s: %s", narration, journal.Narration),
+		ReversalOf:  journal.ID,
+		CreatedBy:   by,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+
+	for i := range lines {
+		lines[i].ID = xid.New().String()
+		lines[i].JournalID = reversal.ID
+		lines[i].Debit, lines[i].Credit = lines[i].Credit, lines[i].Debit
+	}
+
+	if err := insertJournal(tx, reversal, lines); err != nil {
+		return err
+	}
+
+	journal.Reversed = true
+	_, err := tx.Model(journal).Column("reversed").WherePK().Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// BeforeSaveLedgerAccount officials add their own accounts to the chart of accounts,
+// accounts the system posts to can only be renamed
+func BeforeSaveLedgerAccount(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.LedgerAccount)
+
+	record.Code = strings.TrimSpace(record.Code)
+	record.Name = strings.TrimSpace(record.Name)
+	if len(record.Name) == 0 {
+		return true, errors.New("account name is required")
+	}
+
+	if err := lockLedgerAccounts(tx, siteID); err != nil {
+		return true, err
+	}
+
+	count, err := tx.Model((*model.LedgerAccount)(nil)).
+		Where("site_id = ? and code = ? and id <> ?", siteID, record.Code, oid).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, fmt.Errorf("account code %s is already used", record.Code)
+	}
+
+	if len(oid) > 0 && oid != "new" {
+		account := model.LedgerAccount{}
+		err := tx.Model(&account).Where("id = ? and site_id = ?", oid, siteID).Select()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		columns := []string{"name"}
+		if account.Kind == model.LedgerOther {
+			columns = append(columns, "code", "type")
+		}
+
+		_, err = tx.Model(record).
+			Column(columns...).
+			Where("id = ? and site_id = ?", oid, siteID).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	if len(record.Code) == 0 {
+		return true, errors.New("account code is required")
+	}
+	if record.Type < model.AccountAsset || record.Type > model.AccountExpense {
+		return true, errors.New("invalid account type")
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.Kind = model.LedgerOther
+	record.Ref = ""
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+// DeleteLedgerAccount accounts with postings or used by the system are kept
+func DeleteLedgerAccount(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	account := model.LedgerAccount{}
+	err = tx.Model(&account).Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).Select()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	if account.Kind != model.LedgerOther {
+		return true, errors.New("system accounts cannot be deleted")
+	}
+
+	count, err := tx.Model((*model.JournalLine)(nil)).Where("account_id = ?", account.ID).Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, errors.New("account has postings")
+	}
+
+	return false, nil
+}
+
+// BeforeSaveJournal posts a manual journal (adjustments, penalties, opening balances),
+// journals cannot be changed once posted
+func BeforeSaveJournal(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	oid := c.Param("id")
+	if len(oid) > 0 && oid != "new" {
+		return true, errors.New("posted journals cannot be changed, reverse them instead")
+	}
+
+	siteID := getSiteID(c)
+	record := frm.(*model.Journal)
+
+	if len(record.Lines) < 2 {
+		return true, errors.New("a journal needs at least two lines")
+	}
+
+	debit := decimal.Zero
+	credit := decimal.Zero
+	for _, l := range record.Lines {
+		if l.Debit.Sign() < 0 || l.Credit.Sign() < 0 || (l.Debit.Sign() > 0) == (l.Credit.Sign() > 0) {
+			return true, errors.New("each line needs either a debit or a credit")
+		}
+
+		count, err := tx.Model((*model.LedgerAccount)(nil)).
+			Where("id = ? and site_id = ?", l.AccountID, siteID).
+			Count()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+		if count == 0 {
+			return true, errors.New("unknown account")
+		}
+
+		debit = debit.Add(l.Debit)
+		credit = credit.Add(l.Credit)
+	}
+	if !debit.Equal(credit) {
+		return true, fmt.Errorf("journal does not balance, debits %s credits %s", debit.StringFixed(2), credit.StringFixed(2))
+	}
+
+	journal := &model.Journal{
+		ID:         xid.New().String(),
+		SiteID:     siteID,
+		ResidentID: record.ResidentID,
+		DateTrx:    record.DateTrx,
+		SourceType: model.JournalManual,
+		Narration:  record.Narration,
+		CreatedBy: model.UserDetails{
+			UserID:   ses.String("admin_id"),
+			UserType: ses.Int("admin_type"),
+			Name:     ses.String("admin_name"),
+		},
+		DateCreated: utils.DateTime{}.Now(),
+	}
+	if journal.DateTrx.IsZero() {
+		journal.DateTrx = journal.DateCreated
+	}
+
+	lines := []model.JournalLine{}
+	for _, l := range record.Lines {
+		lines = append(lines, model.JournalLine{
+			ID:        xid.New().String(),
+			SiteID:    siteID,
+			JournalID: journal.ID,
+			AccountID: l.AccountID,
+			Debit:     l.Debit,
+			Credit:    l.Credit,
+		})
+	}
+
+	if err := insertJournal(tx, journal, lines); err != nil {
+		return true, err
+	}
+
+	resp.Set("id", journal.ID)
+
+	return true, nil
+}
+
+// DeleteJournal journals are never deleted, a reversing journal is posted instead
+func DeleteJournal(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	journal := model.Journal{}
+	err = tx.Model(&journal).
+		Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	if journal.SourceType != model.JournalManual {
+		return true, errors.New("only manual journals can be reversed")
+	}
+
+	by := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+	if err := reverseJournal(tx, &journal, "Reversal", by); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
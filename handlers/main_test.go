@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+
+	"eve/utils"
+
+	"github.com/go-ini/ini"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	cfg := ini.Empty()
+	cfg.Section("gate").Key("qr_secret").SetValue("test-qr-secret")
+
+	utils.Env.Log = zap.NewNop().Sugar()
+	utils.Env.Cfg = utils.NewConfig(cfg)
+
+	os.Exit(m.Run())
+}
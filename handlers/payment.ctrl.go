@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"eve/service/gateway"
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// InitializePayment starts an online payment with /pay/:provider, the client completes
+// it at the returned authorization url
+func (s *Controller) InitializePayment(c echo.Context) error {
+	provider, found := model.GetProviderByName(c.Param("provider"))
+	if !found {
+		return et.APIError(c, fmt.Errorf("unknown provider"), http.StatusNotFound)
+	}
+
+	form := model.InitializePaymentRequest{}
+	if err := c.Bind(&form); err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	return s.initializePayment(c, provider.Value, form)
+}
+
+func (s *Controller) initializePayment(c echo.Context, id model.PayProvider, form model.InitializePaymentRequest) error {
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	if form.Amount.Sign() <= 0 {
+		return et.APIError(c, fmt.Errorf("invalid amount"), http.StatusBadRequest)
+	}
+
+	// the webhook finds the resident from the metadata
+	metadata := map[string]interface{}{}
+	if len(form.Metadata) > 0 {
+		if err := json.Unmarshal(form.Metadata, &metadata); err != nil {
+			return et.APIError(c, err, http.StatusBadRequest)
+		}
+	}
+	metadata["site_id"] = ses.String("admin_site_id")
+	metadata["resident_id"] = ses.String("admin_id")
+
+	gw, err := siteGateway(s.env.Dbc, ses.String("admin_site_id"), id)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	// flutterwave and remita need the reference of the order
+	if len(form.Reference) == 0 {
+		form.Reference = xid.New().String()
+	}
+
+	res, err := gw.Initialize(gateway.InitRequest{
+		Reference:   form.Reference,
+		Email:       form.Email,
+		Name:        form.Name,
+		Phone:       form.Phone,
+		Amount:      form.Amount,
+		Description: form.Description,
+		CallbackURL: form.CallbackURL,
+		Metadata:    metadata,
+	})
+	if err != nil {
+		s.log.Debug(err)
+		return et.APIError(c, err, http.StatusBadGateway)
+	}
+
+	response.SetStore(res)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
@@ -80,7 +80,7 @@ func SavePayment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, r
 	}
 
 	// store for verification data received from api
-	var metadata interface{}
+	var metadata json.RawMessage
 
 	if apiForm.PayMode == model.BankTransaction && usrType == model.ResidentUser {
 		log.Debug("Here 1")
@@ -100,42 +100,58 @@ func SavePayment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, r
 	if payment.PayMode == model.OnlinePayment && usrType == model.ResidentUser {
 		log.Debug("Here 2")
 
-		var ref string
 		provider := model.GetProvider(attrEntity.ProviderID)
 		log.Debug("provider", provider)
 		attrEntity.ProviderName = provider.Name
-		field := fmt.Sprintf("%s_secret", provider.Name)
 
-		secretKey, err := utils.Getkey("testpayments", field)
+		gw, err := siteGateway(tx, siteID, provider.Value)
 		if err != nil {
-			return false, err
+			return true, err
 		}
 
-		if provider.Value == model.ProviderPaystack {
-			ref = attrEntity.ReferenceID
-		}
+		// flutterwave payments are verified by transaction id
+		ref := attrEntity.ReferenceID
 		if provider.Value == model.ProviderFlutterwave {
 			ref = attrEntity.TransactionID
 		}
 
-		url, err := provider.GetURL(ref)
+		charge, err := gw.Verify(ref)
 		if err != nil {
-			return false, err
-		}
-
-		response, err := utils.VerifyPayment(url, secretKey)
-		if err != nil {
-			return false, err
+			log.Debug(err)
+			return true, errors.New("could not verify transaction")
 		}
-
-		json.Unmarshal(response, &metadata)
-
-		if !handleResponse(response, provider.Value) {
+		if !charge.Success {
 			return true, errors.New("could not verify transaction")
 		}
+		if !charge.Amount.Equal(payment.Amount) {
+			return true, fmt.Errorf("amount paid (%s) does not match the payment", charge.Amount.StringFixed(2))
+		}
+		metadata = charge.Raw
 
-		payment.Metadata, _ = json.Marshal(metadata)
+		payment.Metadata = metadata
 		payment.Attr, _ = json.Marshal(attrEntity)
+		payment.ProviderID = provider.Value
+		payment.ProviderRef = charge.Reference
+
+		// the provider webhook may have recorded the payment already
+		if len(oid) == 0 || oid == "new" {
+			if err := lockProviderRef(tx, provider.Value, charge.Reference); err != nil {
+				return true, err
+			}
+
+			existing := model.Payment{}
+			err := tx.Model(&existing).
+				Where("provider_id = ? and provider_ref = ?", provider.Value, charge.Reference).
+				Select()
+			if err == nil {
+				resp.Set("id", existing.ID)
+				return true, nil
+			}
+			if err != pg.ErrNoRows {
+				log.Debug(err)
+				return true, err
+			}
+		}
 
 		if err = handleValidPayment(ses, oid, siteID, invDues, *apiForm, payment, tx, log); err != nil {
 			return true, err
@@ -187,11 +203,11 @@ func BeforeListPayment(c echo.Context, filter *utils.Options, resp *utils.Respon
 	return false, nil
 }
 
-// DeletePayment ...
+// DeletePayment payments are not removed, deleting one requests its reversal. The reason
+// is taken from the reason query parameter
 func DeletePayment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
 
 	log := utils.Env.Log
-	dbc := utils.Env.Db
 
 	ses, err := et.NewSessionMgr(c, "")
 	if err != nil {
@@ -200,87 +216,26 @@ func DeletePayment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Resp
 	}
 
 	usrType := ses.Int("admin_type")
-	if usrType < 5 {
+	if usrType < model.OfficialUser {
 		err := fmt.Errorf("Access denied")
 		return true, err
 	}
 
-	siteID := getSiteID(c)
-	oid := c.Param("id")
-
-	payment := model.Payment{}
-
-	if err := dbc.Model(&payment).Where("id = ? ", oid).Select(); err != nil {
-		return true, errors.New("invalid transaction")
+	reason := c.QueryParam("reason")
+	if len(reason) == 0 {
+		reason = "Deleted Payment Record"
 	}
 
-	res := model.Resident{}
-	if err := tx.Model(&res).Where("id = ?", payment.ResidentID).Select(); err != nil {
-		return false, err
-	}
-
-	payLog := &model.PaymentLog{
-		ID:        xid.New().String(),
-		SiteID:    siteID,
-		Operation: string(model.PaymentDelete),
-		Amount:    payment.Amount,
-
-		InitiatedBY: model.UserDetails{
-			UserID:   ses.String("admin_id"),
-			UserType: ses.Int("admin_type"),
-			Name:     ses.String("admin_name"),
-		},
-
-		InitiatedFor: model.UserDetails{
-			UserID:   res.ID,
-			UserType: model.ResidentUser,
-			Name:     fmt.Sprintf("%s %s", res.FirstName, res.LastName),
-		},
-		Narration: "Deleted Payment Record",
-	}
-
-	_, err = tx.Model(payLog).Insert()
-	if err != nil {
-		return false, err
-	}
-
-	// ensure cannot delete online transactions
-	if payment.PayMode == model.OnlinePayment {
-		err := errors.New("Cannot delete online payments")
-		return true, err
-	}
-
-	// delete related transaction records
-	_, err = tx.Exec("delete from transaction where site_id = ? and payment_id = ? and type=1", siteID, oid)
+	reversal, err := requestReversal(tx, ses, getSiteID(c), c.Param("id"), reason)
 	if err != nil {
-		log.Debug(err)
 		return true, err
 	}
 
-	return false, nil
-
-}
-
-func handleResponse(response []byte, provider model.PayProvider) bool {
-	log := utils.Env.Log
+	resp.Set("reversal_id", reversal.ID)
+	resp.Set("status", reversal.Status)
 
-	switch provider {
-	case model.ProviderPaystack:
-		value := model.PaystackResponse{}
-		json.Unmarshal(response, &value)
-		if value.Status {
-			return true
-		}
+	return true, nil
 
-	case model.ProviderFlutterwave:
-		value := model.FlutterwaveResponse{}
-		json.Unmarshal(response, &value)
-		log.Debugf("%+v", value)
-		if value.Status == "success" {
-			return true
-		}
-	}
-	return false
 }
 
 func handleValidPayment(ses *et.SessionMgr, oid, siteID string, invDues []InvDue, apiForm form.PaymentForm, payment *model.Payment, tx *pg.Tx, log *zap.SugaredLogger) error {
@@ -298,7 +253,18 @@ func handleValidPayment(ses *et.SessionMgr, oid, siteID string, invDues []InvDue
 		}
 
 	} else {
-		_, err := tx.Model(payment).
+		count, err := tx.Model((*model.Payment)(nil)).
+			Where("id = ? and status <> ?", payment.ID, model.PaymentActive).
+			Count()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+		if count > 0 {
+			return errors.New("reversed payments cannot be changed")
+		}
+
+		_, err = tx.Model(payment).
 			Column("date_trx", "amount", "attr").
 			WherePK().
 			Update()
@@ -313,26 +279,29 @@ func handleValidPayment(ses *et.SessionMgr, oid, siteID string, invDues []InvDue
 			log.Debug(err)
 			return err
 		}
-	}
 
-	for _, i := range invDues {
-		trx := &model.Transaction{
-			ID:         xid.New().String(),
-			SiteID:     siteID,
-			Type:       1,
-			ResidentID: payment.ResidentID,
-			PaymentID:  payment.ID,
-			DateTrx:    apiForm.DateTrx,
-			DueID:      i.DueID,
-			Amount:     i.Amount,
+		by := model.UserDetails{
+			UserID:   ses.String("admin_id"),
+			UserType: ses.Int("admin_type"),
+			Name:     ses.String("admin_name"),
 		}
-		_, err := tx.Model(trx).Insert()
-		if err != nil {
-			log.Debug(err)
+		if err := reverseJournals(tx, siteID, payment.ID, "Payment updated", by); err != nil {
+			return err
+		}
+
+		if err := releaseWallet(tx, siteID, payment.ResidentID, payment.ID, by); err != nil {
+			return err
+		}
+
+		if err := releaseInstallments(tx, payment.ID); err != nil {
 			return err
 		}
 	}
 
+	if err := allocatePayment(tx, payment, apiForm.DateTrx, invDues); err != nil {
+		return err
+	}
+
 	res := model.Resident{}
 	if err := tx.Model(&res).Where("id = ?", payment.ResidentID).Select(); err != nil {
 		return err
@@ -399,6 +368,7 @@ func handleBankTransaction(form form.PaymentForm, siteID string, ses *et.Session
 		Narration:    "Bank Transaction",
 		Amount:       form.Amount,
 		PayMode:      model.BankTransaction,
+		Allocation:   form.Allocation,
 		Dues:         form.Dues,
 		Attr:         form.Attr,
 	}
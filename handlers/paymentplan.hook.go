@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"eve/service/model"
+	"eve/service/view"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// BeforeSavePaymentPlan creates a payment plan with its installment schedule, existing
+// plans can only have their note and status changed
+func BeforeSavePaymentPlan(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.PaymentPlan)
+
+	if len(oid) > 0 && oid != "new" {
+		if record.Status != model.PlanActive && record.Status != model.PlanCancelled {
+			return true, errors.New("a payment plan can only be cancelled")
+		}
+
+		_, err := tx.Model(record).
+			Column("status", "note").
+			Where("id = ? and site_id = ? and status = ?", oid, siteID, model.PlanActive).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	// the resident must live on the site, arrears default to the residents current debt
+	summary := view.ResidentBillingSummary{}
+	err = tx.Model(&summary).
+		Where("id = ? and site_id = ?", record.ResidentID, siteID).
+		Select()
+	if err == pg.ErrNoRows {
+		return true, errors.New("unknown resident")
+	}
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	count, err := tx.Model((*model.PaymentPlan)(nil)).
+		Where("resident_id = ? and site_id = ? and status = ?", record.ResidentID, siteID, model.PlanActive).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, errors.New("resident already has an active payment plan")
+	}
+
+	if record.Arrears.Sign() <= 0 {
+		record.Arrears = summary.Balance.Neg()
+	}
+	if record.Arrears.Sign() <= 0 {
+		return true, errors.New("resident has no arrears")
+	}
+
+	if record.Installments < 1 || record.Installments > 60 {
+		return true, errors.New("installments must be between 1 and 60")
+	}
+	if record.Frequency < 1 {
+		record.Frequency = 1
+	}
+	if record.StartDate.IsZero() {
+		record.StartDate = utils.DateTime{}.Now()
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.Status = model.PlanActive
+	record.DateCreated = utils.DateTime{}.Now()
+	record.CreatedBy = model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	// equal installments, the last one takes the rounding difference
+	n := decimal.New(int64(record.Installments), 0)
+	amount := record.Arrears.Div(n).Truncate(2)
+	last := record.Arrears.Sub(amount.Mul(decimal.New(int64(record.Installments-1), 0)))
+
+	for i := 0; i < record.Installments; i++ {
+		inst := model.PaymentPlanInstallment{
+			ID:         xid.New().String(),
+			SiteID:     siteID,
+			PlanID:     record.ID,
+			ResidentID: record.ResidentID,
+			Number:     i + 1,
+			DueDate:    utils.NewDateTime(record.StartDate.AddDate(0, i*record.Frequency, 0)),
+			Amount:     amount,
+			Status:     model.InstallmentPending,
+		}
+		if i == record.Installments-1 {
+			inst.Amount = last
+		}
+
+		if _, err := tx.Model(&inst).Insert(); err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		record.Schedule = append(record.Schedule, inst)
+	}
+
+	resp.Set("id", record.ID)
+	resp.Set("schedule", record.Schedule)
+
+	return true, nil
+}
+
+// DeletePaymentPlan plans that have received payments are cancelled, not deleted
+func DeletePaymentPlan(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	count, err := tx.Model((*model.PaymentPlanInstallment)(nil)).
+		Where("plan_id = ? and paid > 0", c.Param("id")).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 {
+		return true, errors.New("payment plan has received payments, cancel it instead")
+	}
+
+	return false, nil
+}
+
+// BeforeListPaymentPlan ...
+func BeforeListPaymentPlan(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") == model.ResidentUser {
+		residentID, err := walletResidentID(dbc, ses)
+		if err != nil {
+			log.Debug(err)
+			return false, err
+		}
+
+		(*filter)["resident_id"] = residentID
+	}
+
+	return false, nil
+}
+
+// BeforeSavePaymentPlanInstallment installments change only through the plan and payments
+func BeforeSavePaymentPlanInstallment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	err := fmt.Errorf("Access denied")
+	return true, err
+}
+
+// DeletePaymentPlanInstallment ...
+func DeletePaymentPlanInstallment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	err := fmt.Errorf("Access denied")
+	return true, err
+}
+
+// matchInstallments applies a payment to the residents active plan, oldest installment
+// first, and records what went to each installment so it can be released
+func matchInstallments(tx *pg.Tx, payment *model.Payment) error {
+	log := utils.Env.Log
+
+	plan := model.PaymentPlan{}
+	err := tx.Model(&plan).
+		Where("resident_id = ? and site_id = ? and status = ?", payment.ResidentID, payment.SiteID, model.PlanActive).
+		For("update").
+		Select()
+	if err == pg.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	installments := []model.PaymentPlanInstallment{}
+	err = tx.Model(&installments).
+		Where("plan_id = ? and status <> ?", plan.ID, model.InstallmentPaid).
+		Order("number").
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	left := payment.Amount
+	open := len(installments)
+	for _, i := range installments {
+		if left.Sign() <= 0 {
+			break
+		}
+
+		amt := decimal.Min(left, i.Amount.Sub(i.Paid))
+		i.Paid = i.Paid.Add(amt)
+		left = left.Sub(amt)
+
+		if i.Paid.GreaterThanOrEqual(i.Amount) {
+			i.Status = model.InstallmentPaid
+			i.DatePaid = utils.DateTime{}.Now()
+			open--
+		}
+
+		_, err := tx.Model(&i).
+			Column("paid", "status", "date_paid").
+			WherePK().
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		match := &model.PaymentPlanPayment{
+			ID:            xid.New().String(),
+			SiteID:        payment.SiteID,
+			PlanID:        plan.ID,
+			InstallmentID: i.ID,
+			PaymentID:     payment.ID,
+			Amount:        amt,
+			DateCreated:   utils.DateTime{}.Now(),
+		}
+		if _, err := tx.Model(match).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	if open == 0 {
+		plan.Status = model.PlanCompleted
+		_, err := tx.Model(&plan).Column("status").WherePK().Update()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseInstallments takes a payment off the installments it was applied to, before the
+// payment is edited or reversed. Installments are pending again so the payment plan
+// monitor flags them when they are overdue, and a completed plan is active again
+func releaseInstallments(tx *pg.Tx, paymentID string) error {
+	log := utils.Env.Log
+
+	matches := []model.PaymentPlanPayment{}
+	err := tx.Model(&matches).Where("payment_id = ?", paymentID).Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	plans := map[string]bool{}
+	for _, m := range matches {
+		_, err := tx.Exec(`
+			update payment_plan_installment set
+				paid = paid - ?, status = ?, date_paid = null, date_notified = null
+			where
+				id = ?
+		`, m.Amount, model.InstallmentPending, m.InstallmentID)
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		plans[m.PlanID] = true
+	}
+
+	// a resident has one active plan, a completed plan stays completed when a new one
+	// was agreed since
+	for planID := range plans {
+		_, err := tx.Exec(`
+			update payment_plan as p set
+				status = ?
+			where
+				p.id = ? and p.status = ? and not exists (
+					select 1 from payment_plan as a where a.resident_id = p.resident_id and a.status = ?
+				)
+		`, model.PlanActive, planID, model.PlanCompleted, model.PlanActive)
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	if _, err := tx.Model((*model.PaymentPlanPayment)(nil)).Where("payment_id = ?", paymentID).Delete(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return nil
+}
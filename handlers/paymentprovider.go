@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+
+	"eve/service/gateway"
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+// siteGateway returns the payment provider of a site, configured with the sites own keys
+// when it has them and the platform keys otherwise
+func siteGateway(db orm.DB, siteID string, id model.PayProvider) (gateway.PaymentProvider, error) {
+	keys, err := siteKeys(db, siteID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return gateway.New(id, keys)
+}
+
+// siteKeys returns the keys a site uses with a provider
+func siteKeys(db orm.DB, siteID string, id model.PayProvider) (gateway.Keys, error) {
+	log := utils.Env.Log
+
+	if len(siteID) > 0 {
+		keys := model.SitePaymentProvider{}
+		err := db.Model(&keys).
+			Where("site_id = ? and provider_id = ? and active", siteID, id).
+			Select()
+		if err == nil {
+			return gateway.Keys{
+				Public:        keys.PublicKey,
+				Secret:        keys.SecretKey,
+				Encryption:    keys.EncryptionKey,
+				WebhookHash:   keys.WebhookHash,
+				MerchantID:    keys.MerchantID,
+				ServiceTypeID: keys.ServiceTypeID,
+				Live:          keys.Live,
+			}, nil
+		}
+		if err != pg.ErrNoRows {
+			log.Debug(err)
+			return gateway.Keys{}, err
+		}
+	}
+
+	return platformKeys(model.GetProvider(id))
+}
+
+// platformKeys reads the keys of a provider from the config section named by ProviderSection
+func platformKeys(provider model.PayEntity) (gateway.Keys, error) {
+	keys := gateway.Keys{}
+
+	if len(provider.Name) == 0 {
+		return keys, fmt.Errorf("unknown payment provider")
+	}
+
+	section, err := utils.Getkey("", "ProviderSection")
+	if err != nil {
+		return keys, err
+	}
+
+	key := func(name string) string {
+		return utils.Env.Cfg.Section(section).Key(fmt.Sprintf("%s_%s", provider.Name, name)).String()
+	}
+
+	keys.Public = key("public")
+	keys.Secret = key("secret")
+	keys.Encryption = key("encryption_key")
+	keys.WebhookHash = key("webhook_hash")
+	keys.MerchantID = key("merchant_id")
+	keys.ServiceTypeID = key("service_type_id")
+	keys.Live = key("live") == "true"
+
+	return keys, nil
+}
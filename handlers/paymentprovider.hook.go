@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// secrets are never sent back, only their last characters
+const maskedKey = "********"
+
+// BeforeSaveSitePaymentProvider officials set the keys their site uses with a provider,
+// secrets left blank (or masked) keep their current value
+func BeforeSaveSitePaymentProvider(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.SitePaymentProvider)
+
+	switch record.ProviderID {
+	case model.ProviderPaystack, model.ProviderFlutterwave, model.ProviderRemita:
+	default:
+		return true, errors.New("keys can only be set for paystack, flutterwave and remita")
+	}
+
+	if len(oid) > 0 && oid != "new" {
+		current := model.SitePaymentProvider{}
+		err := tx.Model(&current).Where("id = ? and site_id = ?", oid, siteID).Select()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		keepKey(&record.SecretKey, current.SecretKey)
+		keepKey(&record.EncryptionKey, current.EncryptionKey)
+		keepKey(&record.WebhookHash, current.WebhookHash)
+
+		_, err = tx.Model(record).
+			Column("provider_id", "public_key", "secret_key", "encryption_key", "webhook_hash",
+				"merchant_id", "service_type_id", "live", "active").
+			Where("id = ? and site_id = ?", oid, siteID).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	if len(record.SecretKey) == 0 {
+		return true, errors.New("secret key is required")
+	}
+	if record.ProviderID == model.ProviderRemita && (len(record.MerchantID) == 0 || len(record.ServiceTypeID) == 0) {
+		return true, errors.New("remita needs a merchant id and a service type id")
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+// AfterReadSitePaymentProvider ...
+func AfterReadSitePaymentProvider(c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) error {
+	maskKeys(frm.(*model.SitePaymentProvider))
+	return nil
+}
+
+// AfterListSitePaymentProvider ...
+func AfterListSitePaymentProvider(c echo.Context, data interface{}, resp *utils.Response) error {
+	records := data.(*[]model.SitePaymentProvider)
+	for i := range *records {
+		maskKeys(&(*records)[i])
+	}
+
+	return nil
+}
+
+func maskKeys(record *model.SitePaymentProvider) {
+	for _, k := range []*string{&record.SecretKey, &record.EncryptionKey, &record.WebhookHash} {
+		if len(*k) > 8 {
+			*k = maskedKey + (*k)[len(*k)-4:]
+		} else if len(*k) > 0 {
+			*k = maskedKey
+		}
+	}
+}
+
+func keepKey(key *string, current string) {
+	if len(*key) == 0 || strings.HasPrefix(*key, maskedKey) {
+		*key = current
+	}
+}
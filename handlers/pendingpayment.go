@@ -78,49 +78,56 @@ func SavePendingPayment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfa
 		return false, err
 	}
 
+	if _, err := postBankPayment(tx, ses, pendingPay, utils.DateTime{}.Now()); err != nil {
+		return true, err
+	}
+
+	// deleting item from the pending payment table
+	_, err = tx.Model(pendingPay).Where("id = ?", pendingPay.ID).Delete()
+
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	return true, nil
+}
+
+// postBankPayment turns a bank transfer into a payment: the payment is allocated to the
+// residents dues, logged and a receipt is emailed. The pending record is not removed
+func postBankPayment(tx *pg.Tx, ses *et.SessionMgr, pendingPay *model.PaymentPending, dateTrx utils.DateTime) (*model.Payment, error) {
+	log := utils.Env.Log
+
 	payment := &model.Payment{
 		ID:         xid.New().String(),
 		ResidentID: pendingPay.ResidentID,
 		SiteID:     pendingPay.SiteID,
+		DateTrx:    dateTrx,
 		Narration:  fmt.Sprintf("approved %s", pendingPay.Narration),
 		Amount:     pendingPay.Amount,
 		Attr:       pendingPay.Attr,
 		Dues:       pendingPay.Dues,
 		PayMode:    model.BankTransaction,
+		Allocation: pendingPay.Allocation,
 	}
-	_, err = tx.Model(payment).Insert()
+	_, err := tx.Model(payment).Insert()
 
 	if err != nil {
 		log.Debug(err)
-		return true, err
+		return nil, err
 	}
 
 	invDues := []InvDue{}
-	if err := json.Unmarshal(pendingPay.Dues, &invDues); err != nil {
-		log.Debug(err)
-		return false, err
-	}
-	log.Debugf("%+v", invDues)
-
-	// insert transaction records
-	for _, i := range invDues {
-		trx := &model.Transaction{
-			ID:         xid.New().String(),
-			SiteID:     pendingPay.SiteID,
-			Type:       1,
-			ResidentID: payment.ResidentID,
-			PaymentID:  payment.ID,
-			DateTrx:    utils.DateTime{}.Now(),
-			DueID:      i.DueID,
-			Amount:     i.Amount,
-		}
-		_, err := tx.Model(trx).Insert()
-		if err != nil {
+	if len(pendingPay.Dues) > 0 {
+		if err := json.Unmarshal(pendingPay.Dues, &invDues); err != nil {
 			log.Debug(err)
-			return true, err
+			return nil, err
 		}
 	}
-	log.Debug("AA", pendingPay)
+
+	if err := allocatePayment(tx, payment, dateTrx, invDues); err != nil {
+		return nil, err
+	}
 
 	payLog := &model.PaymentLog{
 		ID:        xid.New().String(),
@@ -145,21 +152,14 @@ func SavePendingPayment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfa
 
 	if err != nil {
 		log.Debug(err)
-		return false, err
-	}
-	// deleting item from the pending payment table
-	_, err = tx.Model(pendingPay).Where("id = ?", pendingPay.ID).Delete()
-
-	if err != nil {
-		log.Debug(err)
-		return true, err
+		return nil, err
 	}
 
 	// email receipt
 	eml, err := shared.MakeReceipt(tx, payment.ID)
 	if err != nil {
 		log.Debug(err)
-		return false, err
+		return nil, err
 	}
 	// eml.Text = ""
 	_, err = tx.Exec(`
@@ -168,8 +168,8 @@ func SavePendingPayment(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfa
 	`, pendingPay.SiteID, &eml)
 	if err != nil {
 		log.Debug(err)
-		return false, err
+		return nil, err
 	}
 
-	return true, nil
+	return payment, nil
 }
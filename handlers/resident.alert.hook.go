@@ -26,6 +26,26 @@ func BeforeResidentSaveAlerts(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm i
 	usrID := ses.String("admin_id")
 	siteID := ses.String("admin_site_id")
 
+	if oid := c.Param("id"); len(oid) > 0 && oid != "new" {
+		current := model.ResidentAlerts{}
+		if err := tx.Model(&current).Where("id = ? and site_id = ?", oid, siteID).Select(); err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		// the escalation is kept by the server, only the status and notes are edited
+		data.TimeLogged = current.TimeLogged
+		data.TimeResponded = current.TimeResponded
+		data.RespondedBy = current.RespondedBy
+		data.TimeResolved = current.TimeResolved
+		data.ResolvedBy = current.ResolvedBy
+		data.EscalationLevel = current.EscalationLevel
+		data.TimeEscalated = current.TimeEscalated
+		stampAlertStatus(data, data.Status, usrID)
+
+		return false, nil
+	}
+
 	residentAlert := []model.ResidentAlerts{}
 
 	err = dbc.Model(&residentAlert).
@@ -42,7 +62,31 @@ func BeforeResidentSaveAlerts(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm i
 
 	if len(residentAlert) == 0 {
 		data.Status = model.AlertSent
+		data.TimeResponded = utils.DateTime{}
+	}
+
+	if err := prepareAlert(tx, data); err != nil {
+		return true, err
+	}
+
+	return false, nil
+}
+
+// AfterSaveResidentAlerts sends new alerts and status changes to security and the resident
+func AfterSaveResidentAlerts(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	data := frm.(*model.ResidentAlerts)
+
+	eventType := "alert.status"
+	if oid := c.Param("id"); len(oid) == 0 || oid == "new" {
+		eventType = "alert.new"
+	}
+
+	data.SiteID = getSiteID(c)
+	publish, err := publishAlert(tx, eventType, data)
+	if err != nil {
+		return false, err
 	}
+	et.AfterCommit(c, publish)
 
 	return false, nil
 }
@@ -33,7 +33,7 @@ func (s *Controller) GetResidentDues(c echo.Context) error {
 				resident_due_status
 
 			where
-				id = ?
+				id = ? and due_id is not null
 		`,
 		resID,
 	)
@@ -351,8 +351,15 @@ func BeforeAccountHistoryList(c echo.Context, filter *utils.Options, resp *utils
 		return false, err
 	}
 
+	wallet, err := walletSummary(dbc, residentID)
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
 	resp.Set("list", records)
 	resp.Set("count", res.RowsReturned())
+	resp.Set("wallet", wallet)
 
 	return true, nil
 }
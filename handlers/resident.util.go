@@ -4,11 +4,14 @@ import (
 	"eve/service/form"
 	"eve/service/model"
 	"eve/service/view"
+	"eve/shared"
 	"eve/utils"
 	et "eve/utils/echotools"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-pg/pg"
@@ -32,10 +35,35 @@ var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin:     func(r *http.Request) bool { return true },
+		CheckOrigin:     checkOrigin,
 	}
 )
 
+// checkOrigin browsers may only open the websocket from the frontends in the [url] origin
+// setting or the api host itself, the apps send no origin
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, o := range utils.Env.Cfg.Section("url").Key("origin").Strings(",") {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Initialize ...
 func (s *ResidentUtil) Initialize(env *et.Env) error {
 	s.env = env
@@ -67,6 +95,9 @@ func (s *ResidentUtil) Initialize(env *et.Env) error {
 	grp.GET("/alert_count", s.CountAlertUsingStatus)
 	grp.GET("/get_last_alert", s.GetLastResidentAlert)
 	grp.POST("/update_push_notification", s.UpdatePushNotification)
+	grp.GET("/wallet", s.GetWallet)
+	grp.POST("/wallet", s.UpdateWallet)
+	grp.POST("/wallet/apply", s.ApplyWallet)
 
 	return nil
 
@@ -314,12 +345,24 @@ func (s *ResidentUtil) UpdateResidentAlert(c echo.Context) error {
 	}
 
 	if model.ResidentAlert(form.Status) <= model.ResidentAlert(model.AlertCompleted) {
-		residentAlert.Status = model.ResidentAlert(form.Status)
+		stampAlertStatus(&residentAlert, model.ResidentAlert(form.Status), ses.String("admin_id"))
 		residentAlert.Attr = form.Attr
 	}
 
-	_, err = dbc.Model(&residentAlert).Set("status=?status, attr=?attr").
-		Where("id = ?id").Update()
+	_, err = dbc.Model(&residentAlert).
+		Column("status", "attr", "time_responded", "responded_by", "time_resolved", "resolved_by").
+		WherePK().Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	publish, err := publishAlert(dbc, "alert.status", &residentAlert)
+	if err != nil {
+		log.Debug(err)
+	} else {
+		publish()
+	}
 
 	response.Set("message", "alert status updated")
 	if err := c.JSON(http.StatusOK, response); err != nil {
@@ -378,13 +421,19 @@ func (s *ResidentUtil) SaveResidentAlert(c echo.Context) error {
 		ID:            xid.New().String(),
 		SiteID:        siteID,
 		ResidentID:    usrID,
-		TimeLogged:    currentTime,
-		TimeResponded: currentTime,
-		Status:        model.ResidentAlert(form.Status),
-		Attr:          form.Attr,
-		Name:          resident.Name,
-		Address:       resident.Unit,
-		PhoneNumber:   resident.Phone,
+		TimeLogged:  currentTime,
+		Status:      model.ResidentAlert(form.Status),
+		Attr:        form.Attr,
+		Name:        resident.Name,
+		Address:     resident.Unit,
+		PhoneNumber: resident.Phone,
+		Category:    form.Category,
+		Note:        form.Note,
+		Photos:      form.Photos,
+	}
+
+	if err := prepareAlert(dbc, &residentAlert); err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
 	}
 
 	_, err = dbc.Model(&residentAlert).Insert()
@@ -392,8 +441,22 @@ func (s *ResidentUtil) SaveResidentAlert(c echo.Context) error {
 		return err
 	}
 
+	publish, err := publishAlert(dbc, "alert.new", &residentAlert)
+	if err != nil {
+		log.Debug(err)
+	} else {
+		publish()
+	}
+
+	onShift, err := shared.OnShift(dbc, siteID)
+	if err != nil {
+		log.Debug(err)
+	}
+
 	response.Set("message", "alert sent")
 	response.Set("data", residentAlert)
+	response.Set("security_online", len(shared.Online(siteID, model.SecurityUser)))
+	response.Set("security_on_shift", len(onShift))
 
 	if err := c.JSON(http.StatusOK, response); err != nil {
 		s.log.Error(err)
@@ -490,6 +553,12 @@ func (s *ResidentUtil) ResidentDashboard(c echo.Context) error {
 		return err
 	}
 
+	wallet, err := walletSummary(dbc, residentID)
+	if err != nil {
+		log.Debug("========= err ", err)
+		return err
+	}
+
 	// err = copier.Copy(&dashboard.ResidentDues, &residentDues)
 	// if err != nil {
 	// 	log.Debug("========= err ", err)
@@ -502,7 +571,25 @@ func (s *ResidentUtil) ResidentDashboard(c echo.Context) error {
 	dashboard.ResidentID = residentID
 	dashboard.GatePassList.List = gatePassList
 	dashboard.GatePassList.Count = len(gatePassList)
+
+	// passes that can be used now and passes whose window has not started yet
+	now := time.Now()
+	for _, pass := range gatePassList {
+		pass := pass
+		if !gatePassLive(&pass, now) {
+			continue
+		}
+		if now.Before(gatePassStart(&pass)) {
+			dashboard.UpcomingPasses.List = append(dashboard.UpcomingPasses.List, pass)
+		} else {
+			dashboard.ActivePasses.List = append(dashboard.ActivePasses.List, pass)
+		}
+	}
+	dashboard.ActivePasses.Count = len(dashboard.ActivePasses.List)
+	dashboard.UpcomingPasses.Count = len(dashboard.UpcomingPasses.List)
+
 	dashboard.AccountBalance = accountSummary.Balance
+	dashboard.Wallet = wallet
 	dashboard.SubResidents.List = subResidentList
 	dashboard.SubResidents.Count = len(subResidentList)
 	dashboard.Notification.List = noticeBoard
@@ -521,37 +608,28 @@ func (s *ResidentUtil) ResidentDashboard(c echo.Context) error {
 	return nil
 }
 
+// InitWebsocket opens the event stream of the signed in user, ?last_event= replays the
+// events missed since a previous connection
 func (s *ResidentUtil) InitWebsocket(c echo.Context) error {
-
-	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	ses, err := et.NewSessionMgr(c, "")
 	if err != nil {
-		return err
+		s.log.Debug(err)
+		return et.APIError(c, err, http.StatusBadRequest)
 	}
-	defer ws.Close()
 
-	// Write
-	err = ws.WriteMessage(websocket.TextMessage, []byte("Hello, Client!"))
-	if err != nil {
-		c.Logger().Error(err)
+	usrID := ses.String("admin_id")
+	if len(usrID) == 0 {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusUnauthorized)
 	}
 
-	s.reader(ws)
-	return nil
-}
-
-func (s *ResidentUtil) reader(conn *websocket.Conn) {
-	for {
-		// read in a message
-		messageType, p, err := conn.ReadMessage()
-		if err != nil {
-			s.log.Error(err)
-			return
-		}
-
-		if err := conn.WriteMessage(messageType, p); err != nil {
-			s.log.Error(err)
-			return
-		}
+	lastEvent, _ := strconv.ParseInt(c.QueryParam("last_event"), 10, 64)
 
+	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		s.log.Debug(err)
+		return nil
 	}
+
+	shared.ServeWS(ws, getSiteID(c), usrID, ses.Int("admin_type"), lastEvent)
+	return nil
 }
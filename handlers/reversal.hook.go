@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// BeforeSavePaymentReversal requests the reversal of a payment or, when the record already
+// exists, approves / rejects it
+func BeforeSavePaymentReversal(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.PaymentReversal)
+
+	if len(oid) == 0 || oid == "new" {
+		reversal, err := requestReversal(tx, ses, siteID, record.PaymentID, record.Reason)
+		if err != nil {
+			return true, err
+		}
+
+		resp.Set("id", reversal.ID)
+		resp.Set("status", reversal.Status)
+		return true, nil
+	}
+
+	if err := reviewReversal(tx, ses, siteID, oid, record.Status); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// DeletePaymentReversal withdraws a reversal that is still waiting for approval
+func DeletePaymentReversal(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	record := model.PaymentReversal{}
+	err = tx.Model(&record).
+		Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	if record.Status == model.ReversalApproved {
+		return true, errors.New("approved reversals cannot be deleted")
+	}
+
+	if record.Status == model.ReversalPending {
+		if err := setPaymentStatus(tx, record.PaymentID, model.PaymentActive); err != nil {
+			return true, err
+		}
+	}
+
+	return false, nil
+}
+
+// reversalApprovalAmount reversals above this amount need a second official, the
+// ReversalApprovalAmount config key defaults to zero so every reversal is approved
+func reversalApprovalAmount() decimal.Decimal {
+	value, err := utils.Getkey("", "ReversalApprovalAmount")
+	if err != nil {
+		return decimal.Zero
+	}
+
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return decimal.Zero
+	}
+
+	return amount
+}
+
+// requestReversal records the reversal of a payment, small reversals are posted at once
+func requestReversal(tx *pg.Tx, ses *et.SessionMgr, siteID, paymentID, reason string) (*model.PaymentReversal, error) {
+	log := utils.Env.Log
+
+	payment := &model.Payment{}
+	err := tx.Model(payment).
+		Where("id = ? and site_id = ?", paymentID, siteID).
+		For("update").
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, errors.New("invalid transaction")
+	}
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	switch payment.Status {
+	case model.PaymentReversalPending:
+		return nil, errors.New("payment already has a reversal waiting for approval")
+	case model.PaymentReversed:
+		return nil, errors.New("payment has already been reversed")
+	}
+
+	if len(reason) == 0 {
+		return nil, errors.New("a reason is required to reverse a payment")
+	}
+
+	by := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	record := &model.PaymentReversal{
+		ID:          xid.New().String(),
+		SiteID:      siteID,
+		PaymentID:   payment.ID,
+		ResidentID:  payment.ResidentID,
+		Amount:      payment.Amount,
+		Reason:      reason,
+		Status:      model.ReversalPending,
+		RequestedBy: by,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+	if _, err := tx.Model(record).Returning("reference").Insert(); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	if err := logReversal(tx, record, by, "Payment reversal requested"); err != nil {
+		return nil, err
+	}
+
+	if payment.Amount.GreaterThan(reversalApprovalAmount()) {
+		if err := setPaymentStatus(tx, payment.ID, model.PaymentReversalPending); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+
+	if err := approveReversal(tx, record, payment, by); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func reviewReversal(tx *pg.Tx, ses *et.SessionMgr, siteID, oid string, status int) error {
+	log := utils.Env.Log
+
+	record := &model.PaymentReversal{}
+	err := tx.Model(record).
+		Where("id = ? and site_id = ?", oid, siteID).
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if record.Status != model.ReversalPending {
+		return errors.New("reversal has already been reviewed")
+	}
+
+	if status != model.ReversalApproved && status != model.ReversalRejected {
+		return errors.New("a reversal can only be approved or rejected")
+	}
+
+	by := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	if by.UserID == record.RequestedBy.UserID {
+		return errors.New("a reversal must be approved by a second official")
+	}
+
+	if status == model.ReversalRejected {
+		record.Status = model.ReversalRejected
+		record.ApprovedBy = by
+		record.DateApproved = utils.DateTime{}.Now()
+
+		_, err := tx.Model(record).
+			Column("status", "approved_by", "date_approved").
+			WherePK().
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+
+		return setPaymentStatus(tx, record.PaymentID, model.PaymentActive)
+	}
+
+	payment := &model.Payment{}
+	err = tx.Model(payment).
+		Where("id = ?", record.PaymentID).
+		For("update").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return approveReversal(tx, record, payment, by)
+}
+
+// approveReversal posts the reversal. Online payments are marked for refund, the refund
+// monitor sends them to the provider once the reversal is committed
+func approveReversal(tx *pg.Tx, record *model.PaymentReversal, payment *model.Payment, by model.UserDetails) error {
+	log := utils.Env.Log
+
+	if err := postReversal(tx, record, payment, by); err != nil {
+		return err
+	}
+
+	record.Status = model.ReversalApproved
+	record.ApprovedBy = by
+	record.DateApproved = utils.DateTime{}.Now()
+
+	if payment.PayMode == model.OnlinePayment {
+		record.RefundStatus = model.RefundPending
+		if payment.ProviderID == model.ProviderManual || len(payment.ProviderRef) == 0 {
+			record.RefundStatus = model.RefundManual
+		}
+	}
+
+	_, err := tx.Model(record).
+		Column("status", "approved_by", "date_approved", "refund_status").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return logReversal(tx, record, by, "Payment reversed")
+}
+
+// postReversal offsets every transaction of the payment, including the wallet credit it
+// funded, and reverses its journals. The payment stays visible as reversed
+func postReversal(tx *pg.Tx, record *model.PaymentReversal, payment *model.Payment, by model.UserDetails) error {
+	log := utils.Env.Log
+
+	trxs := []model.Transaction{}
+	err := tx.Model(&trxs).
+		Where("site_id = ? and payment_id = ? and type = ?", payment.SiteID, payment.ID, model.TrxPayment).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	offsets, unallocated := reversalOffsets(trxs, utils.DateTime{}.Now())
+	for i := range offsets {
+		if _, err := tx.Model(&offsets[i]).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	narration := fmt.Sprintf("Payment reversed (%s)", record.Reference)
+	if err := reverseJournals(tx, payment.SiteID, payment.ID, narration, by); err != nil {
+		return err
+	}
+
+	if !unallocated.IsZero() {
+		_, err := moveWallet(tx, payment.SiteID, payment.ResidentID, &model.WalletMovement{
+			Type:      model.WalletReversed,
+			Amount:    unallocated.Neg(),
+			PaymentID: payment.ID,
+			Narration: narration,
+			CreatedBy: by,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := releaseInstallments(tx, payment.ID); err != nil {
+		return err
+	}
+
+	return setPaymentStatus(tx, payment.ID, model.PaymentReversed)
+}
+
+// reversalOffsets returns the transactions that cancel the payment transactions and the
+// part of the payment that was not allocated to a due
+func reversalOffsets(trxs []model.Transaction, date utils.DateTime) ([]model.Transaction, decimal.Decimal) {
+	offsets := []model.Transaction{}
+	unallocated := decimal.Zero
+
+	for _, t := range trxs {
+		if len(t.DueID) == 0 {
+			unallocated = unallocated.Add(t.Amount)
+		}
+
+		t.ID = xid.New().String()
+		t.Type = model.TrxReversal
+		t.DateTrx = date
+		t.Amount = t.Amount.Neg()
+		offsets = append(offsets, t)
+	}
+
+	return offsets, unallocated
+}
+
+func setPaymentStatus(tx *pg.Tx, paymentID string, status int) error {
+	_, err := tx.Model((*model.Payment)(nil)).
+		Set("status = ?", status).
+		Where("id = ?", paymentID).
+		Update()
+	if err != nil {
+		utils.Env.Log.Debug(err)
+	}
+
+	return err
+}
+
+func logReversal(tx *pg.Tx, record *model.PaymentReversal, by model.UserDetails, narration string) error {
+	res := model.Resident{}
+	if err := tx.Model(&res).Where("id = ?", record.ResidentID).Select(); err != nil {
+		utils.Env.Log.Debug(err)
+		return err
+	}
+
+	payLog := &model.PaymentLog{
+		ID:          xid.New().String(),
+		SiteID:      record.SiteID,
+		Operation:   string(model.PaymentReverse),
+		Amount:      record.Amount,
+		InitiatedBY: by,
+		InitiatedFor: model.UserDetails{
+			UserID:   res.ID,
+			UserType: model.ResidentUser,
+			Name:     fmt.Sprintf("%s %s", res.FirstName, res.LastName),
+		},
+		Narration: fmt.Sprintf("%s %s: %s", narration, record.Reference, record.Reason),
+	}
+
+	if _, err := tx.Model(payLog).Insert(); err != nil {
+		utils.Env.Log.Debug(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"time"
+
+	"eve/service/gateway"
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/go-pg/pg"
+)
+
+// RefundMonitor sends the refunds of approved reversals to the payment providers. A
+// refund is claimed (processing) and committed before the provider is called, the
+// reversal id is the idempotency key of the request. A refund left processing by a crash
+// is not sent again, it has to be checked with the provider
+func RefundMonitor() {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	for {
+		records := []model.PaymentReversal{}
+		err := dbc.Model(&records).
+			Where("status = ? and refund_status = ?", model.ReversalApproved, model.RefundPending).
+			Order("date_approved").
+			Select()
+		if err != nil && err != pg.ErrNoRows {
+			log.Error(err)
+		}
+
+		for i := range records {
+			if err := sendRefund(dbc, &records[i]); err != nil {
+				log.Error(err)
+			}
+		}
+
+		time.Sleep(time.Minute)
+	}
+}
+
+// sendRefund refunds the payment of a reversal through its provider and records the result
+func sendRefund(dbc *pg.DB, record *model.PaymentReversal) error {
+	log := utils.Env.Log
+
+	res, err := dbc.Model(record).
+		Set("refund_status = ?", model.RefundProcessing).
+		Where("id = ? and refund_status = ?", record.ID, model.RefundPending).
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		// claimed by another server
+		return nil
+	}
+
+	payment := &model.Payment{}
+	if err := dbc.Model(payment).Where("id = ?", record.PaymentID).Select(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	record.RefundStatus = model.RefundFailed
+	gw, err := siteGateway(dbc, payment.SiteID, payment.ProviderID)
+	if err == nil {
+		var refund *gateway.Refund
+		refund, err = gw.Refund(payment.ProviderRef, payment.Amount, record.ID)
+		switch {
+		case err == gateway.ErrNotSupported:
+			record.RefundStatus = model.RefundManual
+			err = nil
+		case err == nil:
+			record.RefundStatus = model.RefundProcessed
+			record.RefundReference = refund.Reference
+		}
+	}
+	if err != nil {
+		log.Errorf("refund of reversal %s failed: %s", record.Reference, err)
+	}
+
+	_, uerr := dbc.Model(record).
+		Column("refund_status", "refund_reference").
+		WherePK().
+		Update()
+	if uerr != nil {
+		log.Debug(uerr)
+		return uerr
+	}
+
+	return err
+}
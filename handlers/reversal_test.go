@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"testing"
+
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReversalOffsets(t *testing.T) {
+	payment := func(invoiceID, dueID, amt string) model.Transaction {
+		return model.Transaction{
+			ID: "t-" + invoiceID + dueID, SiteID: "s1", ResidentID: "r1", Type: model.TrxPayment,
+			InvoiceID: invoiceID, PaymentID: "p1", DueID: dueID, Amount: amount(amt),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		trxs        []model.Transaction
+		unallocated string
+	}{
+		{"no transactions", nil, "0"},
+		{"allocated to dues", []model.Transaction{payment("i1", "levy", "100"), payment("i2", "water", "25.50")}, "0"},
+		{"advance on a due", []model.Transaction{payment("", "levy", "40")}, "0"},
+		{"part held in the wallet", []model.Transaction{payment("i1", "levy", "100"), payment("", "", "30")}, "30"},
+		{"all held in the wallet", []model.Transaction{payment("", "", "75.25")}, "75.25"},
+	}
+
+	date := utils.DateTime{}.Now()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offsets, unallocated := reversalOffsets(tt.trxs, date)
+
+			if !unallocated.Equal(amount(tt.unallocated)) {
+				t.Errorf("unallocated = %s, want %s", unallocated, tt.unallocated)
+			}
+			if len(offsets) != len(tt.trxs) {
+				t.Fatalf("offsets = %d, want %d", len(offsets), len(tt.trxs))
+			}
+
+			for k, o := range offsets {
+				src := tt.trxs[k]
+				if o.ID == src.ID || len(o.ID) == 0 {
+					t.Errorf("offset %d id = %q, want a new id", k, o.ID)
+				}
+				if o.Type != model.TrxReversal || o.DateTrx != date {
+					t.Errorf("offset %d = %+v, want a reversal dated %v", k, o, date)
+				}
+				if o.InvoiceID != src.InvoiceID || o.DueID != src.DueID || o.PaymentID != src.PaymentID || o.ResidentID != src.ResidentID {
+					t.Errorf("offset %d = %+v, want the invoice, due and payment of %+v", k, o, src)
+				}
+				if !o.Amount.Add(src.Amount).Equal(decimal.Zero) {
+					t.Errorf("offset %d amount = %s, want %s", k, o.Amount, src.Amount.Neg())
+				}
+			}
+
+			if len(tt.trxs) > 0 && tt.trxs[0].Type != model.TrxPayment {
+				t.Error("reversalOffsets() changed the payment transactions")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"eve/service/model"
 	"eve/service/view"
 	"eve/utils"
 
@@ -26,9 +27,28 @@ func AfterListSecurityResidents(c echo.Context, data interface{}, resp *utils.Re
 			return err
 		}
 
-		if accountSummary.Balance.IsNegative() {
+		// residents keeping up with an active payment plan are not treated as debtors
+		plan := view.PaymentPlanList{}
+		err = dbc.Model(&plan).
+			Where("resident_id = ? and status = ?", record.ID, model.PlanActive).Select()
+		if err != nil && err != pg.ErrNoRows {
+			log.Debug("============ error ", err)
+			return err
+		}
+		record.OnPlan = len(plan.ID) > 0
+
+		if accountSummary.Balance.IsNegative() && !(record.OnPlan && plan.Missed == 0) {
 			record.InDebt = true
 		}
+
+		// residents the dunning policy flags at the gate
+		dunning := model.ResidentDunning{}
+		err = dbc.Model(&dunning).Where("resident_id = ?", record.ID).Select()
+		if err != nil && err != pg.ErrNoRows {
+			log.Debug(err)
+			return err
+		}
+		record.Flagged = dunning.FlagAtGate
 	}
 
 	log.Debug("========== in hook ... ", securityList)
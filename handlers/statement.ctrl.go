@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"eve/service/model"
+	"eve/shared"
+	"eve/utils"
+	et "eve/utils/echotools"
+	"fmt"
+	"net/http"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+)
+
+// GetStatement returns a residents statement for the period ?from=YYYY-MM-DD&to=YYYY-MM-DD
+// as json, html (format=html) or pdf (format=pdf)
+func (s *Controller) GetStatement(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	format := c.QueryParam("format")
+
+	var stmt *shared.Statement
+	var eml *shared.EMailMsg
+	var pdf []byte
+
+	err := utils.Transact(dbc, log, func(tx *pg.Tx) (err error) {
+		stmt, err = s.statement(tx, c)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case "html":
+			eml, err = shared.MakeStatement(tx, stmt)
+		case "pdf":
+			pdf, err = shared.MakeStatementPDF(tx, stmt)
+		}
+
+		return err
+	})
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	switch format {
+	case "html":
+		return c.HTML(http.StatusOK, eml.HTML)
+
+	case "pdf":
+		c.Response().Header().Set(echo.HeaderContentDisposition,
+			fmt.Sprintf("attachment; filename=\"statement-%s.pdf\"", stmt.DateTo.Format("2006-01-02")))
+		return c.Blob(http.StatusOK, "application/pdf", pdf)
+	}
+
+	response.Set("statement", stmt)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// EmailStatement queues a residents statement for the period to the residents email
+func (s *Controller) EmailStatement(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	err := utils.Transact(dbc, log, func(tx *pg.Tx) error {
+		stmt, err := s.statement(tx, c)
+		if err != nil {
+			return err
+		}
+
+		eml, err := shared.MakeStatement(tx, stmt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+		insert into task_queue (site_id, type, data)
+			values(?, 1, ?)
+		`, stmt.SiteID, &eml)
+		return err
+	})
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	response.Set("status", "queued")
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// statement checks the user may see the residents statement and builds it. Residents
+// only get their own statement, officials any resident of their site
+func (s *Controller) statement(tx *pg.Tx, c echo.Context) (*shared.Statement, error) {
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		return nil, err
+	}
+
+	residentID := c.Param("id")
+	usrType := ses.Int("admin_type")
+
+	if usrType == model.ResidentUser {
+		ownID, err := walletResidentID(s.env.Dbc, ses)
+		if err != nil {
+			return nil, err
+		}
+		if ownID != residentID {
+			return nil, fmt.Errorf("Access denied")
+		}
+	} else if usrType < model.OfficialUser {
+		return nil, fmt.Errorf("Access denied")
+	}
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := shared.GetStatement(tx, residentID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.SiteID != ses.String("admin_site_id") {
+		return nil, fmt.Errorf("Access denied")
+	}
+
+	return stmt, nil
+}
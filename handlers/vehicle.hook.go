@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// BeforeSaveVehicle residents register the vehicles of their residency, security and
+// officials can register a vehicle for any residency of the site
+func BeforeSaveVehicle(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrType := ses.Int("admin_type")
+	usrID := ses.String("admin_id")
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.Vehicle)
+
+	record.PlateNumber = normalizePlate(record.PlateNumber)
+	if len(record.PlateNumber) == 0 {
+		return true, errors.New("plate number is required")
+	}
+
+	if usrType == model.ResidentUser {
+		res := model.Resident{}
+		if err := tx.Model(&res).Where("id = ?", usrID).Select(); err != nil {
+			log.Debug(err)
+			return true, err
+		}
+		record.ResidencyID = res.ResidencyID
+	}
+
+	count, err := tx.Model((*model.Residency)(nil)).
+		Where("id = ? and site_id = ? and active_status = 1", record.ResidencyID, siteID).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count == 0 {
+		return true, errors.New("vehicles can only be registered to an active residency")
+	}
+
+	isNew := len(oid) == 0 || oid == "new"
+
+	count, err = tx.Model((*model.Vehicle)(nil)).
+		Where("site_id = ? and plate_number = ? and active and id <> ?", siteID, record.PlateNumber, oid).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count > 0 && (isNew || record.Active) {
+		return true, fmt.Errorf("%s is already registered", record.PlateNumber)
+	}
+
+	if !isNew {
+		current := model.Vehicle{}
+		if err := tx.Model(&current).Where("id = ? and site_id = ?", oid, siteID).Select(); err != nil {
+			log.Debug(err)
+			return true, err
+		}
+		if usrType == model.ResidentUser && current.ResidencyID != record.ResidencyID {
+			return true, fmt.Errorf("Access denied")
+		}
+
+		_, err := tx.Model(record).
+			Column("residency_id", "plate_number", "make", "colour", "sticker_number", "active").
+			Where("id = ? and site_id = ?", oid, siteID).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.ResidentID = usrID
+	record.Active = true
+	record.DateCreated = utils.DateTime{}.Now()
+	if usrType != model.ResidentUser {
+		record.ResidentID = ""
+	}
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+// BeforeListVehicle residents only see the vehicles of their residency
+func BeforeListVehicle(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") == model.ResidentUser {
+		res := model.Resident{}
+		if err := dbc.Model(&res).Where("id = ?", ses.String("admin_id")).Select(); err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		(*filter)["residency_id"] = res.ResidencyID
+	}
+
+	return false, nil
+}
+
+// DeleteVehicle residents can only remove the vehicles of their residency
+func DeleteVehicle(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") != model.ResidentUser {
+		return false, nil
+	}
+
+	count, err := tx.Model((*model.Vehicle)(nil)).
+		Where("id = ? and residency_id = (select residency_id from resident where id = ?)", c.Param("id"), ses.String("admin_id")).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if count == 0 {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	return false, nil
+}
+
+// BeforeSaveVehicleLog the vehicle log is written at the gate
+func BeforeSaveVehicleLog(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	return true, errors.New("vehicle movements are recorded at the gate")
+}
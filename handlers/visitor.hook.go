@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"eve/service/model"
+	"eve/shared"
 	"eve/utils"
 	et "eve/utils/echotools"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-pg/pg"
 	"github.com/labstack/echo/v4"
@@ -47,6 +52,14 @@ func BeforeSaveVisitor(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfac
 	userID := ses.String("admin_id")
 
 	record := frm.(*model.Visitor)
+	isNew := len(c.Param("id")) == 0 || c.Param("id") == "new"
+
+	action, err := visitorTransition(tx, usrType, userID, isNew, record)
+	if err != nil {
+		return true, err
+	}
+	c.Set("visitorAction", action)
+
 	// if its a resident creating this visitor record
 	if len(record.ID) == 0 && record.RegistrationType == 1 && usrType == 3 {
 		record.ResidentID = userID
@@ -64,9 +77,91 @@ func BeforeSaveVisitor(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interfac
 		return
 	}
 
+	// the phone of a visitor is kept in attr
+	contact := struct {
+		Phone string `json:"phone"`
+	}{}
+	if len(record.Attr) > 0 {
+		json.Unmarshal(record.Attr, &contact)
+	}
+
+	// leaving and denied visitors are not checked again
+	matches := []WatchlistMatch{}
+	if isNew || action == visitorCheckin {
+		if matches, err = matchWatchlist(tx, getSiteID(c), record.Name, contact.Phone, record.VehicleNumber); err != nil {
+			return true, err
+		}
+	}
+	if len(matches) > 0 {
+		recordWatchlistHits(getSiteID(c), "visitor", record.ID, userID, matches)
+
+		if deny := watchlistDenial(matches); deny != nil {
+			if usrType == model.ResidentUser {
+				return true, errors.New("this visitor cannot be admitted, please contact security")
+			}
+			return true, fmt.Errorf("visitor is on the watchlist: %s", deny.Reason)
+		}
+
+		if usrType != model.ResidentUser {
+			resp.Set("watchlist", matches)
+		}
+	}
+
 	return false, err
 }
 
+// AfterSaveVisitor tells the resident a visitor arrived and security a visitor was denied
+func AfterSaveVisitor(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	record := frm.(*model.Visitor)
+	siteID := getSiteID(c)
+
+	action, _ := c.Get("visitorAction").(string)
+	switch action {
+	case visitorCheckin:
+		if len(record.ResidentID) == 0 {
+			return false, nil
+		}
+
+		body := fmt.Sprintf("%s checked in at the gate at %s. Not expecting them? You can deny entry in the app.", record.Name, record.ArrivalTime)
+		if !record.ExpectedFrom.IsZero() && !visitorExpectedNow(record, time.Now()) {
+			body = fmt.Sprintf("%s checked in at the gate at %s, outside the time you expected them. You can deny entry in the app.", record.Name, record.ArrivalTime)
+		}
+
+		notified, err := shared.QueueResidentPush(tx, siteID, record.ResidentID, "Your visitor has arrived", body,
+			map[string]string{"type": "visitor_arrival", "visitor_id": record.ID})
+		if err != nil {
+			return false, err
+		}
+		et.AfterCommit(c, func() {
+			shared.Publish(siteID, "visitor.arrived", record, shared.UserChannel(record.ResidentID))
+		})
+		resp.Set("resident_notified", notified)
+
+	case visitorDenied:
+		if record.DateCheckin.IsZero() {
+			return false, nil
+		}
+
+		guards, err := shared.AlertGuards(tx, siteID)
+		if err != nil {
+			return false, err
+		}
+
+		et.AfterCommit(c, func() {
+			shared.Publish(siteID, "visitor.denied", record, append(shared.GuardChannels(guards), shared.RoleChannel(model.OfficialUser))...)
+		})
+
+		_, err = shared.QueueGuardPush(tx, siteID, guards, "Entry denied",
+			fmt.Sprintf("The resident denied entry to %s who checked in at %s", record.Name, record.ArrivalTime),
+			map[string]string{"type": "visitor_denied", "visitor_id": record.ID})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
 // BeforeVisitorList ...
 func BeforeVisitorList(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
 	dbc := utils.Env.Db
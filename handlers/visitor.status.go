@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/go-pg/pg"
+)
+
+// what a save did to a visitor, used to notify the resident or security
+const (
+	visitorCheckin  = "checkin"
+	visitorCheckout = "checkout"
+	visitorDenied   = "denied"
+)
+
+// visitorTransition keeps the arrival and departure stamps of a visitor and applies the
+// status change of a save. Residents pre-register visitors and can deny entry, security
+// checks them in and out
+func visitorTransition(tx *pg.Tx, usrType int, userID string, isNew bool, record *model.Visitor) (string, error) {
+	if !record.ExpectedFrom.IsZero() {
+		if !record.ExpectedUntil.IsZero() && !record.ExpectedUntil.After(record.ExpectedFrom.Time) {
+			return "", errors.New("a visitor must be expected until after they are expected from")
+		}
+		record.DateArrival = record.ExpectedFrom
+	}
+
+	if isNew {
+		record.DateCheckin = utils.DateTime{}
+		record.DateCheckout = utils.DateTime{}
+		record.CheckoutBy = ""
+		record.DateDenied = utils.DateTime{}
+
+		if usrType == model.ResidentUser {
+			record.RegistrationType = model.VisitorByResident
+			record.Status = model.VisitorExpected
+			return "", nil
+		}
+
+		if record.RegistrationType == 0 {
+			record.RegistrationType = model.VisitorBySecurity
+		}
+
+		switch record.Status {
+		case model.VisitorExpected:
+			return "", nil
+		case model.VisitorIn:
+			checkinVisitor(record, userID)
+			return visitorCheckin, nil
+		}
+
+		return "", errors.New("a new visitor is either expected or checked in")
+	}
+
+	current := model.Visitor{}
+	if err := tx.Model(&current).Where("id = ?", record.ID).For("update").Select(); err != nil {
+		utils.Env.Log.Debug(err)
+		return "", err
+	}
+
+	if usrType == model.ResidentUser {
+		count, err := tx.Model((*model.Resident)(nil)).
+			Join("join residency as rs on rs.id = resident.residency_id").
+			Where("resident.id = ? and rs.unit_id = ?", userID, current.UnitID).
+			Count()
+		if err != nil {
+			utils.Env.Log.Debug(err)
+			return "", err
+		}
+		if count == 0 {
+			return "", errors.New("Access denied")
+		}
+
+		record.ResidentID = current.ResidentID
+	}
+
+	record.RegistrationType = current.RegistrationType
+	record.SecurityID = current.SecurityID
+	record.ArrivalTime = current.ArrivalTime
+	record.DepartureTime = current.DepartureTime
+	record.DateCheckin = current.DateCheckin
+	record.DateCheckout = current.DateCheckout
+	record.CheckoutBy = current.CheckoutBy
+	record.DateDenied = current.DateDenied
+
+	if record.Status == current.Status {
+		if usrType == model.ResidentUser && current.Status != model.VisitorExpected {
+			return "", errors.New("the visitor has already arrived")
+		}
+		return "", nil
+	}
+
+	if usrType == model.ResidentUser {
+		if record.Status != model.VisitorDenied || current.Status == model.VisitorOut {
+			return "", errors.New("residents can only deny entry to a visitor who has not left")
+		}
+
+		record.DateDenied = utils.DateTime{}.Now()
+		return visitorDenied, nil
+	}
+
+	switch {
+	case current.Status == model.VisitorExpected && record.Status == model.VisitorIn:
+		checkinVisitor(record, userID)
+		return visitorCheckin, nil
+	case record.Status == model.VisitorOut && current.Status != model.VisitorExpected:
+		checkoutVisitor(record, userID)
+		return visitorCheckout, nil
+	case current.Status == model.VisitorDenied:
+		return "", errors.New("the resident denied entry to this visitor")
+	case current.Status == model.VisitorOut:
+		return "", errors.New("the visitor has already left")
+	}
+
+	return "", errors.New("invalid visitor status")
+}
+
+func checkinVisitor(record *model.Visitor, userID string) {
+	now := utils.DateTime{}.Now()
+	record.DateCheckin = now
+	record.DateArrival = now
+	record.ArrivalTime = now.Format("15:04")
+	record.SecurityID = userID
+}
+
+func checkoutVisitor(record *model.Visitor, userID string) {
+	now := utils.DateTime{}.Now()
+	record.DateCheckout = now
+	record.DepartureTime = now.Format("15:04")
+	record.CheckoutBy = userID
+}
+
+// visitorExpectedNow is true when a visitor arrives within the window the resident gave,
+// a window without an end runs to the end of the day it starts
+func visitorExpectedNow(record *model.Visitor, now time.Time) bool {
+	from := wallClock(record.ExpectedFrom)
+
+	until := time.Date(from.Year(), from.Month(), from.Day(), 23, 59, 59, 0, time.Local)
+	if !record.ExpectedUntil.IsZero() {
+		until = wallClock(record.ExpectedUntil)
+	}
+
+	return !now.Before(from) && !now.After(until)
+}
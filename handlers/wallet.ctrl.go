@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+	"fmt"
+	"net/http"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+// ApplyResidentWallet lets an official apply a residents wallet to their unpaid invoices
+func (s *Controller) ApplyResidentWallet(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	siteID := getSiteID(c)
+	residentID := c.Param("id")
+
+	count, err := dbc.Model((*model.Resident)(nil)).
+		Join("join residency as rs on rs.id = resident.residency_id").
+		Where("resident.id = ? and rs.site_id = ?", residentID, siteID).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+	if count == 0 {
+		return et.APIError(c, errors.New("resident not found"), http.StatusNotFound)
+	}
+
+	user := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	applied := decimal.Zero
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) (err error) {
+		applied, err = applyWallet(tx, siteID, residentID, false, user)
+		return err
+	})
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	response.Set("applied", applied)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// walletSource is credit in a wallet that came from a single payment or credit note
+type walletSource struct {
+	Type         int
+	PaymentID    string
+	CreditNoteID string
+	DateTrx      utils.DateTime
+	Amount       decimal.Decimal
+}
+
+// residentWallet returns the (locked) wallet of a resident, creating it when missing
+func residentWallet(tx *pg.Tx, siteID, residentID string) (*model.Wallet, error) {
+	log := utils.Env.Log
+
+	wallet := &model.Wallet{}
+	err := tx.Model(wallet).
+		Where("resident_id = ? and site_id = ?", residentID, siteID).
+		For("update").
+		Select()
+	if err == nil {
+		return wallet, nil
+	}
+	if err != pg.ErrNoRows {
+		log.Debug(err)
+		return nil, err
+	}
+
+	wallet = &model.Wallet{
+		ID:          xid.New().String(),
+		SiteID:      siteID,
+		ResidentID:  residentID,
+		AutoApply:   true,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+	if _, err := tx.Model(wallet).Insert(); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// walletBalance is the sum of the movements of a wallet
+func walletBalance(db orm.DB, walletID string) (decimal.Decimal, error) {
+	balance := decimal.Zero
+	_, err := db.QueryOne(pg.Scan(&balance), `
+		select coalesce(sum(amount), 0) from wallet_movement where wallet_id = ?
+	`, walletID)
+	if err != nil {
+		utils.Env.Log.Debug(err)
+	}
+
+	return balance, err
+}
+
+// moveWallet records a movement, movements are never changed or removed
+func moveWallet(tx *pg.Tx, siteID, residentID string, mv *model.WalletMovement) (*model.Wallet, error) {
+	log := utils.Env.Log
+
+	wallet, err := residentWallet(tx, siteID, residentID)
+	if err != nil {
+		return nil, err
+	}
+
+	mv.ID = xid.New().String()
+	mv.SiteID = siteID
+	mv.WalletID = wallet.ID
+	mv.ResidentID = residentID
+	mv.DateTrx = utils.DateTime{}.Now()
+	if _, err := tx.Model(mv).Insert(); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	if wallet.Balance, err = walletBalance(tx, wallet.ID); err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// releaseWallet takes the credit a payment that is being changed left in the wallet back
+// out with a compensating movement, the payment is allocated again afterwards
+func releaseWallet(tx *pg.Tx, siteID, residentID, paymentID string, by model.UserDetails) error {
+	log := utils.Env.Log
+
+	if _, err := residentWallet(tx, siteID, residentID); err != nil {
+		return err
+	}
+
+	net := decimal.Zero
+	_, err := tx.QueryOne(pg.Scan(&net), `
+		select coalesce(sum(amount), 0) from wallet_movement where payment_id = ? and resident_id = ?
+	`, paymentID, residentID)
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+	if net.IsZero() {
+		return nil
+	}
+
+	_, err = moveWallet(tx, siteID, residentID, &model.WalletMovement{
+		Type:      model.WalletReversed,
+		Amount:    net.Neg(),
+		PaymentID: paymentID,
+		Narration: "Payment updated",
+		CreatedBy: by,
+	})
+
+	return err
+}
+
+// applyWallet applies a residents wallet to their unpaid invoices, oldest first. The
+// transactions keep the type, payment / credit note and date of the credit they use so
+// the original documents totals are unchanged. When auto is set wallets that are not
+// marked for automatic use are skipped
+func applyWallet(tx *pg.Tx, siteID, residentID string, auto bool, by model.UserDetails) (decimal.Decimal, error) {
+	log := utils.Env.Log
+	applied := decimal.Zero
+
+	wallet := &model.Wallet{}
+	err := tx.Model(wallet).
+		Where("resident_id = ? and site_id = ?", residentID, siteID).
+		For("update").
+		Select()
+	if err == pg.ErrNoRows {
+		return applied, nil
+	}
+	if err != nil {
+		log.Debug(err)
+		return applied, err
+	}
+
+	if wallet.Balance, err = walletBalance(tx, wallet.ID); err != nil {
+		return applied, err
+	}
+
+	if (auto && !wallet.AutoApply) || wallet.Balance.Sign() <= 0 {
+		return applied, nil
+	}
+
+	sources := []walletSource{}
+	_, err = tx.Query(&sources, `
+		select
+			type, payment_id, credit_note_id, min(date_trx) as date_trx, sum(amount) as amount
+		from
+			transaction
+		where
+			resident_id = ? and site_id = ? and due_id is null
+		group by
+			type, payment_id, credit_note_id
+		having
+			sum(amount) > 0
+		order by
+			min(date_trx)
+	`, residentID, siteID)
+	if err != nil {
+		log.Debug(err)
+		return applied, err
+	}
+
+	items, err := openItems(tx, residentID)
+	if err != nil {
+		return applied, err
+	}
+
+	for _, s := range sources {
+		list, left := allocateFIFO(items, s.Amount)
+		if len(list) == 0 {
+			break
+		}
+
+		// the journal belongs to the payment or credit note that funded the wallet
+		j := newJournal(siteID, residentID, model.JournalWallet, s.PaymentID+s.CreditNoteID,
+			"Wallet applied", utils.DateTime{}.Now())
+		j.createdBy(by)
+
+		for _, a := range list {
+			trx := &model.Transaction{
+				ID:           xid.New().String(),
+				SiteID:       siteID,
+				Type:         s.Type,
+				ResidentID:   residentID,
+				PaymentID:    s.PaymentID,
+				CreditNoteID: s.CreditNoteID,
+				DateTrx:      s.DateTrx,
+				InvoiceID:    a.InvoiceID,
+				DueID:        a.DueID,
+				Amount:       a.Amount,
+			}
+			if _, err := tx.Model(trx).Insert(); err != nil {
+				log.Debug(err)
+				return applied, err
+			}
+
+			_, err := moveWallet(tx, siteID, residentID, &model.WalletMovement{
+				Type:         model.WalletApplied,
+				Amount:       a.Amount.Neg(),
+				PaymentID:    s.PaymentID,
+				CreditNoteID: s.CreditNoteID,
+				InvoiceID:    a.InvoiceID,
+				Narration:    fmt.Sprintf("Applied to %s", a.Name),
+				CreatedBy:    by,
+			})
+			if err != nil {
+				return applied, err
+			}
+
+			j.debit(model.LedgerWallet, "", a.Amount)
+			j.credit(model.LedgerReceivable, a.DueID, a.Amount)
+		}
+
+		if err := j.post(tx); err != nil {
+			return applied, err
+		}
+
+		// move the used amount out of the wallet
+		used := s.Amount.Sub(left)
+		trx := &model.Transaction{
+			ID:           xid.New().String(),
+			SiteID:       siteID,
+			Type:         s.Type,
+			ResidentID:   residentID,
+			PaymentID:    s.PaymentID,
+			CreditNoteID: s.CreditNoteID,
+			DateTrx:      s.DateTrx,
+			Amount:       used.Neg(),
+		}
+		if _, err := tx.Model(trx).Insert(); err != nil {
+			log.Debug(err)
+			return applied, err
+		}
+
+		applied = applied.Add(used)
+		if left.Sign() > 0 {
+			break
+		}
+
+		items, err = openItems(tx, residentID)
+		if err != nil {
+			return applied, err
+		}
+	}
+
+	return applied, nil
+}
+
+// walletSummary returns the wallet balance and latest movements of a resident
+func walletSummary(dbc *pg.DB, residentID string) (model.WalletSummary, error) {
+	summary := model.WalletSummary{AutoApply: true, Movements: []model.WalletMovement{}}
+
+	wallet := model.Wallet{}
+	err := dbc.Model(&wallet).Where("resident_id = ?", residentID).Select()
+	if err == pg.ErrNoRows {
+		return summary, nil
+	}
+	if err != nil {
+		return summary, err
+	}
+
+	summary.AutoApply = wallet.AutoApply
+	if summary.Balance, err = walletBalance(dbc, wallet.ID); err != nil {
+		return summary, err
+	}
+
+	err = dbc.Model(&summary.Movements).
+		Where("wallet_id = ?", wallet.ID).
+		Order("date_trx desc").
+		Limit(20).
+		Select()
+
+	return summary, err
+}
+
+// BeforeSaveWallet only the auto apply setting of a wallet can be changed,
+// balances move through payments, credit notes and invoices
+func BeforeSaveWallet(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") < model.OfficialUser {
+		err := fmt.Errorf("Access denied")
+		return true, err
+	}
+
+	record := frm.(*model.Wallet)
+	res, err := tx.Model(record).
+		Column("auto_apply").
+		Where("id = ? and site_id = ?", c.Param("id"), getSiteID(c)).
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return true, err
+	}
+	if res.RowsAffected() == 0 {
+		return true, errors.New("wallet not found")
+	}
+
+	return true, nil
+}
+
+// DeleteWallet wallets are kept for as long as the resident exists
+func DeleteWallet(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	err := fmt.Errorf("Access denied")
+	return true, err
+}
+
+// BeforeListWalletMovement ...
+func BeforeListWalletMovement(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrID := ses.String("admin_id")
+	usrType := ses.Int("admin_type")
+	usrSubType := ses.Int("admin_subtype")
+
+	// if this user is a secondary resident
+	if usrType == model.ResidentUser && usrSubType == 1 {
+		res := model.Resident{}
+		err := dbc.Model(&res).Where("id = ?", usrID).Select()
+		if err != nil {
+			log.Debug(err)
+			return false, err
+		}
+
+		(*filter)["resident_id"] = res.PrimaryID
+	} else if usrType == model.ResidentUser {
+		(*filter)["resident_id"] = usrID
+	}
+
+	return false, nil
+}
+
+// BeforeSaveWalletMovement movements are only created by the wallet itself
+func BeforeSaveWalletMovement(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	err := fmt.Errorf("Access denied")
+	return true, err
+}
+
+// DeleteWalletMovement ...
+func DeleteWalletMovement(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, resp *utils.Response) (bool, error) {
+	err := fmt.Errorf("Access denied")
+	return true, err
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"eve/service/model"
+	"eve/utils"
+	et "eve/utils/echotools"
+	"fmt"
+	"net/http"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+// GetWallet returns the wallet balance and movements of the logged in resident
+func (s *ResidentUtil) GetWallet(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	residentID, err := walletResidentID(dbc, ses)
+	if err != nil {
+		return err
+	}
+
+	wallet, err := walletSummary(dbc, residentID)
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	response.Set("wallet", wallet)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// UpdateWallet lets a primary resident choose if the wallet is used automatically at bill generation
+func (s *ResidentUtil) UpdateWallet(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	frm := struct {
+		AutoApply bool `json:"auto_apply"`
+	}{}
+	if err := c.Bind(&frm); err != nil {
+		return err
+	}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if ses.Int("admin_type") != model.ResidentUser || ses.Int("admin_subtype") == 1 {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) error {
+		wallet, err := residentWallet(tx, ses.String("admin_site_id"), ses.String("admin_id"))
+		if err != nil {
+			return err
+		}
+
+		wallet.AutoApply = frm.AutoApply
+		_, err = tx.Model(wallet).Column("auto_apply").WherePK().Update()
+		return err
+	})
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	response.Set("status", "updated")
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// ApplyWallet applies the logged in residents wallet to their unpaid invoices
+func (s *ResidentUtil) ApplyWallet(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+	response := utils.Response{}
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if ses.Int("admin_type") != model.ResidentUser || ses.Int("admin_subtype") == 1 {
+		return et.APIError(c, fmt.Errorf("Access denied"), http.StatusForbidden)
+	}
+
+	user := model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: ses.Int("admin_type"),
+		Name:     ses.String("admin_name"),
+	}
+
+	applied := decimal.Zero
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) (err error) {
+		applied, err = applyWallet(tx, ses.String("admin_site_id"), ses.String("admin_id"), false, user)
+		return err
+	})
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	response.Set("applied", applied)
+	if err := c.JSON(http.StatusOK, response); err != nil {
+		s.log.Error(err)
+		return nil
+	}
+
+	return nil
+}
+
+// walletResidentID secondary residents share the wallet of their primary resident
+func walletResidentID(dbc *pg.DB, ses *et.SessionMgr) (string, error) {
+	usrID := ses.String("admin_id")
+	if ses.Int("admin_subtype") != 1 {
+		return usrID, nil
+	}
+
+	res := model.Resident{}
+	if err := dbc.Model(&res).Where("id = ?", usrID).Select(); err != nil {
+		return "", err
+	}
+
+	return res.PrimaryID, nil
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"eve/service/model"
+	"eve/shared"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// WatchlistMatch is a watchlist entry a visitor or gate pass matched
+type WatchlistMatch struct {
+	ID        string `json:"id"`
+	Action    int    `json:"action"`
+	Reason    string `json:"reason"`
+	MatchedOn string `json:"matched_on"`
+	Value     string `json:"value"`
+}
+
+// BeforeSaveWatchlist only security and officials manage the watchlist
+func BeforeSaveWatchlist(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	log := utils.Env.Log
+
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	usrType := ses.Int("admin_type")
+	if usrType != model.SecurityUser && usrType < model.OfficialUser {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	siteID := getSiteID(c)
+	oid := c.Param("id")
+	record := frm.(*model.Watchlist)
+
+	record.Name = strings.Join(strings.Fields(record.Name), " ")
+	record.Phone = normalizePhone(record.Phone)
+	record.PlateNumber = normalizePlate(record.PlateNumber)
+
+	if len(record.Name) == 0 && len(record.Phone) == 0 && len(record.PlateNumber) == 0 {
+		return true, errors.New("a name, phone or plate number is required")
+	}
+	if record.Action != model.WatchlistDeny && record.Action != model.WatchlistEscort {
+		return true, errors.New("action must be deny entry or escort")
+	}
+	if len(strings.TrimSpace(record.Reason)) == 0 {
+		return true, errors.New("a reason is required")
+	}
+
+	if len(oid) > 0 && oid != "new" {
+		_, err := tx.Model(record).
+			Column("name", "phone", "plate_number", "action", "reason", "active", "date_expiry").
+			Where("id = ? and site_id = ?", oid, siteID).
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return true, err
+		}
+
+		return true, nil
+	}
+
+	record.ID = xid.New().String()
+	record.SiteID = siteID
+	record.Active = true
+	record.CreatedBy = model.UserDetails{
+		UserID:   ses.String("admin_id"),
+		UserType: usrType,
+		Name:     ses.String("admin_name"),
+	}
+	record.DateCreated = utils.DateTime{}.Now()
+
+	if _, err := tx.Model(record).Insert(); err != nil {
+		log.Debug(err)
+		return true, err
+	}
+
+	resp.Set("id", record.ID)
+
+	return true, nil
+}
+
+// BeforeListWatchlist residents cannot see the watchlist
+func BeforeListWatchlist(c echo.Context, filter *utils.Options, resp *utils.Response) (bool, error) {
+	ses, err := et.NewSessionMgr(c, "")
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return false, err
+	}
+
+	if ses.Int("admin_type") == model.ResidentUser {
+		return true, fmt.Errorf("Access denied")
+	}
+
+	return false, nil
+}
+
+// BeforeReadWatchlist residents cannot see the watchlist
+func BeforeReadWatchlist(c echo.Context, mi *et.ModelInfo, field, value string, filter *utils.Options, resp *utils.Response) (bool, error) {
+	return BeforeListWatchlist(c, filter, resp)
+}
+
+// BeforeSaveWatchlistHit watchlist hits are recorded when visitors and passes are checked
+func BeforeSaveWatchlistHit(tx *pg.Tx, c echo.Context, mi *et.ModelInfo, frm interface{}, resp *utils.Response) (bool, error) {
+	return true, errors.New("watchlist hits are recorded at the gate")
+}
+
+// normalizePlate plates are compared upper case without spaces or dashes
+func normalizePlate(plate string) string {
+	plate = strings.ToUpper(plate)
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, plate)
+}
+
+// normalizePhone phones are compared on their digits
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// matchWatchlist returns the active entries of a site matching a name, phone or plate.
+// Phones are compared on their last 10 digits so local and international forms match
+func matchWatchlist(db orm.DB, siteID, name, phone, plate string) ([]WatchlistMatch, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	phone = normalizePhone(phone)
+	plate = normalizePlate(plate)
+
+	if len(name) == 0 && len(phone) == 0 && len(plate) == 0 {
+		return []WatchlistMatch{}, nil
+	}
+
+	entries := []model.Watchlist{}
+	_, err := db.Query(&entries, `
+		select * from watchlist
+		where
+			site_id = ?0 and active and (date_expiry is null or date_expiry > localtimestamp) and (
+				(name <> '' and lower(name) = lower(?1)) or
+				(phone <> '' and right(phone, 10) = right(?2, 10)) or
+				(plate_number <> '' and plate_number = ?3)
+			)
+		order by
+			action
+	`, siteID, name, phone, plate)
+	if err != nil {
+		utils.Env.Log.Debug(err)
+		return nil, err
+	}
+
+	matches := []WatchlistMatch{}
+	for _, e := range entries {
+		m := WatchlistMatch{ID: e.ID, Action: e.Action, Reason: e.Reason}
+		switch {
+		case len(e.PlateNumber) > 0 && e.PlateNumber == plate:
+			m.MatchedOn, m.Value = "plate_number", plate
+		case len(e.Phone) > 0 && len(phone) > 0 && strings.HasSuffix(phone, lastDigits(e.Phone, 10)):
+			m.MatchedOn, m.Value = "phone", phone
+		default:
+			m.MatchedOn, m.Value = "name", name
+		}
+		matches = append(matches, m)
+	}
+
+	return matches, nil
+}
+
+func lastDigits(val string, n int) string {
+	if len(val) <= n {
+		return val
+	}
+	return val[len(val)-n:]
+}
+
+// watchlistDenial returns the first match that must not be admitted
+func watchlistDenial(matches []WatchlistMatch) *WatchlistMatch {
+	for i := range matches {
+		if matches[i].Action == model.WatchlistDeny {
+			return &matches[i]
+		}
+	}
+	return nil
+}
+
+// recordWatchlistHits logs the matches and alerts the security of the site. It runs
+// outside the transaction of the request so denied visitors are still recorded
+func recordWatchlistHits(siteID, source, sourceID, userID string, matches []WatchlistMatch) {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	// hits follow the alert routing of the site
+	guards, err := shared.AlertGuards(dbc, siteID)
+	if err != nil {
+		log.Error(err)
+	}
+
+	for _, m := range matches {
+		hit := &model.WatchlistHit{
+			ID:          xid.New().String(),
+			SiteID:      siteID,
+			WatchlistID: m.ID,
+			Source:      source,
+			SourceID:    sourceID,
+			MatchedOn:   m.MatchedOn,
+			Value:       m.Value,
+			UserID:      userID,
+			DateCreated: utils.DateTime{}.Now(),
+		}
+		if _, err := dbc.Model(hit).Insert(); err != nil {
+			log.Error(err)
+			continue
+		}
+
+		shared.Publish(siteID, "watchlist.match", hit, append(shared.GuardChannels(guards), shared.RoleChannel(model.OfficialUser))...)
+
+		action := "escort"
+		if m.Action == model.WatchlistDeny {
+			action = "deny entry"
+		}
+
+		_, err := shared.QueueGuardPush(dbc, siteID, guards, "Watchlist match",
+			fmt.Sprintf("%s (%s) is on the watchlist, %s: %s", m.Value, strings.Replace(m.MatchedOn, "_", " ", -1), action, m.Reason),
+			map[string]string{"type": "watchlist", "watchlist_id": m.ID, "source": source, "source_id": sourceID})
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"eve/service/form"
+	"eve/service/gateway"
+	"eve/service/model"
+	"eve/shared"
+	"eve/utils"
+	et "eve/utils/echotools"
+
+	"github.com/go-pg/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+)
+
+// PaymentWebhook receives charge events from payment providers. Payments are recorded
+// once per provider reference, payments already recorded by the client are reconciled
+func (s *Controller) PaymentWebhook(c echo.Context) error {
+	dbc := s.env.Dbc
+	log := s.log
+
+	provider, found := model.GetProviderByName(c.Param("provider"))
+	if !found {
+		return et.APIError(c, fmt.Errorf("unknown provider"), http.StatusNotFound)
+	}
+
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	// sites with their own keys register /webhook/:provider/:site with the provider
+	siteID := c.Param("site")
+	gw, err := siteGateway(dbc, siteID, provider.Value)
+	if err != nil {
+		return et.APIError(c, err, http.StatusBadRequest)
+	}
+
+	event, err := gw.ParseWebhook(c.Request().Header, body)
+	if err != nil {
+		log.Debug(err)
+		return et.APIError(c, fmt.Errorf("invalid signature"), http.StatusUnauthorized)
+	}
+
+	hook := &model.PaymentWebhook{
+		ID:          xid.New().String(),
+		Provider:    provider.Value,
+		Event:       event.Name,
+		Payload:     body,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+	if event.Charge != nil {
+		hook.Reference = event.Charge.Reference
+	}
+
+	err = utils.Transact(dbc, log, func(tx *pg.Tx) error {
+		if err := recordWebhookPayment(tx, provider, siteID, event.Charge, hook); err != nil {
+			return err
+		}
+
+		_, err := tx.Model(hook).Insert()
+		return err
+	})
+	if err != nil {
+		log.Debug(err)
+
+		// the event is kept for follow up, the provider retries failed deliveries
+		hook.Status = model.WebhookFailed
+		hook.Error = err.Error()
+		hook.SiteID, hook.PaymentID = "", ""
+		if _, err := dbc.Model(hook).Insert(); err != nil {
+			log.Error(err)
+		}
+
+		return et.APIError(c, err, http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// recordWebhookPayment records the payment of a successful charge and sets the webhook status
+func recordWebhookPayment(tx *pg.Tx, provider model.PayEntity, siteID string, charge *gateway.Charge, hook *model.PaymentWebhook) error {
+	log := utils.Env.Log
+
+	if charge == nil || !charge.Success || len(charge.Reference) == 0 {
+		hook.Status = model.WebhookIgnored
+		return nil
+	}
+
+	if err := lockProviderRef(tx, provider.Value, charge.Reference); err != nil {
+		return err
+	}
+
+	existing := model.Payment{}
+	err := tx.Model(&existing).
+		Where("provider_id = ? and provider_ref = ?", provider.Value, charge.Reference).
+		Select()
+	if err == nil {
+		hook.Status = model.WebhookReconciled
+		hook.SiteID = existing.SiteID
+		hook.PaymentID = existing.ID
+		if !existing.Amount.Equal(charge.Amount) {
+			hook.Error = fmt.Sprintf("amount recorded %s, amount charged %s",
+				existing.Amount.StringFixed(2), charge.Amount.StringFixed(2))
+		}
+		return nil
+	}
+	if err != pg.ErrNoRows {
+		log.Debug(err)
+		return err
+	}
+
+	res, err := webhookResident(tx, siteID, charge)
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		hook.Status = model.WebhookUnmatched
+		hook.Error = "the payment could not be matched to a resident"
+		return nil
+	}
+
+	invDues := []InvDue{}
+	if v := metaString(charge.Meta, "dues"); len(v) > 0 {
+		if err := json.Unmarshal([]byte(v), &invDues); err != nil {
+			log.Debug(err)
+			return errors.New("invalid dues in payment metadata")
+		}
+	}
+
+	allocation := utils.Atoi(metaString(charge.Meta, "allocation"))
+	if allocation == 0 {
+		allocation = model.AllocateFIFO
+	}
+
+	attr := form.PayProviderResponse{
+		ProviderName: provider.Name,
+		ProviderID:   provider.Value,
+		ReferenceID:  charge.Reference,
+	}
+	if provider.Value == model.ProviderFlutterwave {
+		attr.TransactionID = charge.Reference
+	}
+
+	payment := &model.Payment{
+		ID:          xid.New().String(),
+		SiteID:      res.SiteID,
+		ResidentID:  res.ID,
+		DateTrx:     utils.NewDateTime(charge.Date),
+		Narration:   fmt.Sprintf("%s payment", provider.Name),
+		Amount:      charge.Amount,
+		PayMode:     model.OnlinePayment,
+		Allocation:  allocation,
+		Metadata:    charge.Raw,
+		ProviderID:  provider.Value,
+		ProviderRef: charge.Reference,
+	}
+	payment.Attr, _ = json.Marshal(attr)
+
+	if _, err := tx.Model(payment).Insert(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	if err := allocatePayment(tx, payment, payment.DateTrx, invDues); err != nil {
+		return err
+	}
+
+	payLog := &model.PaymentLog{
+		ID:        xid.New().String(),
+		SiteID:    payment.SiteID,
+		Operation: model.PaymentInsert,
+		Amount:    payment.Amount,
+
+		InitiatedBY: model.UserDetails{
+			Name: provider.Name,
+		},
+
+		InitiatedFor: model.UserDetails{
+			UserID:   res.ID,
+			UserType: model.ResidentUser,
+			Name:     res.Name,
+		},
+		Narration: fmt.Sprintf("Created new payment from %s webhook", provider.Name),
+	}
+	if _, err := tx.Model(payLog).Insert(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	// email receipt
+	eml, err := shared.MakeReceipt(tx, payment.ID)
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+	_, err = tx.Exec(`
+	insert into task_queue (site_id, type, data)
+		values(?, 1, ?)
+	`, payment.SiteID, &eml)
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	hook.Status = model.WebhookRecorded
+	hook.SiteID = payment.SiteID
+	hook.PaymentID = payment.ID
+
+	return nil
+}
+
+type webhookResidentInfo struct {
+	ID     string
+	SiteID string
+	Name   string
+}
+
+// webhookResident finds the resident from the payment metadata (site_id and resident_id
+// set when the payment was initialized) or, failing that, from the customer email
+func webhookResident(tx *pg.Tx, siteID string, charge *gateway.Charge) (*webhookResidentInfo, error) {
+	log := utils.Env.Log
+
+	residents := []webhookResidentInfo{}
+	qry := `
+		select
+			r.id, rs.site_id, concat(r.first_name, ' ', r.last_name) as name
+		from
+			resident as r
+		left join residency as rs
+			on rs.id = r.residency_id
+		where
+			r.type = ?0 and (?1 = '' or rs.site_id = ?1) and `
+
+	var err error
+	if residentID := metaString(charge.Meta, "resident_id"); len(residentID) > 0 {
+		_, err = tx.Query(&residents, qry+"r.id = ?2 and rs.site_id = ?3",
+			model.PrimaryResident, siteID, residentID, metaString(charge.Meta, "site_id"))
+	} else if len(charge.Email) > 0 {
+		_, err = tx.Query(&residents, qry+"lower(r.email) = lower(?2)", model.PrimaryResident, siteID, charge.Email)
+	} else {
+		return nil, nil
+	}
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	// an email used at several sites cannot be attributed
+	if len(residents) != 1 {
+		return nil, nil
+	}
+
+	return &residents[0], nil
+}
+
+// lockProviderRef serializes the recording of a provider reference between the client
+// flow and webhooks
+func lockProviderRef(tx *pg.Tx, provider model.PayProvider, ref string) error {
+	_, err := tx.Exec(`select pg_advisory_xact_lock(hashtext(?))`, fmt.Sprintf("payment:%d:%s", provider, ref))
+	if err != nil {
+		utils.Env.Log.Debug(err)
+	}
+
+	return err
+}
+
+// metaString reads a metadata value, flutterwave sends every value as a string
+func metaString(meta map[string]json.RawMessage, key string) string {
+	raw, found := meta[key]
+	if !found || string(raw) == "null" {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	if n, err := strconv.ParseFloat(string(raw), 64); err == nil {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+
+	return string(raw)
+}
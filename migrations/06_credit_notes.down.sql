@@ -0,0 +1,25 @@
+CREATE OR REPLACE VIEW account_history as
+select
+  	tr.resident_id, invoice_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, concat('0000000', cast(inv.invoice_number as varchar) ) as invoice_number
+  from transaction as tr
+  left join invoice as inv on inv.id = tr.invoice_id
+  where type = 2
+  group by tr.resident_id, tr.invoice_id, date_trunc('second', tr.date_trx), tr.type, inv.invoice_number
+ 
+union
+  select
+  	tr.resident_id, tr.payment_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, p.reference_id as invoice_number
+  from transaction as tr
+  left join payment as p on p.id = tr.payment_id
+  where type = 1
+  group by tr.resident_id, tr.payment_id, date_trunc('second', tr.date_trx), tr.type, invoice_number
+order by  date_trx
+;
+
+delete from "transaction" where type = 3;
+drop view if exists "credit_note_list";
+alter table "transaction" drop column if exists "credit_note_id";
+drop table if exists "credit_note";
+drop sequence if exists "credit_note_sequence";
@@ -0,0 +1,67 @@
+CREATE SEQUENCE credit_note_sequence;
+
+create table "credit_note" (
+  "id" varchar(25) PRIMARY KEY,
+  "site_id" varchar(25) NOT NULL REFERENCES "site"("id"),
+  "resident_id" varchar(25) NOT NULL REFERENCES "resident"("id"),
+  "invoice_id" varchar(25) REFERENCES "invoice"("id"),
+  "reference" varchar(20) NOT NULL DEFAULT 'CN' || lpad(nextval('credit_note_sequence')::text, 6, '0'),
+  -- 1: credit note, 2: discount, 3: waiver
+  "type" int NOT NULL DEFAULT 1,
+  -- 0: pending approval, 1: approved, 2: rejected
+  "status" int NOT NULL DEFAULT 0,
+  "percentage" numeric(5,2) NOT NULL DEFAULT 0,
+  "amount" numeric(15,2) NOT NULL DEFAULT 0,
+  -- array of {due_id, name, amount}
+  "dues" jsonb NOT NULL DEFAULT '[]',
+  "reason" text NOT NULL DEFAULT '',
+  "requested_by" jsonb NOT NULL DEFAULT '{}',
+  "approved_by" jsonb NOT NULL DEFAULT '{}',
+  "date_created" timestamp NOT NULL DEFAULT localtimestamp,
+  "date_approved" timestamp,
+  "attr" jsonb NOT NULL DEFAULT '{}'
+);
+
+-- 3: credit(credit note)
+alter table "transaction" add column "credit_note_id" varchar(25) REFERENCES "credit_note"("id");
+
+create view "credit_note_list" as
+select
+  cn.id, cn.site_id, cn.resident_id, cn.invoice_id, cn.reference,
+  cn.type, cn.status, cn.percentage, cn.amount, cn.dues, cn.reason,
+  cn.requested_by, cn.approved_by, cn.date_created, cn.date_approved,
+  lpad(i.invoice_number::varchar, 8, '0') as invoice_number,
+  concat(r.first_name, ' ', r.last_name) as "resident"
+from credit_note as cn
+left join "resident" as r on r.id = cn.resident_id
+left join "invoice" as i on i.id = cn.invoice_id
+;
+
+CREATE OR REPLACE VIEW account_history as
+select
+  	tr.resident_id, invoice_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, concat('0000000', cast(inv.invoice_number as varchar) ) as invoice_number
+  from transaction as tr
+  left join invoice as inv on inv.id = tr.invoice_id
+  where type = 2
+  group by tr.resident_id, tr.invoice_id, date_trunc('second', tr.date_trx), tr.type, inv.invoice_number
+ 
+union
+  select
+  	tr.resident_id, tr.payment_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, p.reference_id as invoice_number
+  from transaction as tr
+  left join payment as p on p.id = tr.payment_id
+  where type = 1
+  group by tr.resident_id, tr.payment_id, date_trunc('second', tr.date_trx), tr.type, invoice_number
+
+union
+  select
+  	tr.resident_id, tr.credit_note_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, cn.reference as invoice_number
+  from transaction as tr
+  left join credit_note as cn on cn.id = tr.credit_note_id
+  where type = 3
+  group by tr.resident_id, tr.credit_note_id, date_trunc('second', tr.date_trx), tr.type, cn.reference
+order by  date_trx
+;
@@ -0,0 +1,4 @@
+drop index if exists public.transaction_resident_invoice_idx;
+
+alter table public.payment_pending drop column if exists allocation;
+alter table public.payment drop column if exists allocation;
@@ -0,0 +1,7 @@
+-- allocation strategy used to split a payment across dues
+-- 1: oldest invoice first, 2: proportional, 3: explicit
+alter table public.payment add column allocation smallint not null default 1;
+alter table public.payment_pending add column allocation smallint not null default 1;
+
+-- transactions with no due are unallocated credit (over-payments)
+create index transaction_resident_invoice_idx on public.transaction (resident_id, invoice_id, due_id);
@@ -0,0 +1,2 @@
+drop table if exists "wallet_movement";
+drop table if exists "wallet";
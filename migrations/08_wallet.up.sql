@@ -0,0 +1,42 @@
+-- credit paid ahead by a primary resident, the balance mirrors the
+-- transactions with no due (unallocated credit)
+create table "wallet" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "resident_id" varchar(25) not null unique references "resident"("id"),
+  "balance" numeric(15,2) not null default 0,
+  -- apply the balance to new invoices at bill generation
+  "auto_apply" boolean not null default true,
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create table "wallet_movement" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "wallet_id" varchar(25) not null references "wallet"("id") on delete cascade,
+  "resident_id" varchar(25) not null references "resident"("id"),
+  -- 1: funded, 2: applied to an invoice
+  "type" smallint not null,
+  "amount" numeric(15,2) not null,
+  "payment_id" varchar(25),
+  "credit_note_id" varchar(25),
+  "invoice_id" varchar(25),
+  "narration" varchar(250) not null default '',
+  "created_by" jsonb not null default '{}',
+  "date_trx" timestamp not null default LOCALTIMESTAMP
+);
+
+create index wallet_movement_resident_idx on "wallet_movement" (resident_id, date_trx);
+
+-- wallets for credit recorded before wallets existed
+insert into "wallet" (id, site_id, resident_id, balance)
+  select
+    'w' || substr(md5(t.resident_id), 1, 19), t.site_id, t.resident_id, sum(t.amount)
+  from
+    transaction as t
+  where
+    t.due_id is null
+  group by
+    t.resident_id, t.site_id
+  having
+    sum(t.amount) > 0;
@@ -0,0 +1,3 @@
+drop view if exists payment_plan_list;
+drop table if exists "payment_plan_installment";
+drop table if exists "payment_plan";
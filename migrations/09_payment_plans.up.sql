@@ -0,0 +1,77 @@
+-- repayment plans agreed with residents in arrears
+create table "payment_plan" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "resident_id" varchar(25) not null references "resident"("id"),
+  "arrears" numeric(15,2) not null,
+  "installments" integer not null,
+  -- months between installments
+  "frequency" integer not null default 1,
+  "start_date" date not null,
+  -- 1: active, 2: completed, 3: cancelled
+  "status" smallint not null default 1,
+  "note" text not null default '',
+  "created_by" jsonb not null default '{}',
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+-- one active plan per resident
+create unique index payment_plan_active_idx on "payment_plan" (resident_id) where status = 1;
+
+create table "payment_plan_installment" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "plan_id" varchar(25) not null references "payment_plan"("id") on delete cascade,
+  "resident_id" varchar(25) not null references "resident"("id"),
+  "number" integer not null,
+  "due_date" date not null,
+  "amount" numeric(15,2) not null,
+  "paid" numeric(15,2) not null default 0,
+  -- 0: pending, 1: paid, 2: missed
+  "status" smallint not null default 0,
+  "date_paid" timestamp,
+  "date_notified" timestamp
+);
+
+create index payment_plan_installment_due_idx on "payment_plan_installment" (status, due_date);
+
+CREATE VIEW payment_plan_list as
+with "schedule" as (
+select
+  i.plan_id,
+  sum(i.paid) as paid,
+  sum(i.amount - i.paid) as outstanding,
+  count(*) filter (where i.status = 2) as missed,
+  min(i.due_date) filter (where i.status <> 1) as next_due_date
+from
+  payment_plan_installment as i
+group by
+  i.plan_id
+)
+select
+  p.id,
+  p.site_id,
+  p.resident_id,
+  concat(r.first_name, ' ', r.last_name) as resident,
+  p.arrears,
+  p.installments,
+  p.frequency,
+  p.start_date,
+  p.status,
+  p.note,
+  coalesce(s.paid, 0) as paid,
+  coalesce(s.outstanding, 0) as outstanding,
+  coalesce(s.missed, 0) as missed,
+  s.next_due_date,
+  coalesce((
+    select n.amount - n.paid from payment_plan_installment as n
+    where n.plan_id = p.id and n.due_date = s.next_due_date limit 1
+  ), 0) as next_amount,
+  p.date_created
+from
+  payment_plan as p
+left join resident as r
+  on r.id = p.resident_id
+left join "schedule" as s
+  on s.plan_id = p.id
+;
@@ -0,0 +1,100 @@
+-- restore the global invoice numbers
+CREATE OR REPLACE VIEW account_history as
+select
+  	tr.resident_id, invoice_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, concat('0000000', cast(inv.invoice_number as varchar) ) as invoice_number
+  from transaction as tr
+  left join invoice as inv on inv.id = tr.invoice_id
+  where type = 2
+  group by tr.resident_id, tr.invoice_id, date_trunc('second', tr.date_trx), tr.type, inv.invoice_number
+ 
+union
+  select
+  	tr.resident_id, tr.payment_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, p.reference_id as invoice_number
+  from transaction as tr
+  left join payment as p on p.id = tr.payment_id
+  where type = 1
+  group by tr.resident_id, tr.payment_id, date_trunc('second', tr.date_trx), tr.type, invoice_number
+
+union
+  select
+  	tr.resident_id, tr.credit_note_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, cn.reference as invoice_number
+  from transaction as tr
+  left join credit_note as cn on cn.id = tr.credit_note_id
+  where type = 3
+  group by tr.resident_id, tr.credit_note_id, date_trunc('second', tr.date_trx), tr.type, cn.reference
+order by  date_trx
+;
+
+create or replace view "credit_note_list" as
+select
+  cn.id, cn.site_id, cn.resident_id, cn.invoice_id, cn.reference,
+  cn.type, cn.status, cn.percentage, cn.amount, cn.dues, cn.reason,
+  cn.requested_by, cn.approved_by, cn.date_created, cn.date_approved,
+  lpad(i.invoice_number::varchar, 8, '0') as invoice_number,
+  concat(r.first_name, ' ', r.last_name) as "resident"
+from credit_note as cn
+left join "resident" as r on r.id = cn.resident_id
+left join "invoice" as i on i.id = cn.invoice_id
+;
+
+drop view if exists "reporting_invoice";
+drop view if exists "invoice_list";
+
+CREATE VIEW "invoice_list" AS
+with inv_trx as (
+  select
+  	t.invoice_id,
+    json_agg(
+        json_build_object('due_id', t.due_id, 'amount', t.amount, 'due', d.name)
+    ) as dues
+
+  	from
+  		transaction as t
+  		left outer join due as d on d.id = t.due_id
+
+ 	where
+  		t.type = 2
+
+  	group by
+  		t.invoice_id
+
+)
+select
+  i.id, i.site_id, i.invoice_number, i.resident_id,
+  i.first_name, i.last_name, i.address,
+  i.month, i.year, i.date_created,
+  i.bill_id, i.unit_type,
+  i.description, i.amount,
+  t.dues,
+  concat(i.first_name, ' ', i.last_name) as resident,
+  u.label as unit_type_label
+
+from
+  invoice as i
+  left join unit_type as u
+    on u.id = i.unit_type
+
+  left join inv_trx as t
+    on t.invoice_id = i.id
+;
+
+create view "reporting_invoice" as
+select
+i.id, i.site_id, i.resident_id,
+i.first_name, i.last_name, i.address,
+i.month, i.year, i.date_created,
+i.bill_id, i.unit_type,
+i.description, i.amount,
+i.dues,
+lpad(i.invoice_number::varchar, 8, '0') as invoice_number,
+concat(i.first_name, ' ', i.last_name) as resident
+from invoice_list as i
+left join unit_type as ut on ut.id = i.unit_type
+;
+
+drop index if exists invoice_site_no_idx;
+alter table "invoice" drop column if exists "invoice_no";
+drop table if exists "invoice_series";
@@ -0,0 +1,116 @@
+-- per site invoice numbering, numbers are allocated in the bill generation transaction
+create table "invoice_series" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null unique references "site"("id"),
+  "prefix" varchar(20) not null default 'INV',
+  -- tokens: {prefix}, {year}, {number}
+  "format" varchar(50) not null default '{prefix}-{year}-{number}',
+  -- digits {number} is zero padded to
+  "padding" smallint not null default 4,
+  "reset_yearly" boolean not null default true,
+  -- year of the last number issued
+  "year" integer not null default 0,
+  "next_number" bigint not null default 1,
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+alter table "invoice" add column "invoice_no" varchar(50) not null default '';
+
+-- existing invoices keep their global number
+update "invoice" set invoice_no = lpad(invoice_number::varchar, 8, '0');
+
+create unique index invoice_site_no_idx on "invoice" (site_id, invoice_no) where invoice_no <> '';
+
+CREATE OR REPLACE VIEW "invoice_list" AS
+with inv_trx as (
+  select
+  	t.invoice_id,
+    json_agg(
+        json_build_object('due_id', t.due_id, 'amount', t.amount, 'due', d.name)
+    ) as dues
+
+  	from
+  		transaction as t
+  		left outer join due as d on d.id = t.due_id
+
+ 	where
+  		t.type = 2
+
+  	group by
+  		t.invoice_id
+
+)
+select
+  i.id, i.site_id, i.invoice_number, i.resident_id,
+  i.first_name, i.last_name, i.address,
+  i.month, i.year, i.date_created,
+  i.bill_id, i.unit_type,
+  i.description, i.amount,
+  t.dues,
+  concat(i.first_name, ' ', i.last_name) as resident,
+  u.label as unit_type_label,
+  i.invoice_no
+
+from
+  invoice as i
+  left join unit_type as u
+    on u.id = i.unit_type
+
+  left join inv_trx as t
+    on t.invoice_id = i.id
+;
+
+create or replace view "reporting_invoice" as
+select
+i.id, i.site_id, i.resident_id,
+i.first_name, i.last_name, i.address,
+i.month, i.year, i.date_created,
+i.bill_id, i.unit_type,
+i.description, i.amount,
+i.dues,
+i.invoice_no::text as invoice_number,
+concat(i.first_name, ' ', i.last_name) as resident
+from invoice_list as i
+left join unit_type as ut on ut.id = i.unit_type
+;
+
+create or replace view "credit_note_list" as
+select
+  cn.id, cn.site_id, cn.resident_id, cn.invoice_id, cn.reference,
+  cn.type, cn.status, cn.percentage, cn.amount, cn.dues, cn.reason,
+  cn.requested_by, cn.approved_by, cn.date_created, cn.date_approved,
+  i.invoice_no::text as invoice_number,
+  concat(r.first_name, ' ', r.last_name) as "resident"
+from credit_note as cn
+left join "resident" as r on r.id = cn.resident_id
+left join "invoice" as i on i.id = cn.invoice_id
+;
+
+CREATE OR REPLACE VIEW account_history as
+select
+  	tr.resident_id, invoice_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, inv.invoice_no::text as invoice_number
+  from transaction as tr
+  left join invoice as inv on inv.id = tr.invoice_id
+  where type = 2
+  group by tr.resident_id, tr.invoice_id, date_trunc('second', tr.date_trx), tr.type, inv.invoice_no
+ 
+union
+  select
+  	tr.resident_id, tr.payment_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, p.reference_id as invoice_number
+  from transaction as tr
+  left join payment as p on p.id = tr.payment_id
+  where type = 1
+  group by tr.resident_id, tr.payment_id, date_trunc('second', tr.date_trx), tr.type, invoice_number
+
+union
+  select
+  	tr.resident_id, tr.credit_note_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, cn.reference as invoice_number
+  from transaction as tr
+  left join credit_note as cn on cn.id = tr.credit_note_id
+  where type = 3
+  group by tr.resident_id, tr.credit_note_id, date_trunc('second', tr.date_trx), tr.type, cn.reference
+order by  date_trx
+;
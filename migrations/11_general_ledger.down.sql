@@ -0,0 +1,5 @@
+drop view if exists "trial_balance";
+drop view if exists "ledger_list";
+drop table if exists "journal_line";
+drop table if exists "journal";
+drop table if exists "ledger_account";
@@ -0,0 +1,201 @@
+-- chart of accounts per site
+create table "ledger_account" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "code" varchar(20) not null,
+  "name" varchar(250) not null,
+  -- 1: asset, 2: liability, 3: equity, 4: income, 5: expense
+  "type" smallint not null,
+  -- accounts posted to by the system
+  -- 0: other, 1: bank / cash, 2: receivable, 3: resident wallets, 4: income, 5: discounts and waivers
+  "kind" smallint not null default 0,
+  -- due id for receivable and income accounts, pay mode for bank accounts,
+  -- credit note type for discounts and waivers
+  "ref" varchar(25) not null default '',
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create unique index ledger_account_code_idx on "ledger_account" (site_id, code);
+create unique index ledger_account_kind_idx on "ledger_account" (site_id, kind, ref) where kind > 0;
+
+create table "journal" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "resident_id" varchar(25) references "resident"("id"),
+  "date_trx" timestamp not null default LOCALTIMESTAMP,
+  -- 1: payment, 2: invoice, 3: credit note, 4: wallet applied, 5: manual
+  "source_type" smallint not null,
+  -- payment, invoice or credit note id
+  "source_id" varchar(25) not null default '',
+  "narration" text not null default '',
+  "reversal_of" varchar(25) references "journal"("id"),
+  "reversed" boolean not null default false,
+  "created_by" jsonb not null default '{}',
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create index journal_source_idx on "journal" (site_id, source_id);
+
+create table "journal_line" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "journal_id" varchar(25) not null references "journal"("id") on delete cascade,
+  "account_id" varchar(25) not null references "ledger_account"("id"),
+  "debit" numeric(15,2) not null default 0,
+  "credit" numeric(15,2) not null default 0
+);
+
+create index journal_line_account_idx on "journal_line" (account_id);
+create index journal_line_journal_idx on "journal_line" (journal_id);
+
+create view "ledger_list" as
+select
+  l.id, l.site_id, l.journal_id, l.account_id,
+  a.code as account_code, a.name as account, a.type as account_type,
+  j.resident_id, concat(r.first_name, ' ', r.last_name) as resident,
+  j.date_trx, j.source_type, j.source_id, j.narration,
+  l.debit, l.credit,
+  sum(l.debit - l.credit) over (
+    partition by l.account_id order by j.date_trx, j.date_created, l.id
+  ) as balance
+from journal_line as l
+join journal as j on j.id = l.journal_id
+join ledger_account as a on a.id = l.account_id
+left join resident as r on r.id = j.resident_id
+;
+
+create view "trial_balance" as
+select
+  a.id, a.site_id, a.code, a.name, a.type, a.kind,
+  coalesce(sum(l.debit), 0) as debit,
+  coalesce(sum(l.credit), 0) as credit,
+  coalesce(sum(l.debit - l.credit), 0) as balance
+from ledger_account as a
+left join journal_line as l on l.account_id = a.id
+group by a.id
+;
+
+-- accounts for the existing dues, pay modes, wallets and credit notes
+insert into "ledger_account" (id, site_id, code, name, type, kind, ref)
+  select
+    'a' || substr(md5(d.site_id || '2' || d.id), 1, 19), d.site_id,
+    (1200 + row_number() over (partition by d.site_id order by d.date_created, d.id))::varchar,
+    d.name || ' receivable', 1, 2, d.id
+  from due as d
+  where d.site_id is not null;
+
+insert into "ledger_account" (id, site_id, code, name, type, kind, ref)
+  select
+    'a' || substr(md5(d.site_id || '4' || d.id), 1, 19), d.site_id,
+    (4000 + row_number() over (partition by d.site_id order by d.date_created, d.id))::varchar,
+    d.name, 4, 4, d.id
+  from due as d
+  where d.site_id is not null;
+
+insert into "ledger_account" (id, site_id, code, name, type, kind, ref)
+  select distinct
+    'a' || substr(md5(p.site_id || '1' || p.pay_mode::varchar), 1, 19), p.site_id,
+    (1000 + p.pay_mode)::varchar,
+    (case p.pay_mode when 0 then 'Cash' when 1 then 'Online collections' else 'Bank' end),
+    1, 1, p.pay_mode::varchar
+  from payment as p;
+
+insert into "ledger_account" (id, site_id, code, name, type, kind, ref)
+  select
+    'a' || substr(md5(s.id || '3'), 1, 19), s.id, '2100', 'Resident wallets', 2, 3, ''
+  from site as s;
+
+insert into "ledger_account" (id, site_id, code, name, type, kind, ref)
+  select distinct
+    'a' || substr(md5(cn.site_id || '5' || cn.type::varchar), 1, 19), cn.site_id,
+    (5100 + cn.type)::varchar,
+    (case cn.type when 1 then 'Credit notes' when 2 then 'Discounts' else 'Waivers' end),
+    5, 5, cn.type::varchar
+  from credit_note as cn
+  where cn.status = 1;
+
+-- journals for the existing documents, wallet use is netted into the document
+-- that funded the wallet
+insert into "journal" (id, site_id, resident_id, date_trx, source_type, source_id, narration)
+  select
+    'j' || substr(md5('2' || i.id), 1, 19), i.site_id, i.resident_id, i.date_created, 2, i.id,
+    'Invoice ' || i.invoice_no
+  from invoice as i
+  where exists (select 1 from transaction as t where t.invoice_id = i.id and t.type = 2 and t.due_id is not null);
+
+insert into "journal_line" (id, site_id, journal_id, account_id, debit, credit)
+  select
+    'l' || substr(md5(random()::text), 1, 19), t.site_id, 'j' || substr(md5('2' || t.invoice_id), 1, 19),
+    'a' || substr(md5(t.site_id || '2' || t.due_id), 1, 19), -sum(t.amount), 0
+  from transaction as t
+  where t.type = 2 and t.due_id is not null
+  group by t.site_id, t.invoice_id, t.due_id;
+
+insert into "journal_line" (id, site_id, journal_id, account_id, debit, credit)
+  select
+    'l' || substr(md5(random()::text), 1, 19), t.site_id, 'j' || substr(md5('2' || t.invoice_id), 1, 19),
+    'a' || substr(md5(t.site_id || '4' || t.due_id), 1, 19), 0, -sum(t.amount)
+  from transaction as t
+  where t.type = 2 and t.due_id is not null
+  group by t.site_id, t.invoice_id, t.due_id;
+
+insert into "journal" (id, site_id, resident_id, date_trx, source_type, source_id, narration)
+  select
+    'j' || substr(md5('1' || p.id), 1, 19), p.site_id, p.resident_id, p.date_trx, 1, p.id,
+    'Payment ' || p.reference_id
+  from payment as p
+  where exists (select 1 from transaction as t where t.payment_id = p.id and t.type = 1);
+
+insert into "journal_line" (id, site_id, journal_id, account_id, debit, credit)
+  select
+    'l' || substr(md5(random()::text), 1, 19), p.site_id, 'j' || substr(md5('1' || p.id), 1, 19),
+    'a' || substr(md5(p.site_id || '1' || p.pay_mode::varchar), 1, 19), sum(t.amount), 0
+  from transaction as t
+  join payment as p on p.id = t.payment_id
+  where t.type = 1
+  group by p.id, p.site_id, p.pay_mode
+  having sum(t.amount) <> 0;
+
+insert into "journal_line" (id, site_id, journal_id, account_id, debit, credit)
+  select
+    'l' || substr(md5(random()::text), 1, 19), t.site_id, 'j' || substr(md5('1' || t.payment_id), 1, 19),
+    (case when t.due_id is null
+      then 'a' || substr(md5(t.site_id || '3'), 1, 19)
+      else 'a' || substr(md5(t.site_id || '2' || t.due_id), 1, 19)
+    end),
+    0, sum(t.amount)
+  from transaction as t
+  where t.type = 1 and t.payment_id is not null
+  group by t.site_id, t.payment_id, t.due_id
+  having sum(t.amount) <> 0;
+
+insert into "journal" (id, site_id, resident_id, date_trx, source_type, source_id, narration)
+  select
+    'j' || substr(md5('3' || cn.id), 1, 19), cn.site_id, cn.resident_id,
+    coalesce(cn.date_approved, cn.date_created), 3, cn.id,
+    'Credit note ' || cn.reference
+  from credit_note as cn
+  where exists (select 1 from transaction as t where t.credit_note_id = cn.id and t.type = 3);
+
+insert into "journal_line" (id, site_id, journal_id, account_id, debit, credit)
+  select
+    'l' || substr(md5(random()::text), 1, 19), cn.site_id, 'j' || substr(md5('3' || cn.id), 1, 19),
+    'a' || substr(md5(cn.site_id || '5' || cn.type::varchar), 1, 19), sum(t.amount), 0
+  from transaction as t
+  join credit_note as cn on cn.id = t.credit_note_id
+  where t.type = 3
+  group by cn.id, cn.site_id, cn.type
+  having sum(t.amount) <> 0;
+
+insert into "journal_line" (id, site_id, journal_id, account_id, debit, credit)
+  select
+    'l' || substr(md5(random()::text), 1, 19), t.site_id, 'j' || substr(md5('3' || t.credit_note_id), 1, 19),
+    (case when t.due_id is null
+      then 'a' || substr(md5(t.site_id || '3'), 1, 19)
+      else 'a' || substr(md5(t.site_id || '2' || t.due_id), 1, 19)
+    end),
+    0, sum(t.amount)
+  from transaction as t
+  where t.type = 3 and t.credit_note_id is not null
+  group by t.site_id, t.credit_note_id, t.due_id
+  having sum(t.amount) <> 0;
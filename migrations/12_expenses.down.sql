@@ -0,0 +1,6 @@
+drop view if exists "budget_vs_actual";
+drop view if exists "expense_list";
+drop table if exists "budget";
+drop table if exists "expense";
+drop table if exists "vendor";
+drop table if exists "expense_category";
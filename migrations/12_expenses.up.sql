@@ -0,0 +1,111 @@
+-- expense categories post to ledger_account kind 6 (ref category id),
+-- approved expenses are journal source_type 6
+create table "expense_category" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "name" varchar(250) not null,
+  "description" text not null default '',
+  -- the due that funds the category, used for budget vs actual
+  "due_id" varchar(25) references "due"("id"),
+  "status" int not null default 1,
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create unique index expense_category_name_idx on "expense_category" (site_id, name);
+
+create table "vendor" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "name" varchar(250) not null,
+  "phone" varchar(50) not null default '',
+  "email" varchar(250) not null default '',
+  "address" text not null default '',
+  -- bank name, account number etc.
+  "attr" jsonb not null default '{}',
+  "status" int not null default 1,
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create table "expense" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "category_id" varchar(25) not null references "expense_category"("id"),
+  "vendor_id" varchar(25) references "vendor"("id"),
+  "due_id" varchar(25) references "due"("id"),
+  "date_trx" timestamp not null default LOCALTIMESTAMP,
+  "amount" numeric(15,2) not null,
+  "description" text not null default '',
+  -- vendor invoice / cheque number
+  "reference" varchar(100) not null default '',
+  "pay_mode" int not null default 0,
+  -- [{receipt: {data: url, name, size}}]
+  "receipts" jsonb not null default '[]',
+  -- 0: pending approval, 1: approved, 2: rejected
+  "status" int not null default 0,
+  "requested_by" jsonb not null default '{}',
+  "approved_by" jsonb not null default '{}',
+  "date_approved" timestamp,
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create index expense_site_idx on "expense" (site_id, date_trx);
+
+-- annual budget per due
+create table "budget" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "year" int not null,
+  "due_id" varchar(25) not null references "due"("id"),
+  "amount" numeric(15,2) not null default 0,
+  "note" text not null default '',
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create unique index budget_due_idx on "budget" (site_id, year, due_id);
+
+create view "expense_list" as
+select
+  e.id, e.site_id, e.category_id, e.vendor_id, e.due_id, e.date_trx, e.amount,
+  e.description, e.reference, e.pay_mode, e.receipts, e.status,
+  e.requested_by, e.approved_by, e.date_approved, e.date_created,
+  c.name as category, v.name as vendor, d.name as due
+from expense as e
+join expense_category as c on c.id = e.category_id
+left join vendor as v on v.id = e.vendor_id
+left join due as d on d.id = e.due_id
+;
+
+-- budget against invoiced and collected dues and approved expenses, per due and year
+create view "budget_vs_actual" as
+with lines as (
+  select site_id, year, due_id, amount as budget, 0 as invoiced, 0 as collected, 0 as spent
+  from budget
+
+  union all
+  select site_id, extract(year from date_trx)::int, due_id, 0, -amount, 0, 0
+  from transaction
+  where type = 2 and due_id is not null
+
+  union all
+  select site_id, extract(year from date_trx)::int, due_id, 0, 0, amount, 0
+  from transaction
+  where type = 1 and due_id is not null
+
+  union all
+  select site_id, extract(year from date_trx)::int, due_id, 0, 0, 0, amount
+  from expense
+  where status = 1 and due_id is not null
+)
+select
+  concat(l.site_id, '-', l.year, '-', l.due_id) as id,
+  l.site_id, l.year, l.due_id, d.name as due,
+  sum(l.budget) as budget,
+  sum(l.invoiced) as invoiced,
+  sum(l.collected) as collected,
+  sum(l.spent) as spent,
+  sum(l.budget) - sum(l.spent) as variance,
+  sum(l.collected) - sum(l.spent) as surplus
+from lines as l
+join due as d on d.id = l.due_id
+group by l.site_id, l.year, l.due_id, d.name
+;
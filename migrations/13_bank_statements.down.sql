@@ -0,0 +1,3 @@
+drop view if exists "bank_statement_line_list";
+drop table if exists "bank_statement_line";
+drop table if exists "bank_statement";
@@ -0,0 +1,52 @@
+-- bank statements imported by officials (csv or ofx)
+create table "bank_statement" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "file_name" varchar(250) not null default '',
+  "format" varchar(10) not null,
+  -- account number reported by the bank (ofx)
+  "account" varchar(50) not null default '',
+  "date_from" timestamp,
+  "date_to" timestamp,
+  "credits" int not null default 0,
+  "duplicates" int not null default 0,
+  "imported_by" jsonb not null default '{}',
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+-- the credits of a statement and what they were matched / reconciled to
+create table "bank_statement_line" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "statement_id" varchar(25) not null references "bank_statement"("id") on delete cascade,
+  "date_trx" timestamp not null,
+  "amount" numeric(15,2) not null,
+  "narration" text not null default '',
+  -- bank reference (ofx fitid) or a hash of the line, used to skip lines already imported
+  "reference" varchar(100) not null,
+  -- 0: unmatched, 1: matched (suggested), 2: reconciled, 3: ignored
+  "status" smallint not null default 0,
+  -- 1: pending payment, 2: resident
+  "match_type" smallint not null default 0,
+  "pending_id" varchar(25),
+  "resident_id" varchar(25) references "resident"("id"),
+  "score" int not null default 0,
+  "payment_id" varchar(25) references "payment"("id"),
+  "reconciled_by" jsonb not null default '{}',
+  "date_reconciled" timestamp
+);
+
+create unique index bank_statement_line_ref_idx on "bank_statement_line" (site_id, reference);
+create index bank_statement_line_status_idx on "bank_statement_line" (site_id, status);
+
+create view "bank_statement_line_list" as
+select
+  l.*,
+  concat(r.first_name, ' ', r.last_name) as resident,
+  p.narration as pending_narration,
+  p.amount as pending_amount,
+  p.date_trx as pending_date
+from bank_statement_line as l
+left join resident as r on r.id = l.resident_id
+left join payment_pending as p on p.id = l.pending_id
+;
@@ -0,0 +1,4 @@
+drop table if exists "payment_webhook";
+drop index if exists payment_provider_ref_idx;
+alter table "payment" drop column if exists "provider_ref";
+alter table "payment" drop column if exists "provider_id";
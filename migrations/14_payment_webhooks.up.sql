@@ -0,0 +1,45 @@
+-- provider reference of online payments, a payment is recorded once per reference
+-- whether it arrives through the client or a provider webhook
+alter table "payment" add column "provider_id" smallint not null default 0;
+alter table "payment" add column "provider_ref" varchar(100);
+
+with "online" as (
+  select
+    id,
+    (attr->>'provider_id')::int as provider,
+    case (attr->>'provider_id')::int
+      when 1 then attr->>'reference_id'
+      when 3 then attr->>'transaction_id'
+    end as provider_ref
+  from payment
+  where pay_mode = 1 and attr->>'provider_id' in ('1', '3')
+), "first" as (
+  select
+    id, provider, provider_ref,
+    row_number() over (partition by provider, provider_ref order by date_trx, id) as n
+  from online
+  where coalesce(provider_ref, '') <> ''
+)
+update payment as p
+set provider_id = f.provider, provider_ref = f.provider_ref
+from first as f
+where f.id = p.id and f.n = 1;
+
+create unique index payment_provider_ref_idx on "payment" (provider_id, provider_ref) where provider_ref is not null;
+
+-- webhook events received from payment providers
+create table "payment_webhook" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) references "site"("id"),
+  "provider" smallint not null,
+  "event" varchar(50) not null default '',
+  "reference" varchar(100) not null default '',
+  -- 1: recorded, 2: reconciled (already recorded), 3: ignored, 4: unmatched, 5: failed
+  "status" smallint not null default 0,
+  "payment_id" varchar(25) references "payment"("id") on delete set null,
+  "payload" jsonb not null default '{}',
+  "error" text not null default '',
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create index payment_webhook_reference_idx on "payment_webhook" (provider, reference);
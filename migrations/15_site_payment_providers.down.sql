@@ -0,0 +1 @@
+drop table if exists "site_payment_provider";
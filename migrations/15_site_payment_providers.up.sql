@@ -0,0 +1,18 @@
+-- payment provider keys of a site, sites without keys use the platform keys from config
+create table "site_payment_provider" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "provider_id" smallint not null,
+  "public_key" varchar(200) not null default '',
+  "secret_key" varchar(200) not null default '',
+  "encryption_key" varchar(200) not null default '',
+  "webhook_hash" varchar(200) not null default '',
+  -- remita biller
+  "merchant_id" varchar(50) not null default '',
+  "service_type_id" varchar(50) not null default '',
+  "live" boolean not null default false,
+  "active" boolean not null default true,
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create unique index site_payment_provider_idx on "site_payment_provider" (site_id, provider_id);
@@ -0,0 +1 @@
+drop table if exists "idempotency_key";
@@ -0,0 +1,18 @@
+-- responses of requests sent with an Idempotency-Key header, replayed when the client retries
+create table "idempotency_key" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null default '',
+  "user_id" varchar(25) not null,
+  "key" varchar(200) not null,
+  "method" varchar(10) not null,
+  "path" varchar(200) not null,
+  "request_hash" varchar(64) not null,
+  -- 0: in progress, 1: complete
+  "status" smallint not null default 0,
+  "response_status" integer not null default 0,
+  "content_type" varchar(100) not null default '',
+  "response_body" bytea,
+  "date_created" timestamp not null default LOCALTIMESTAMP
+);
+
+create unique index idempotency_key_idx on "idempotency_key" (site_id, user_id, key);
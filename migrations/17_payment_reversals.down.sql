@@ -0,0 +1,64 @@
+-- restore the account history and payment list without reversals
+CREATE OR REPLACE VIEW account_history as
+select
+  	tr.resident_id, invoice_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, inv.invoice_no::text as invoice_number
+  from transaction as tr
+  left join invoice as inv on inv.id = tr.invoice_id
+  where type = 2
+  group by tr.resident_id, tr.invoice_id, date_trunc('second', tr.date_trx), tr.type, inv.invoice_no
+ 
+union
+  select
+  	tr.resident_id, tr.payment_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, p.reference_id as invoice_number
+  from transaction as tr
+  left join payment as p on p.id = tr.payment_id
+  where type = 1
+  group by tr.resident_id, tr.payment_id, date_trunc('second', tr.date_trx), tr.type, invoice_number
+
+union
+  select
+  	tr.resident_id, tr.credit_note_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, cn.reference as invoice_number
+  from transaction as tr
+  left join credit_note as cn on cn.id = tr.credit_note_id
+  where type = 3
+  group by tr.resident_id, tr.credit_note_id, date_trunc('second', tr.date_trx), tr.type, cn.reference
+order by  date_trx
+;
+
+drop view if exists "payment_list";
+CREATE VIEW "payment_list" AS
+select
+  p.id,
+  p.site_id,
+  p.resident_id,
+  p.date_trx,
+  p.narration,
+  p.amount,
+  p.pay_mode,
+  p.dues,
+  p.attr,
+  ut.label as unit_type_label,
+  p.reference_id,
+  r.first_name,
+  r.last_name,
+  rl.unit_type,
+  concat(r.first_name, ' ', r.last_name) as "resident"
+
+from
+  payment as p
+left join "resident" as r
+  on r.id = p.resident_id
+left join "resident_list" as rl
+  on rl.id = r.id
+left join "unit_type" as ut
+  on ut.id = rl.unit_type
+;
+
+delete from "transaction" where type = 4;
+drop view if exists "payment_reversal_list";
+drop table if exists "payment_reversal";
+drop sequence if exists payment_reversal_sequence;
+alter table "payment" drop column if exists "status";
@@ -0,0 +1,107 @@
+-- 0: active, 1: reversal pending approval, 2: reversed
+alter table "payment" add column "status" smallint not null default 0;
+
+create sequence payment_reversal_sequence;
+
+create table "payment_reversal" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "payment_id" varchar(25) not null references "payment"("id"),
+  "resident_id" varchar(25) not null references "resident"("id"),
+  "reference" varchar(20) not null default 'RV' || lpad(nextval('payment_reversal_sequence')::text, 6, '0'),
+  "amount" numeric(15,2) not null default 0,
+  "reason" text not null default '',
+  -- 0: pending approval, 1: approved, 2: rejected
+  "status" smallint not null default 0,
+  -- 0: no refund, 1: refunded by the provider, 2: to be refunded by hand
+  "refund_status" smallint not null default 0,
+  "refund_reference" varchar(100) not null default '',
+  "requested_by" jsonb not null default '{}',
+  "approved_by" jsonb not null default '{}',
+  "date_created" timestamp not null default localtimestamp,
+  "date_approved" timestamp,
+  "attr" jsonb not null default '{}'
+);
+
+-- a payment has at most one reversal that is pending or approved
+create unique index payment_reversal_payment_idx on "payment_reversal" (payment_id) where status <> 2;
+
+create view "payment_reversal_list" as
+select
+  pr.id, pr.site_id, pr.payment_id, pr.resident_id, pr.reference, pr.amount, pr.reason,
+  pr.status, pr.refund_status, pr.refund_reference, pr.requested_by, pr.approved_by,
+  pr.date_created, pr.date_approved,
+  p.date_trx, p.pay_mode, p.reference_id,
+  concat(r.first_name, ' ', r.last_name) as "resident"
+from payment_reversal as pr
+left join "payment" as p on p.id = pr.payment_id
+left join "resident" as r on r.id = pr.resident_id
+;
+
+create or replace view "payment_list" as
+select
+  p.id,
+  p.site_id,
+  p.resident_id,
+  p.date_trx,
+  p.narration,
+  p.amount,
+  p.pay_mode,
+  p.dues,
+  p.attr,
+  ut.label as unit_type_label,
+  p.reference_id,
+  r.first_name,
+  r.last_name,
+  rl.unit_type,
+  concat(r.first_name, ' ', r.last_name) as "resident",
+  p.status
+
+from
+  payment as p
+left join "resident" as r
+  on r.id = p.resident_id
+left join "resident_list" as rl
+  on rl.id = r.id
+left join "unit_type" as ut
+  on ut.id = rl.unit_type
+;
+
+-- 4: reversal of a payment, the transactions keep the payment id
+create or replace view account_history as
+select
+  	tr.resident_id, invoice_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, inv.invoice_no::text as invoice_number
+  from transaction as tr
+  left join invoice as inv on inv.id = tr.invoice_id
+  where type = 2
+  group by tr.resident_id, tr.invoice_id, date_trunc('second', tr.date_trx), tr.type, inv.invoice_no
+ 
+union
+  select
+  	tr.resident_id, tr.payment_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, p.reference_id as invoice_number
+  from transaction as tr
+  left join payment as p on p.id = tr.payment_id
+  where type = 1
+  group by tr.resident_id, tr.payment_id, date_trunc('second', tr.date_trx), tr.type, invoice_number
+
+union
+  select
+  	tr.resident_id, tr.credit_note_id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, cn.reference as invoice_number
+  from transaction as tr
+  left join credit_note as cn on cn.id = tr.credit_note_id
+  where type = 3
+  group by tr.resident_id, tr.credit_note_id, date_trunc('second', tr.date_trx), tr.type, cn.reference
+
+union
+  select
+  	tr.resident_id, pr.id as document_id, sum(tr.amount) as amount, date_trunc('second', tr.date_trx) as date_trx, 
+    tr.type, pr.reference as invoice_number
+  from transaction as tr
+  left join payment_reversal as pr on pr.payment_id = tr.payment_id and pr.status = 1
+  where type = 4
+  group by tr.resident_id, pr.id, date_trunc('second', tr.date_trx), tr.type, pr.reference
+order by  date_trx
+;
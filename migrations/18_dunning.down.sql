@@ -0,0 +1,4 @@
+drop view if exists "dunning_history_list";
+drop table if exists "dunning_history";
+drop table if exists "resident_dunning";
+drop table if exists "dunning_policy";
@@ -0,0 +1,60 @@
+-- how a site chases overdue accounts, stages is an array of
+-- {days, name, subject, message, template, email, push, final, restrict_gate_pass, flag_at_gate}
+create table "dunning_policy" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "name" varchar(100) not null default '',
+  "active" boolean not null default true,
+  -- balances owed below this amount are not chased
+  "min_balance" numeric(15,2) not null default 0,
+  -- hour of the day (0 - 23) the policy runs
+  "run_hour" smallint not null default 9,
+  "stages" jsonb not null default '[]',
+  "date_last_run" timestamp,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create unique index dunning_policy_site_idx on "dunning_policy" (site_id);
+
+-- the stage a resident has reached, removed when the account is settled
+create table "resident_dunning" (
+  "resident_id" varchar(25) primary key references "resident"("id"),
+  "site_id" varchar(25) not null references "site"("id"),
+  "policy_id" varchar(25) not null references "dunning_policy"("id") on delete cascade,
+  "stage" smallint not null default 0,
+  "stage_name" varchar(100) not null default '',
+  "days_overdue" integer not null default 0,
+  "balance" numeric(15,2) not null default 0,
+  "restrict_gate_pass" boolean not null default false,
+  "flag_at_gate" boolean not null default false,
+  "date_started" timestamp not null default localtimestamp,
+  "date_updated" timestamp not null default localtimestamp
+);
+
+create table "dunning_history" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "resident_id" varchar(25) not null references "resident"("id"),
+  "policy_id" varchar(25) references "dunning_policy"("id") on delete set null,
+  -- 0: account settled
+  "stage" smallint not null default 0,
+  "stage_name" varchar(100) not null default '',
+  "days_overdue" integer not null default 0,
+  "balance" numeric(15,2) not null default 0,
+  "email" boolean not null default false,
+  "push" boolean not null default false,
+  -- actions applied at this stage, e.g. restrict_gate_pass
+  "actions" jsonb not null default '[]',
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index dunning_history_resident_idx on "dunning_history" (resident_id, date_created);
+
+create view "dunning_history_list" as
+select
+  dh.id, dh.site_id, dh.resident_id, dh.policy_id, dh.stage, dh.stage_name, dh.days_overdue,
+  dh.balance, dh.email, dh.push, dh.actions, dh.date_created,
+  concat(r.first_name, ' ', r.last_name) as "resident"
+from dunning_history as dh
+left join "resident" as r on r.id = dh.resident_id
+;
@@ -0,0 +1,23 @@
+drop view if exists "gate_pass_list";
+drop table if exists "gate_pass_log";
+drop index if exists gate_pass_token_idx;
+
+alter table "gate_pass" drop column if exists "max_uses";
+alter table "gate_pass" drop column if exists "uses";
+alter table "gate_pass" drop column if exists "date_checkin";
+alter table "gate_pass" drop column if exists "date_checkout";
+alter table "gate_pass" drop column if exists "checkin_by";
+alter table "gate_pass" drop column if exists "checkout_by";
+
+create view "gate_pass_list" as
+select
+  g.id, g.site_id, g.resident_id, g.date_created, g.token, g.type, g.status, g.attr,
+  g.attr->>'visitor' as "visitor",
+  g.attr->>'plate_number' as "plate_number",
+  concat(r.first_name, ' ', r.last_name) as "resident",
+  r.type as resident_type,
+  r.residency_id
+from
+  gate_pass as g
+left join "resident" as r on r.id = g.resident_id
+;
@@ -0,0 +1,42 @@
+-- 0: unused, 1: checked in, 2: checked out, 3: used up, 4: expired
+alter table "gate_pass" add column "max_uses" int not null default 1;
+alter table "gate_pass" add column "uses" int not null default 0;
+alter table "gate_pass" add column "date_checkin" timestamp;
+alter table "gate_pass" add column "date_checkout" timestamp;
+alter table "gate_pass" add column "checkin_by" varchar(25);
+alter table "gate_pass" add column "checkout_by" varchar(25);
+
+create unique index gate_pass_token_idx on "gate_pass" (site_id, token);
+
+-- every scan at the gate, rejected scans keep the reason
+create table "gate_pass_log" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "gate_pass_id" varchar(25) references "gate_pass"("id") on delete cascade,
+  "token" varchar(25) not null default '',
+  "resident_id" varchar(25),
+  "security_id" varchar(25) not null,
+  "gate" varchar(100) not null default '',
+  -- 0: rejected, 1: check in, 2: check out
+  "action" smallint not null default 0,
+  "reason" text not null default '',
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index gate_pass_log_pass_idx on "gate_pass_log" (gate_pass_id, date_created);
+
+-- the columns are listed, g.* would clash with the plate_number column
+drop view if exists "gate_pass_list";
+create view "gate_pass_list" as
+select
+  g.id, g.site_id, g.resident_id, g.date_created, g.token, g.type, g.status, g.attr,
+  g.max_uses, g.uses, g.date_checkin, g.date_checkout, g.checkin_by, g.checkout_by,
+  g.attr->>'visitor' as "visitor",
+  coalesce(nullif(g.plate_number, ''), g.attr->>'plate_number') as "plate_number",
+  concat(r.first_name, ' ', r.last_name) as "resident",
+  r.type as resident_type,
+  r.residency_id
+from
+  gate_pass as g
+left join "resident" as r on r.id = g.resident_id
+;
@@ -0,0 +1,23 @@
+drop view if exists "gate_pass_list";
+
+alter table "gate_pass" alter column "max_uses" set default 1;
+
+alter table "gate_pass" drop column if exists "valid_from";
+alter table "gate_pass" drop column if exists "valid_until";
+alter table "gate_pass" drop column if exists "schedule";
+alter table "gate_pass" drop column if exists "date_revoked";
+alter table "gate_pass" drop column if exists "revoked_by";
+
+create view "gate_pass_list" as
+select
+  g.id, g.site_id, g.resident_id, g.date_created, g.token, g.type, g.status, g.attr,
+  g.max_uses, g.uses, g.date_checkin, g.date_checkout, g.checkin_by, g.checkout_by,
+  g.attr->>'visitor' as "visitor",
+  coalesce(nullif(g.plate_number, ''), g.attr->>'plate_number') as "plate_number",
+  concat(r.first_name, ' ', r.last_name) as "resident",
+  r.type as resident_type,
+  r.residency_id
+from
+  gate_pass as g
+left join "resident" as r on r.id = g.resident_id
+;
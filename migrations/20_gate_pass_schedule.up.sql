@@ -0,0 +1,28 @@
+-- a pass is valid from valid_from (or its creation) until valid_until (or the end of the
+-- day it was created). schedule limits it to days of the week and hours of the day:
+-- {"days": [1, 2, 3, 4, 5], "from": "08:00", "to": "17:00"}, days 0 is sunday
+alter table "gate_pass" add column "valid_from" timestamp;
+alter table "gate_pass" add column "valid_until" timestamp;
+alter table "gate_pass" add column "schedule" jsonb;
+alter table "gate_pass" add column "date_revoked" timestamp;
+alter table "gate_pass" add column "revoked_by" varchar(25);
+
+-- 0 uses means once for a day pass and no limit for a pass with a validity window
+alter table "gate_pass" alter column "max_uses" set default 0;
+
+-- 5: revoked
+drop view if exists "gate_pass_list";
+create view "gate_pass_list" as
+select
+  g.id, g.site_id, g.resident_id, g.date_created, g.token, g.type, g.status, g.attr,
+  g.max_uses, g.uses, g.date_checkin, g.date_checkout, g.checkin_by, g.checkout_by,
+  g.valid_from, g.valid_until, g.schedule, g.date_revoked, g.revoked_by,
+  g.attr->>'visitor' as "visitor",
+  coalesce(nullif(g.plate_number, ''), g.attr->>'plate_number') as "plate_number",
+  concat(r.first_name, ' ', r.last_name) as "resident",
+  r.type as resident_type,
+  r.residency_id
+from
+  gate_pass as g
+left join "resident" as r on r.id = g.resident_id
+;
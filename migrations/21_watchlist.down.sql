@@ -0,0 +1,2 @@
+drop table if exists "watchlist_hit";
+drop table if exists "watchlist";
@@ -0,0 +1,34 @@
+-- people and vehicles security must refuse or escort, plates and phones are stored
+-- normalised: plates upper case without spaces or dashes, phones digits only
+create table "watchlist" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "name" varchar(200) not null default '',
+  "phone" varchar(50) not null default '',
+  "plate_number" varchar(25) not null default '',
+  -- 1: deny entry, 2: escort
+  "action" smallint not null default 1,
+  "reason" text not null default '',
+  "active" boolean not null default true,
+  "date_expiry" timestamp,
+  "created_by" jsonb,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index watchlist_site_idx on "watchlist" (site_id, active);
+
+-- every time a visitor or gate pass matched the watchlist
+create table "watchlist_hit" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "watchlist_id" varchar(25) not null references "watchlist"("id") on delete cascade,
+  -- visitor, gate_pass or vehicle_log
+  "source" varchar(20) not null,
+  "source_id" varchar(25) not null default '',
+  "matched_on" varchar(20) not null,
+  "value" varchar(200) not null default '',
+  "user_id" varchar(25) not null default '',
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index watchlist_hit_site_idx on "watchlist_hit" (site_id, date_created);
@@ -0,0 +1,3 @@
+drop view if exists "vehicle_list";
+drop table if exists "vehicle_log";
+drop table if exists "vehicle";
@@ -0,0 +1,52 @@
+-- vehicles registered by a residency, plates are stored upper case without spaces or dashes
+create table "vehicle" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "residency_id" varchar(25) not null references "residency"("id"),
+  "resident_id" varchar(25),
+  "plate_number" varchar(25) not null,
+  "make" varchar(100) not null default '',
+  "colour" varchar(50) not null default '',
+  "sticker_number" varchar(50) not null default '',
+  "active" boolean not null default true,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create unique index vehicle_plate_idx on "vehicle" (site_id, plate_number) where active;
+create unique index vehicle_sticker_idx on "vehicle" (site_id, sticker_number) where active and sticker_number <> '';
+
+-- every vehicle entry and exit at the gate
+create table "vehicle_log" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "plate_number" varchar(25) not null,
+  -- resident, visitor or unknown
+  "owner" varchar(20) not null,
+  "vehicle_id" varchar(25),
+  "gate_pass_id" varchar(25),
+  -- 1: in, 2: out
+  "direction" smallint not null,
+  "gate" varchar(100) not null default '',
+  "security_id" varchar(25) not null,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index vehicle_log_plate_idx on "vehicle_log" (site_id, plate_number, date_created);
+
+create view "vehicle_list" as
+select
+  v.*,
+  u.label as unit,
+  st.name as street,
+  concat(r.first_name, ' ', r.last_name) as resident
+from
+  vehicle as v
+left join residency as rs
+  on rs.id = v.residency_id
+left join unit as u
+  on u.id = rs.unit_id
+left join street as st
+  on st.id = u.street_id
+left join resident as r
+  on r.id = v.resident_id
+;
@@ -0,0 +1,24 @@
+drop view if exists "visitor_list";
+drop index if exists visitor_expected_idx;
+
+alter table "visitor" drop column if exists "expected_from";
+alter table "visitor" drop column if exists "expected_until";
+alter table "visitor" drop column if exists "date_checkin";
+alter table "visitor" drop column if exists "date_checkout";
+alter table "visitor" drop column if exists "checkout_by";
+alter table "visitor" drop column if exists "date_denied";
+
+create view "visitor_list" as
+select
+  v.*,
+  concat(u.first_name, ' ', u.last_name) as "security",
+  concat(r.first_name, ' ', r.last_name) as "resident"
+from
+  "visitor" as v
+left join "user" as u
+  on u.id = v.security_id and u.site_id = v.site_id
+left join "residency" as rs
+  on rs.unit_id = v.unit_id and rs.site_id = v.site_id
+left join "resident" as r
+  on r.id = v.resident_id
+;
@@ -0,0 +1,26 @@
+-- residents pre-register visitors for a window, security stamps the actual arrival and
+-- departure. status 0: expected, 1: in, 2: out, 3: denied by the resident
+alter table "visitor" add column "expected_from" timestamp;
+alter table "visitor" add column "expected_until" timestamp;
+alter table "visitor" add column "date_checkin" timestamp;
+alter table "visitor" add column "date_checkout" timestamp;
+alter table "visitor" add column "checkout_by" varchar(25);
+alter table "visitor" add column "date_denied" timestamp;
+
+create index visitor_expected_idx on "visitor" (site_id, status, expected_from);
+
+-- v.* is expanded when the view is created. The unused residency join is dropped, it
+-- repeated the visitors of units with past residencies
+drop view if exists "visitor_list";
+create view "visitor_list" as
+select
+  v.*,
+  concat(u.first_name, ' ', u.last_name) as "security",
+  concat(r.first_name, ' ', r.last_name) as "resident"
+from
+  "visitor" as v
+left join "user" as u
+  on u.id = v.security_id and u.site_id = v.site_id
+left join "resident" as r
+  on r.id = v.resident_id
+;
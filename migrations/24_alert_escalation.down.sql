@@ -0,0 +1,13 @@
+drop table if exists "alert_escalation";
+drop table if exists "alert_escalation_policy";
+drop index if exists resident_alerts_status_idx;
+
+alter table "resident_alerts" drop column if exists "responded_by";
+alter table "resident_alerts" drop column if exists "time_resolved";
+alter table "resident_alerts" drop column if exists "resolved_by";
+alter table "resident_alerts" drop column if exists "escalation_level";
+alter table "resident_alerts" drop column if exists "time_escalated";
+
+update "resident_alerts" set time_responded = time_logged where time_responded is null;
+alter table "resident_alerts" alter column "time_responded" set default localtimestamp;
+alter table "resident_alerts" alter column "time_responded" set not null;
@@ -0,0 +1,37 @@
+-- time_responded defaulted to the insert time, it is now set when security acknowledges
+alter table "resident_alerts" alter column "time_responded" drop not null;
+alter table "resident_alerts" alter column "time_responded" drop default;
+update "resident_alerts" set time_responded = null where time_responded = time_logged;
+
+alter table "resident_alerts" add column "responded_by" varchar(25);
+alter table "resident_alerts" add column "time_resolved" timestamp;
+alter table "resident_alerts" add column "resolved_by" varchar(25);
+-- the last escalation tier reached, 0 when the alert was not escalated
+alter table "resident_alerts" add column "escalation_level" smallint not null default 0;
+alter table "resident_alerts" add column "time_escalated" timestamp;
+
+create index resident_alerts_status_idx on "resident_alerts" (site_id, status, time_logged);
+
+-- how unacknowledged alerts of a site escalate, tiers is an array of
+-- {after_seconds, target, push, email}, target is security or officials
+create table "alert_escalation_policy" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "active" boolean not null default true,
+  "tiers" jsonb not null default '[]',
+  "date_created" timestamp not null default localtimestamp
+);
+
+create unique index alert_escalation_policy_site_idx on "alert_escalation_policy" (site_id);
+
+create table "alert_escalation" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "alert_id" varchar(25) not null references "resident_alerts"("id") on delete cascade,
+  "level" smallint not null,
+  "target" varchar(20) not null,
+  "notified" int not null default 0,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index alert_escalation_alert_idx on "alert_escalation" (alert_id);
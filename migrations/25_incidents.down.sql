@@ -0,0 +1,8 @@
+drop table if exists "incident";
+drop index if exists resident_alerts_category_idx;
+
+alter table "resident_alerts" drop column if exists "category";
+alter table "resident_alerts" drop column if exists "note";
+alter table "resident_alerts" drop column if exists "photos";
+alter table "resident_alerts" drop column if exists "unit_id";
+alter table "resident_alerts" drop column if exists "street_id";
@@ -0,0 +1,44 @@
+-- medical, fire, intrusion or noise, alerts raised before categories are panic alerts
+alter table "resident_alerts" add column "category" varchar(20) not null default 'panic';
+alter table "resident_alerts" add column "note" text not null default '';
+-- [{photo: {data: url, name, size}}]
+alter table "resident_alerts" add column "photos" jsonb not null default '[]';
+alter table "resident_alerts" add column "unit_id" varchar(25);
+alter table "resident_alerts" add column "street_id" varchar(25);
+
+update "resident_alerts" as a set unit_id = u.id, street_id = u.street_id
+from "resident" as r
+join "residency" as rs
+  on rs.id = r.residency_id
+join "unit" as u
+  on u.id = rs.unit_id
+where r.id = a.resident_id;
+
+create index resident_alerts_category_idx on "resident_alerts" (site_id, category, time_logged);
+
+-- the report filed by the guard who responded to an alert, or about anything seen on patrol
+create table "incident" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "alert_id" varchar(25) references "resident_alerts"("id"),
+  "category" varchar(20) not null,
+  "title" varchar(200) not null,
+  "description" text not null default '',
+  "location" varchar(250) not null default '',
+  "unit_id" varchar(25),
+  "street_id" varchar(25),
+  "date_occurred" timestamp not null default localtimestamp,
+  -- [{attachment: {data: url, name, size}}]
+  "attachments" jsonb not null default '[]',
+  -- 0: draft, 1: submitted, 2: signed off, 3: returned to the guard
+  "status" int not null default 0,
+  "reported_by" jsonb not null default '{}',
+  "date_submitted" timestamp,
+  "reviewed_by" jsonb not null default '{}',
+  "review_note" text not null default '',
+  "date_reviewed" timestamp,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index incident_site_idx on "incident" (site_id, date_occurred);
+create unique index incident_alert_idx on "incident" (alert_id) where alert_id is not null;
@@ -0,0 +1,5 @@
+drop table if exists "patrol_scan";
+drop table if exists "patrol_checkpoint";
+drop table if exists "guard_shift";
+
+alter table "alert_escalation_policy" drop column if exists "on_shift_only";
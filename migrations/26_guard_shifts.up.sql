@@ -0,0 +1,48 @@
+-- alerts and their escalations only reach the guards on shift, every guard when nobody is
+alter table "alert_escalation_policy" add column "on_shift_only" boolean not null default false;
+
+create table "guard_shift" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "guard_id" varchar(25) not null references "user"("id"),
+  "name" varchar(100) not null default '',
+  "date_start" timestamp not null,
+  "date_end" timestamp not null,
+  -- 0: scheduled, 1: on duty, 2: completed, 3: cancelled
+  "status" int not null default 0,
+  "clock_in" timestamp,
+  "clock_out" timestamp,
+  "note" text not null default '',
+  "created_by" jsonb not null default '{}',
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index guard_shift_site_idx on "guard_shift" (site_id, date_start);
+create index guard_shift_guard_idx on "guard_shift" (guard_id, date_start);
+
+-- code is printed on the checkpoint (qr code or nfc tag) and scanned by the guard app
+create table "patrol_checkpoint" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "name" varchar(100) not null,
+  "code" varchar(50) not null,
+  "location" varchar(250) not null default '',
+  "street_id" varchar(25) references "street"("id"),
+  "active" boolean not null default true,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create unique index patrol_checkpoint_code_idx on "patrol_checkpoint" (site_id, code);
+
+create table "patrol_scan" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "checkpoint_id" varchar(25) not null references "patrol_checkpoint"("id"),
+  "shift_id" varchar(25) not null references "guard_shift"("id"),
+  "guard_id" varchar(25) not null,
+  "note" text not null default '',
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index patrol_scan_site_idx on "patrol_scan" (site_id, date_created);
+create index patrol_scan_shift_idx on "patrol_scan" (shift_id);
@@ -0,0 +1 @@
+drop table if exists "payment_plan_payment";
@@ -0,0 +1,14 @@
+-- the part of each payment applied to an installment, released when the payment is
+-- edited or reversed
+create table "payment_plan_payment" (
+  "id" varchar(25) primary key,
+  "site_id" varchar(25) not null references "site"("id"),
+  "plan_id" varchar(25) not null references "payment_plan"("id") on delete cascade,
+  "installment_id" varchar(25) not null references "payment_plan_installment"("id") on delete cascade,
+  "payment_id" varchar(25) not null references "payment"("id"),
+  "amount" numeric(15,2) not null,
+  "date_created" timestamp not null default localtimestamp
+);
+
+create index payment_plan_payment_payment_idx on "payment_plan_payment" (payment_id);
+create index payment_plan_payment_installment_idx on "payment_plan_payment" (installment_id);
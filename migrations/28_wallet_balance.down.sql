@@ -0,0 +1,7 @@
+drop view if exists "wallet_list";
+
+alter table "wallet" add column "balance" numeric(15,2) not null default 0;
+
+update "wallet" as w set balance = (
+  select coalesce(sum(m.amount), 0) from wallet_movement as m where m.wallet_id = w.id
+);
@@ -0,0 +1,31 @@
+-- the wallet balance is the sum of its movements, movements are never removed. Wallets
+-- opened with a balance and no movements get an opening movement
+insert into "wallet_movement" (id, site_id, wallet_id, resident_id, type, amount, narration)
+  select
+    'm' || substr(md5(w.id), 1, 19), w.site_id, w.id, w.resident_id, 1,
+    w.balance - coalesce(m.amount, 0), 'Opening balance'
+  from
+    wallet as w
+  left join (
+    select wallet_id, sum(amount) as amount from wallet_movement group by wallet_id
+  ) as m
+    on m.wallet_id = w.id
+  where
+    w.balance <> coalesce(m.amount, 0);
+
+alter table "wallet" drop column "balance";
+
+create view "wallet_list" as
+select
+  w.id,
+  w.site_id,
+  w.resident_id,
+  concat(r.first_name, ' ', r.last_name) as "resident",
+  coalesce((select sum(m.amount) from wallet_movement as m where m.wallet_id = w.id), 0) as balance,
+  w.auto_apply,
+  w.date_created
+from
+  wallet as w
+left join resident as r
+  on r.id = w.resident_id
+;
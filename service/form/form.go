@@ -30,6 +30,7 @@ type PaymentForm struct {
 	Dues       json.RawMessage `json:"dues"`
 	Provider   model.PayEntity `json:"provider"`
 	PayMode    int             `json:"pay_mode"`
+	Allocation int             `json:"allocation"`
 	Attr       json.RawMessage `json:"attr"`
 }
 
@@ -88,8 +89,11 @@ type SupportAccountForm struct {
 }
 
 type ResidentAlertForm struct {
-	Status int             `json:"status"`
-	Attr   json.RawMessage `json:"attr"`
+	Status   int             `json:"status"`
+	Attr     json.RawMessage `json:"attr"`
+	Category string          `json:"category"`
+	Note     string          `json:"note"`
+	Photos   json.RawMessage `json:"photos"`
 }
 
 type UpdatePushNotification struct {
@@ -0,0 +1,177 @@
+//go:build fake
+// +build fake
+
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"eve/service/model"
+
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+// Fake is an in memory provider for tests and local development, it is only built with
+// the fake tag. Payments are completed with CompleteFake, webhooks are signed with SignFake
+type Fake struct {
+	keys Keys
+}
+
+var fakeStore = struct {
+	sync.Mutex
+	charges map[string]*Charge
+	refunds map[string]decimal.Decimal
+	keys    map[string]*Refund
+}{
+	charges: map[string]*Charge{},
+	refunds: map[string]decimal.Decimal{},
+	keys:    map[string]*Refund{},
+}
+
+func init() {
+	Register(model.ProviderFake, func(keys Keys) PaymentProvider { return NewFake(keys) })
+}
+
+// NewFake ...
+func NewFake(keys Keys) *Fake {
+	return &Fake{keys: keys}
+}
+
+// CompleteFake marks an initialized fake payment as paid
+func CompleteFake(ref string) (*Charge, error) {
+	fakeStore.Lock()
+	defer fakeStore.Unlock()
+
+	charge, found := fakeStore.charges[ref]
+	if !found {
+		return nil, fmt.Errorf("unknown fake payment %s", ref)
+	}
+	charge.Success = true
+	charge.Date = time.Now()
+
+	return charge, nil
+}
+
+// SignFake returns the x-fake-signature of a webhook body
+func SignFake(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ID ...
+func (s *Fake) ID() model.PayProvider { return model.ProviderFake }
+
+// Name ...
+func (s *Fake) Name() string { return "fake" }
+
+// Initialize ...
+func (s *Fake) Initialize(req InitRequest) (*InitResponse, error) {
+	ref := req.Reference
+	if len(ref) == 0 {
+		ref = "fake_" + xid.New().String()
+	}
+
+	meta := map[string]json.RawMessage{}
+	for k, v := range req.Metadata {
+		meta[k], _ = json.Marshal(v)
+	}
+
+	fakeStore.Lock()
+	fakeStore.charges[ref] = &Charge{Reference: ref, Amount: req.Amount, Email: req.Email, Meta: meta}
+	fakeStore.Unlock()
+
+	return &InitResponse{AuthorizationURL: "fake://pay/" + ref, AccessCode: ref, Reference: ref}, nil
+}
+
+// Verify ...
+func (s *Fake) Verify(ref string) (*Charge, error) {
+	fakeStore.Lock()
+	defer fakeStore.Unlock()
+
+	charge, found := fakeStore.charges[ref]
+	if !found {
+		return nil, fmt.Errorf("fake: unknown payment %s", ref)
+	}
+
+	c := *charge
+	return &c, nil
+}
+
+// Refund a key that was already refunded returns the first refund
+func (s *Fake) Refund(ref string, amount decimal.Decimal, key string) (*Refund, error) {
+	fakeStore.Lock()
+	defer fakeStore.Unlock()
+
+	if refund, found := fakeStore.keys[key]; found && len(key) > 0 {
+		r := *refund
+		return &r, nil
+	}
+
+	charge, found := fakeStore.charges[ref]
+	if !found || !charge.Success {
+		return nil, fmt.Errorf("fake: payment %s cannot be refunded", ref)
+	}
+
+	if amount.Sign() <= 0 {
+		amount = charge.Amount
+	}
+	refunded := fakeStore.refunds[ref].Add(amount)
+	if refunded.GreaterThan(charge.Amount) {
+		return nil, errors.New("fake: refund exceeds payment")
+	}
+	fakeStore.refunds[ref] = refunded
+
+	refund := &Refund{Reference: ref, Status: "processed", Amount: amount}
+	fakeStore.keys[key] = refund
+
+	r := *refund
+	return &r, nil
+}
+
+// ParseWebhook body is {"event": "charge.success", "data": {"reference", "amount", "email", "meta"}}
+func (s *Fake) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	if len(s.keys.Secret) == 0 {
+		return nil, errors.New("fake webhook secret is not configured")
+	}
+	if !hmac.Equal([]byte(SignFake(s.keys.Secret, body)), []byte(header.Get("x-fake-signature"))) {
+		return nil, errors.New("fake signature mismatch")
+	}
+
+	in := struct {
+		Event string `json:"event"`
+		Data  struct {
+			Reference string                     `json:"reference"`
+			Amount    decimal.Decimal            `json:"amount"`
+			Email     string                     `json:"email"`
+			Meta      map[string]json.RawMessage `json:"meta"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, errors.New("invalid fake event")
+	}
+
+	event := &Event{Name: in.Event}
+	if in.Event == "charge.success" {
+		event.Charge = &Charge{
+			Reference: in.Data.Reference,
+			Success:   true,
+			Amount:    in.Data.Amount,
+			Date:      time.Now(),
+			Email:     in.Data.Email,
+			Meta:      in.Data.Meta,
+			Raw:       body,
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,72 @@
+//go:build fake
+// +build fake
+
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFakeParseWebhook(t *testing.T) {
+	body := []byte(`{"event":"charge.success","data":{"reference":"f-1","amount":"100","email":"a@b.c"}}`)
+
+	tests := []struct {
+		name   string
+		secret string
+		sig    string
+		ok     bool
+	}{
+		{"valid signature", "whsec", SignFake("whsec", body), true},
+		{"wrong signature", "whsec", SignFake("other", body), false},
+		{"missing signature", "whsec", "", false},
+		{"empty secret", "", SignFake("", body), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("x-fake-signature", tt.sig)
+
+			event, err := NewFake(Keys{Secret: tt.secret}).ParseWebhook(header, body)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseWebhook() error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && (event.Charge == nil || event.Charge.Reference != "f-1") {
+				t.Errorf("event = %+v", event)
+			}
+		})
+	}
+}
+
+func TestFakeRefundKey(t *testing.T) {
+	fake := NewFake(Keys{Secret: "sk"})
+	init, err := fake.Initialize(InitRequest{Email: "a@b.c", Amount: decimal.New(100, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompleteFake(init.Reference); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		ok   bool
+	}{
+		{"first refund", "rv-1", true},
+		{"same key is not refunded twice", "rv-1", true},
+		{"another key exceeds the payment", "rv-2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fake.Refund(init.Reference, decimal.New(100, 0), tt.key)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Refund() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
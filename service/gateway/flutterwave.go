@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"eve/service/model"
+
+	"github.com/shopspring/decimal"
+)
+
+const flutterwaveURL = "https://api.flutterwave.com/v3"
+
+// Flutterwave payments are identified by the flutterwave transaction id, webhooks carry
+// the secret hash set on the flutterwave dashboard
+type Flutterwave struct {
+	keys Keys
+}
+
+type flutterwaveCharge struct {
+	ID        json.Number     `json:"id"`
+	TxRef     string          `json:"tx_ref"`
+	Status    string          `json:"status"`
+	Amount    decimal.Decimal `json:"amount"`
+	CreatedAt time.Time       `json:"created_at"`
+	Customer  struct {
+		Email string `json:"email"`
+	} `json:"customer"`
+	Meta json.RawMessage `json:"meta"`
+}
+
+// ID ...
+func (s *Flutterwave) ID() model.PayProvider { return model.ProviderFlutterwave }
+
+// Name ...
+func (s *Flutterwave) Name() string { return "flutterwave" }
+
+func (s *Flutterwave) header() map[string]string {
+	return map[string]string{"Authorization": fmt.Sprintf("Bearer %s", s.keys.Secret)}
+}
+
+// Initialize creates a hosted payment link, flutterwave meta values are strings
+func (s *Flutterwave) Initialize(req InitRequest) (*InitResponse, error) {
+	meta := map[string]string{}
+	for k, v := range req.Metadata {
+		if str, ok := v.(string); ok {
+			meta[k] = str
+		} else if b, err := json.Marshal(v); err == nil {
+			meta[k] = string(b)
+		}
+	}
+
+	in := map[string]interface{}{
+		"tx_ref":       req.Reference,
+		"amount":       req.Amount.StringFixed(2),
+		"currency":     "NGN",
+		"redirect_url": req.CallbackURL,
+		"customer":     map[string]string{"email": req.Email, "name": req.Name, "phonenumber": req.Phone},
+		"meta":         meta,
+	}
+
+	out := struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Data    struct {
+			Link string `json:"link"`
+		} `json:"data"`
+	}{}
+	if err := call(http.MethodPost, flutterwaveURL+"/payments", s.header(), in, &out); err != nil {
+		return nil, err
+	}
+	if out.Status != "success" {
+		return nil, fmt.Errorf("flutterwave: %s", out.Message)
+	}
+
+	return &InitResponse{AuthorizationURL: out.Data.Link, Reference: req.Reference}, nil
+}
+
+// Verify ref is the flutterwave transaction id
+func (s *Flutterwave) Verify(ref string) (*Charge, error) {
+	out := struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}{}
+	err := call(http.MethodGet, fmt.Sprintf("%s/transactions/%s/verify", flutterwaveURL, url.PathEscape(ref)), s.header(), nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out.Status != "success" {
+		return nil, fmt.Errorf("flutterwave: %s", out.Message)
+	}
+
+	return s.charge(out.Data, nil)
+}
+
+func (s *Flutterwave) charge(data, meta json.RawMessage) (*Charge, error) {
+	ch := flutterwaveCharge{}
+	if err := json.Unmarshal(data, &ch); err != nil {
+		return nil, errors.New("invalid flutterwave transaction")
+	}
+
+	charge := &Charge{
+		Reference: ch.ID.String(),
+		Success:   ch.Status == "successful",
+		Amount:    ch.Amount,
+		Date:      ch.CreatedAt,
+		Email:     ch.Customer.Email,
+		Meta:      map[string]json.RawMessage{},
+		Raw:       data,
+	}
+	// webhooks send the meta next to the data
+	if json.Unmarshal(ch.Meta, &charge.Meta) != nil || len(charge.Meta) == 0 {
+		json.Unmarshal(meta, &charge.Meta)
+	}
+
+	return charge, nil
+}
+
+// Refund ref is the flutterwave transaction id
+func (s *Flutterwave) Refund(ref string, amount decimal.Decimal, key string) (*Refund, error) {
+	in := map[string]interface{}{}
+	if amount.Sign() > 0 {
+		in["amount"] = amount.StringFixed(2)
+	}
+
+	out := struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Data    struct {
+			Status       string          `json:"status"`
+			AmountRefund decimal.Decimal `json:"amount_refunded"`
+		} `json:"data"`
+	}{}
+	header := s.header()
+	header["Idempotency-Key"] = key
+	err := call(http.MethodPost, fmt.Sprintf("%s/transactions/%s/refund", flutterwaveURL, url.PathEscape(ref)), header, in, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out.Status != "success" {
+		return nil, fmt.Errorf("flutterwave: %s", out.Message)
+	}
+
+	return &Refund{Reference: ref, Status: out.Data.Status, Amount: out.Data.AmountRefund}, nil
+}
+
+// ParseWebhook checks the flutterwave-signature header (HMAC-SHA256 of the body) or,
+// for older integrations, the verif-hash header
+func (s *Flutterwave) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	if len(s.keys.WebhookHash) == 0 {
+		return nil, errors.New("flutterwave webhook hash is not configured")
+	}
+
+	if sig := header.Get("flutterwave-signature"); len(sig) > 0 {
+		mac := hmac.New(sha256.New, []byte(s.keys.WebhookHash))
+		mac.Write(body)
+		expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(sig)) {
+			return nil, errors.New("flutterwave signature mismatch")
+		}
+	} else if subtle.ConstantTimeCompare([]byte(s.keys.WebhookHash), []byte(header.Get("verif-hash"))) != 1 {
+		return nil, errors.New("flutterwave hash mismatch")
+	}
+
+	in := struct {
+		Event    string          `json:"event"`
+		Data     json.RawMessage `json:"data"`
+		MetaData json.RawMessage `json:"meta_data"`
+	}{}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, errors.New("invalid flutterwave event")
+	}
+
+	event := &Event{Name: in.Event}
+	if in.Event == "charge.completed" {
+		charge, err := s.charge(in.Data, in.MetaData)
+		if err != nil {
+			return nil, err
+		}
+		event.Charge = charge
+	}
+
+	return event, nil
+}
@@ -0,0 +1,177 @@
+// Package gateway puts the online payment providers (paystack, flutterwave, remita)
+// behind a single interface
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"eve/service/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrNotSupported is returned for operations a provider does not offer
+var ErrNotSupported = errors.New("operation not supported by the payment provider")
+
+// Keys are the credentials of a provider, a site uses its own keys or the platform keys
+type Keys struct {
+	Public        string
+	Secret        string
+	Encryption    string
+	WebhookHash   string
+	MerchantID    string
+	ServiceTypeID string
+	Live          bool
+}
+
+// InitRequest starts a payment, Amount is in naira
+type InitRequest struct {
+	Reference   string
+	Email       string
+	Name        string
+	Phone       string
+	Amount      decimal.Decimal
+	Description string
+	CallbackURL string
+	Metadata    map[string]interface{}
+}
+
+// InitResponse tells the client where to complete the payment
+type InitResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	AccessCode       string `json:"access_code"`
+	Reference        string `json:"reference"`
+}
+
+// Charge is the state of a payment at the provider
+type Charge struct {
+	// Reference identifies the payment, it is what is stored as the payment provider_ref
+	Reference string
+	Success   bool
+	Amount    decimal.Decimal
+	Date      time.Time
+	Email     string
+	Meta      map[string]json.RawMessage
+	Raw       json.RawMessage
+}
+
+// Event is a webhook notification, Charge is nil for events that are not payments
+type Event struct {
+	Name   string
+	Charge *Charge
+}
+
+// Refund ...
+type Refund struct {
+	Reference string
+	Status    string
+	Amount    decimal.Decimal
+}
+
+// PaymentProvider is implemented by each online payment provider
+type PaymentProvider interface {
+	ID() model.PayProvider
+	Name() string
+	Initialize(req InitRequest) (*InitResponse, error)
+	Verify(ref string) (*Charge, error)
+	// Refund key identifies the refund, it is sent as the idempotency key of the request
+	// so a repeated refund is not paid twice
+	Refund(ref string, amount decimal.Decimal, key string) (*Refund, error)
+	// ParseWebhook checks the signature of a notification and decodes it
+	ParseWebhook(header http.Header, body []byte) (*Event, error)
+}
+
+// Factory creates a provider with the given keys
+type Factory func(keys Keys) PaymentProvider
+
+var (
+	mtx       sync.RWMutex
+	factories = map[model.PayProvider]Factory{}
+)
+
+func init() {
+	Register(model.ProviderPaystack, func(keys Keys) PaymentProvider { return &Paystack{keys: keys} })
+	Register(model.ProviderFlutterwave, func(keys Keys) PaymentProvider { return &Flutterwave{keys: keys} })
+	Register(model.ProviderRemita, func(keys Keys) PaymentProvider { return &Remita{keys: keys} })
+}
+
+// Register adds or replaces a provider, tests register fakes under real provider ids
+func Register(id model.PayProvider, f Factory) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	factories[id] = f
+}
+
+// New returns the provider for id
+func New(id model.PayProvider, keys Keys) (PaymentProvider, error) {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	f, found := factories[id]
+	if !found {
+		return nil, fmt.Errorf("unknown payment provider %d", id)
+	}
+
+	return f(keys), nil
+}
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// call sends a json request and decodes the json response into out
+func call(method, url string, header map[string]string, in, out interface{}) error {
+	data, status, err := send(method, url, header, in)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response from provider (%d)", status)
+	}
+
+	return nil
+}
+
+// send sends a json request and returns the response body
+func send(method, url string, header map[string]string, in interface{}) ([]byte, int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, resp.StatusCode, err
+}
+
+func toKobo(amount decimal.Decimal) int64 {
+	return amount.Mul(decimal.New(100, 0)).Round(0).IntPart()
+}
+
+func fromKobo(amount decimal.Decimal) decimal.Decimal {
+	return amount.Div(decimal.New(100, 0))
+}
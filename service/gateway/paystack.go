@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"eve/service/model"
+
+	"github.com/shopspring/decimal"
+)
+
+const paystackURL = "https://api.paystack.co"
+
+// Paystack amounts are in kobo, webhooks are signed with the secret key
+type Paystack struct {
+	keys Keys
+}
+
+type paystackCharge struct {
+	ID        int64           `json:"id"`
+	Reference string          `json:"reference"`
+	Status    string          `json:"status"`
+	Amount    decimal.Decimal `json:"amount"`
+	PaidAt    time.Time       `json:"paid_at"`
+	Customer  struct {
+		Email string `json:"email"`
+	} `json:"customer"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// ID ...
+func (s *Paystack) ID() model.PayProvider { return model.ProviderPaystack }
+
+// Name ...
+func (s *Paystack) Name() string { return "paystack" }
+
+func (s *Paystack) header() map[string]string {
+	return map[string]string{"Authorization": fmt.Sprintf("Bearer %s", s.keys.Secret)}
+}
+
+// Initialize ...
+func (s *Paystack) Initialize(req InitRequest) (*InitResponse, error) {
+	in := map[string]interface{}{
+		"email":  req.Email,
+		"amount": fmt.Sprintf("%d", toKobo(req.Amount)),
+	}
+	if len(req.Reference) > 0 {
+		in["reference"] = req.Reference
+	}
+	if len(req.CallbackURL) > 0 {
+		in["callback_url"] = req.CallbackURL
+	}
+	if len(req.Metadata) > 0 {
+		in["metadata"] = req.Metadata
+	}
+
+	out := struct {
+		Status  bool         `json:"status"`
+		Message string       `json:"message"`
+		Data    InitResponse `json:"data"`
+	}{}
+	if err := call(http.MethodPost, paystackURL+"/transaction/initialize", s.header(), in, &out); err != nil {
+		return nil, err
+	}
+	if !out.Status {
+		return nil, fmt.Errorf("paystack: %s", out.Message)
+	}
+
+	return &out.Data, nil
+}
+
+// Verify ...
+func (s *Paystack) Verify(ref string) (*Charge, error) {
+	out := struct {
+		Status  bool            `json:"status"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}{}
+	err := call(http.MethodGet, paystackURL+"/transaction/verify/"+url.PathEscape(ref), s.header(), nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	if !out.Status {
+		return nil, fmt.Errorf("paystack: %s", out.Message)
+	}
+
+	return s.charge(out.Data)
+}
+
+func (s *Paystack) charge(data json.RawMessage) (*Charge, error) {
+	ch := paystackCharge{}
+	if err := json.Unmarshal(data, &ch); err != nil {
+		return nil, errors.New("invalid paystack transaction")
+	}
+
+	charge := &Charge{
+		Reference: ch.Reference,
+		Success:   ch.Status == "success",
+		Amount:    fromKobo(ch.Amount),
+		Date:      ch.PaidAt,
+		Email:     ch.Customer.Email,
+		Meta:      map[string]json.RawMessage{},
+		Raw:       data,
+	}
+	json.Unmarshal(ch.Metadata, &charge.Meta)
+
+	return charge, nil
+}
+
+// Refund ...
+func (s *Paystack) Refund(ref string, amount decimal.Decimal, key string) (*Refund, error) {
+	in := map[string]interface{}{"transaction": ref}
+	if amount.Sign() > 0 {
+		in["amount"] = toKobo(amount)
+	}
+
+	out := struct {
+		Status  bool   `json:"status"`
+		Message string `json:"message"`
+		Data    struct {
+			Status string          `json:"status"`
+			Amount decimal.Decimal `json:"amount"`
+		} `json:"data"`
+	}{}
+	header := s.header()
+	header["Idempotency-Key"] = key
+	if err := call(http.MethodPost, paystackURL+"/refund", header, in, &out); err != nil {
+		return nil, err
+	}
+	if !out.Status {
+		return nil, fmt.Errorf("paystack: %s", out.Message)
+	}
+
+	return &Refund{Reference: ref, Status: out.Data.Status, Amount: fromKobo(out.Data.Amount)}, nil
+}
+
+// ParseWebhook checks the x-paystack-signature header, a HMAC-SHA512 of the body
+func (s *Paystack) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	mac := hmac.New(sha512.New, []byte(s.keys.Secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if len(s.keys.Secret) == 0 || !hmac.Equal([]byte(expected), []byte(strings.ToLower(header.Get("x-paystack-signature")))) {
+		return nil, errors.New("paystack signature mismatch")
+	}
+
+	in := struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, errors.New("invalid paystack event")
+	}
+
+	event := &Event{Name: in.Event}
+	if in.Event == "charge.success" {
+		charge, err := s.charge(in.Data)
+		if err != nil {
+			return nil, err
+		}
+		event.Charge = charge
+	}
+
+	return event, nil
+}
@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"eve/service/model"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	remitaDemoURL = "https://remitademo.net"
+	remitaLiveURL = "https://login.remita.net"
+)
+
+// Remita payments are identified by the remita retrieval reference (RRR). The secret is
+// the remita api key, MerchantID and ServiceTypeID identify the biller
+type Remita struct {
+	keys Keys
+}
+
+type remitaStatus struct {
+	Amount      decimal.Decimal `json:"amount"`
+	RRR         string          `json:"RRR"`
+	OrderID     string          `json:"orderId"`
+	Message     string          `json:"message"`
+	PaymentDate string          `json:"paymentDate"`
+	Status      string          `json:"status"`
+}
+
+// ID ...
+func (s *Remita) ID() model.PayProvider { return model.ProviderRemita }
+
+// Name ...
+func (s *Remita) Name() string { return "remita" }
+
+func (s *Remita) url() string {
+	if s.keys.Live {
+		return remitaLiveURL
+	}
+	return remitaDemoURL
+}
+
+func (s *Remita) header(hash string) map[string]string {
+	return map[string]string{
+		"Authorization": fmt.Sprintf("remitaConsumerKey=%s,remitaConsumerToken=%s", s.keys.MerchantID, hash),
+	}
+}
+
+func remitaHash(parts ...string) string {
+	h := sha512.Sum512([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(h[:])
+}
+
+// remitaJSON strips the jsonp wrapper remita puts around some responses
+func remitaJSON(data []byte) []byte {
+	data = bytes.TrimSpace(data)
+	if i := bytes.IndexByte(data, '('); i >= 0 && bytes.HasPrefix(data, []byte("jsonp")) {
+		data = bytes.TrimSuffix(bytes.TrimSpace(data[i+1:]), []byte(")"))
+	}
+	return data
+}
+
+// Initialize generates an RRR for the order
+func (s *Remita) Initialize(req InitRequest) (*InitResponse, error) {
+	amount := req.Amount.StringFixed(2)
+	in := map[string]string{
+		"serviceTypeId": s.keys.ServiceTypeID,
+		"amount":        amount,
+		"orderId":       req.Reference,
+		"payerName":     req.Name,
+		"payerEmail":    req.Email,
+		"payerPhone":    req.Phone,
+		"description":   req.Description,
+	}
+
+	hash := remitaHash(s.keys.MerchantID, s.keys.ServiceTypeID, req.Reference, amount, s.keys.Secret)
+	data, status, err := send(http.MethodPost,
+		s.url()+"/remita/exapp/api/v1/send/api/echannelsvc/merchant/api/paymentinit", s.header(hash), in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := struct {
+		StatusCode string `json:"statuscode"`
+		RRR        string `json:"RRR"`
+		Status     string `json:"status"`
+	}{}
+	if err := json.Unmarshal(remitaJSON(data), &out); err != nil {
+		return nil, fmt.Errorf("invalid response from provider (%d)", status)
+	}
+	if out.StatusCode != "025" || len(out.RRR) == 0 {
+		return nil, fmt.Errorf("remita: %s", out.Status)
+	}
+
+	return &InitResponse{
+		AuthorizationURL: fmt.Sprintf("%s/remita/onepage/biller/%s/payment.spa", s.url(), out.RRR),
+		AccessCode:       out.RRR,
+		Reference:        out.RRR,
+	}, nil
+}
+
+// Verify ref is the RRR
+func (s *Remita) Verify(ref string) (*Charge, error) {
+	hash := remitaHash(ref, s.keys.Secret, s.keys.MerchantID)
+	url := fmt.Sprintf("%s/remita/exapp/api/v1/send/api/echannelsvc/%s/%s/%s/status.reg", s.url(), s.keys.MerchantID, ref, hash)
+
+	data, status, err := send(http.MethodGet, url, s.header(hash), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := remitaStatus{}
+	if err := json.Unmarshal(remitaJSON(data), &out); err != nil {
+		return nil, fmt.Errorf("invalid response from provider (%d)", status)
+	}
+
+	date, err := time.ParseInLocation("2006-01-02 03:04:05 PM", out.PaymentDate, time.Local)
+	if err != nil {
+		date = time.Now()
+	}
+
+	return &Charge{
+		Reference: ref,
+		// 00: transaction completed, 01: transaction approved
+		Success: out.Status == "00" || out.Status == "01",
+		Amount:  out.Amount,
+		Date:    date,
+		Meta:    map[string]json.RawMessage{},
+		Raw:     remitaJSON(data),
+	}, nil
+}
+
+// Refund remita does not refund collections through its api
+func (s *Remita) Refund(ref string, amount decimal.Decimal, key string) (*Refund, error) {
+	return nil, ErrNotSupported
+}
+
+// ParseWebhook remita notifications are not signed, the payment status is queried
+// from remita instead of trusting the notification
+func (s *Remita) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	if len(s.keys.Secret) == 0 || len(s.keys.MerchantID) == 0 {
+		return nil, errors.New("remita keys are not configured")
+	}
+
+	in := []struct {
+		RRR        string `json:"rrr"`
+		PayerEmail string `json:"payerEmail"`
+	}{}
+	if err := json.Unmarshal(body, &in); err != nil || len(in) == 0 {
+		return nil, errors.New("invalid remita notification")
+	}
+
+	charge, err := s.Verify(in[0].RRR)
+	if err != nil {
+		return nil, err
+	}
+	charge.Email = in[0].PayerEmail
+
+	return &Event{Name: "payment.notification", Charge: charge}, nil
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func paystackSignature(secret string, body []byte) string {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func flutterwaveSignature(hash string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(hash))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestPaystackParseWebhook(t *testing.T) {
+	body := []byte(`{"event":"charge.success","data":{"reference":"ref-1","status":"success","amount":150000,"customer":{"email":"a@b.c"},"metadata":{"site_id":"s1"}}}`)
+
+	tests := []struct {
+		name   string
+		secret string
+		sig    string
+		ok     bool
+	}{
+		{"valid signature", "sk_test", paystackSignature("sk_test", body), true},
+		{"upper case signature", "sk_test", strings.ToUpper(paystackSignature("sk_test", body)), true},
+		{"wrong secret", "sk_test", paystackSignature("sk_other", body), false},
+		{"missing signature", "sk_test", "", false},
+		{"empty secret", "", paystackSignature("", body), false},
+		{"empty secret and signature", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("x-paystack-signature", tt.sig)
+
+			p := &Paystack{keys: Keys{Secret: tt.secret}}
+			event, err := p.ParseWebhook(header, body)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseWebhook() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			if event.Name != "charge.success" || event.Charge == nil {
+				t.Fatalf("ParseWebhook() event = %+v", event)
+			}
+			if event.Charge.Reference != "ref-1" || !event.Charge.Success {
+				t.Errorf("charge = %+v", event.Charge)
+			}
+			if !event.Charge.Amount.Equal(decimal.New(1500, 0)) {
+				t.Errorf("amount = %s, want 1500", event.Charge.Amount)
+			}
+		})
+	}
+}
+
+func TestFlutterwaveParseWebhook(t *testing.T) {
+	body := []byte(`{"event":"charge.completed","data":{"id":42,"tx_ref":"tx-1","status":"successful","amount":2500,"customer":{"email":"a@b.c"}},"meta_data":{"site_id":"s1"}}`)
+
+	tests := []struct {
+		name   string
+		hash   string
+		header map[string]string
+		ok     bool
+	}{
+		{"valid signature", "hash", map[string]string{"flutterwave-signature": flutterwaveSignature("hash", body)}, true},
+		{"wrong signature", "hash", map[string]string{"flutterwave-signature": flutterwaveSignature("other", body)}, false},
+		{"valid verif-hash", "hash", map[string]string{"verif-hash": "hash"}, true},
+		{"wrong verif-hash", "hash", map[string]string{"verif-hash": "other"}, false},
+		{"no header", "hash", map[string]string{}, false},
+		{"empty hash", "", map[string]string{"verif-hash": ""}, false},
+		{"empty hash with signature", "", map[string]string{"flutterwave-signature": flutterwaveSignature("", body)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+
+			p := &Flutterwave{keys: Keys{Secret: "sk", WebhookHash: tt.hash}}
+			event, err := p.ParseWebhook(header, body)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseWebhook() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			if event.Charge == nil || event.Charge.Reference != "42" || !event.Charge.Success {
+				t.Fatalf("charge = %+v", event.Charge)
+			}
+			if _, found := event.Charge.Meta["site_id"]; !found {
+				t.Errorf("meta = %v, want the meta_data of the webhook", event.Charge.Meta)
+			}
+		})
+	}
+}
+
+func TestRemitaParseWebhookKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys Keys
+	}{
+		{"no keys", Keys{}},
+		{"no secret", Keys{MerchantID: "m1"}},
+		{"no merchant", Keys{Secret: "sk"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Remita{keys: tt.keys}
+			if _, err := p.ParseWebhook(http.Header{}, []byte(`[{"rrr":"123"}]`)); err == nil {
+				t.Fatal("ParseWebhook() accepted a notification without keys")
+			}
+		})
+	}
+
+	p := &Remita{keys: Keys{Secret: "sk", MerchantID: "m1"}}
+	if _, err := p.ParseWebhook(http.Header{}, []byte(`[]`)); err == nil {
+		t.Fatal("ParseWebhook() accepted an empty notification")
+	}
+}
@@ -189,15 +189,16 @@ type InvoiceMaster struct {
 
 // Transaction ...
 type Transaction struct {
-	ID         string          `json:"id"`
-	SiteID     string          `json:"site_id"`
-	ResidentID string          `json:"resident_id"`
-	Type       int             `json:"type"`
-	DateTrx    utils.DateTime  `json:"date_trx"`
-	InvoiceID  string          `json:"invoice_id"`
-	PaymentID  string          `json:"payment_id"`
-	DueID      string          `json:"due_id"`
-	Amount     decimal.Decimal `json:"amount" sql:",notnull"`
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id"`
+	ResidentID   string          `json:"resident_id"`
+	Type         int             `json:"type"`
+	DateTrx      utils.DateTime  `json:"date_trx"`
+	InvoiceID    string          `json:"invoice_id"`
+	PaymentID    string          `json:"payment_id"`
+	CreditNoteID string          `json:"credit_note_id"`
+	DueID        string          `json:"due_id"`
+	Amount       decimal.Decimal `json:"amount" sql:",notnull"`
 }
 
 // NoticeBoard ...
@@ -213,16 +214,106 @@ type NoticeBoard struct {
 
 // GatePass ...
 type GatePass struct {
-	ID          string          `json:"id"`
-	SiteID      string          `json:"site_id,omitempty"`
-	ResidentID  string          `json:"resident_id"`
-	DateCreated utils.DateTime  `json:"date_created"`
-	Token       string          `json:"token"`
-	PlateNumber string          `json:"plate_number"`
-	Type        int             `json:"type" sql:",notnull"`
-	Status      int             `json:"status" sql:",notnull"`
-	Resident    string          `json:"resident" sql:"-"`
-	Attr        json.RawMessage `json:"attr"`
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id,omitempty"`
+	ResidentID   string          `json:"resident_id"`
+	DateCreated  utils.DateTime  `json:"date_created"`
+	Token        string          `json:"token"`
+	PlateNumber  string          `json:"plate_number"`
+	Type         int             `json:"type" sql:",notnull"`
+	Status       int             `json:"status" sql:",notnull"`
+	Resident     string          `json:"resident" sql:"-"`
+	Attr         json.RawMessage `json:"attr"`
+	MaxUses      int             `json:"max_uses"`
+	Uses         int             `json:"uses" sql:",notnull"`
+	DateCheckin  utils.DateTime  `json:"date_checkin"`
+	DateCheckout utils.DateTime  `json:"date_checkout"`
+	CheckinBy    string          `json:"checkin_by"`
+	CheckoutBy   string          `json:"checkout_by"`
+	ValidFrom    utils.DateTime  `json:"valid_from"`
+	ValidUntil   utils.DateTime  `json:"valid_until"`
+	Schedule     json.RawMessage `json:"schedule"`
+	DateRevoked  utils.DateTime  `json:"date_revoked"`
+	RevokedBy    string          `json:"revoked_by"`
+	QR           string          `json:"qr" sql:"-"`
+}
+
+// GatePassSchedule limits a pass to days of the week (0 is sunday, none for every day)
+// and hours of the day in 15:04 format
+type GatePassSchedule struct {
+	Days []int  `json:"days"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// GatePassLog is a scan of a gate pass at the gate
+type GatePassLog struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	GatePassID  string         `json:"gate_pass_id"`
+	Token       string         `json:"token" sql:",notnull"`
+	ResidentID  string         `json:"resident_id"`
+	SecurityID  string         `json:"security_id"`
+	Gate        string         `json:"gate" sql:",notnull"`
+	Action      int            `json:"action" sql:",notnull"`
+	Reason      string         `json:"reason" sql:",notnull"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// Watchlist is a person or vehicle security must refuse or escort
+type Watchlist struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	Name        string         `json:"name" sql:",notnull"`
+	Phone       string         `json:"phone" sql:",notnull"`
+	PlateNumber string         `json:"plate_number" sql:",notnull"`
+	Action      int            `json:"action"`
+	Reason      string         `json:"reason" sql:",notnull"`
+	Active      bool           `json:"active" sql:",notnull"`
+	DateExpiry  utils.DateTime `json:"date_expiry"`
+	CreatedBy   UserDetails    `json:"created_by"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// WatchlistHit is a visitor or gate pass that matched the watchlist
+type WatchlistHit struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	WatchlistID string         `json:"watchlist_id"`
+	Source      string         `json:"source"`
+	SourceID    string         `json:"source_id" sql:",notnull"`
+	MatchedOn   string         `json:"matched_on"`
+	Value       string         `json:"value" sql:",notnull"`
+	UserID      string         `json:"user_id" sql:",notnull"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// Vehicle is a vehicle registered by a residency
+type Vehicle struct {
+	ID            string         `json:"id"`
+	SiteID        string         `json:"site_id"`
+	ResidencyID   string         `json:"residency_id"`
+	ResidentID    string         `json:"resident_id"`
+	PlateNumber   string         `json:"plate_number"`
+	Make          string         `json:"make" sql:",notnull"`
+	Colour        string         `json:"colour" sql:",notnull"`
+	StickerNumber string         `json:"sticker_number" sql:",notnull"`
+	Active        bool           `json:"active" sql:",notnull"`
+	DateCreated   utils.DateTime `json:"date_created"`
+}
+
+// VehicleLog is a vehicle entering or leaving the site
+type VehicleLog struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	PlateNumber string         `json:"plate_number"`
+	Owner       string         `json:"owner"`
+	VehicleID   string         `json:"vehicle_id"`
+	GatePassID  string         `json:"gate_pass_id"`
+	Direction   int            `json:"direction"`
+	Gate        string         `json:"gate" sql:",notnull"`
+	SecurityID  string         `json:"security_id"`
+	DateCreated utils.DateTime `json:"date_created"`
 }
 
 // Visitor ...
@@ -243,6 +334,12 @@ type Visitor struct {
 	Resident         string          `json:"resident" sql:"-"`
 	Security         string          `json:"security" sql:"-"`
 	Attr             json.RawMessage `json:"attr"`
+	ExpectedFrom     utils.DateTime  `json:"expected_from"`
+	ExpectedUntil    utils.DateTime  `json:"expected_until"`
+	DateCheckin      utils.DateTime  `json:"date_checkin"`
+	DateCheckout     utils.DateTime  `json:"date_checkout"`
+	CheckoutBy       string          `json:"checkout_by"`
+	DateDenied       utils.DateTime  `json:"date_denied"`
 }
 
 // Invoice ...
@@ -262,22 +359,91 @@ type Invoice struct {
 	Amount        decimal.Decimal `json:"amount"`
 	Dues          json.RawMessage `json:"dues"`
 	InvoiceNumber int64           `json:"invoice_number"`
+	InvoiceNo     string          `json:"invoice_no"`
 	UnitTypeLabel string          `json:"unit_type_label" sql:"-"`
 	Resident      string          `json:"resident" sql:"-"`
 }
 
+// InvoiceSeries numbers the invoices of a site, Format takes the {prefix}, {year}
+// and {number} tokens
+type InvoiceSeries struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	Prefix      string         `json:"prefix" sql:",notnull"`
+	Format      string         `json:"format"`
+	Padding     int            `json:"padding"`
+	ResetYearly bool           `json:"reset_yearly" sql:",notnull"`
+	Year        int            `json:"year" sql:",notnull"`
+	NextNumber  int64          `json:"next_number"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
 // Payment ...
 type Payment struct {
-	ID         string          `json:"id"`
-	SiteID     string          `json:"site_id"`
-	ResidentID string          `json:"resident_id"`
-	DateTrx    utils.DateTime  `json:"date_trx"`
-	Narration  string          `json:"narration" sql:",notnull"`
-	Amount     decimal.Decimal `json:"amount"`
-	Dues       json.RawMessage `json:"dues"`
-	PayMode    int             `json:"pay_mode"`
-	Attr       json.RawMessage `json:"attr"`
-	Metadata   json.RawMessage `json:"metadata"`
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	ResidentID  string          `json:"resident_id"`
+	DateTrx     utils.DateTime  `json:"date_trx"`
+	Narration   string          `json:"narration" sql:",notnull"`
+	Amount      decimal.Decimal `json:"amount"`
+	Dues        json.RawMessage `json:"dues"`
+	PayMode     int             `json:"pay_mode"`
+	Allocation  int             `json:"allocation" sql:",notnull"`
+	Attr        json.RawMessage `json:"attr"`
+	Metadata    json.RawMessage `json:"metadata"`
+	ProviderID  PayProvider     `json:"provider_id" sql:",notnull"`
+	ProviderRef string          `json:"provider_ref"`
+	Status      int             `json:"status" sql:",notnull"`
+}
+
+// PaymentReversal offsets a payment, reversals above the approval amount wait for a
+// second official
+type PaymentReversal struct {
+	ID              string          `json:"id"`
+	SiteID          string          `json:"site_id"`
+	PaymentID       string          `json:"payment_id"`
+	ResidentID      string          `json:"resident_id"`
+	Reference       string          `json:"reference"`
+	Amount          decimal.Decimal `json:"amount" sql:",notnull"`
+	Reason          string          `json:"reason" sql:",notnull"`
+	Status          int             `json:"status" sql:",notnull"`
+	RefundStatus    int             `json:"refund_status" sql:",notnull"`
+	RefundReference string          `json:"refund_reference" sql:",notnull"`
+	RequestedBy     UserDetails     `json:"requested_by"`
+	ApprovedBy      UserDetails     `json:"approved_by"`
+	DateCreated     utils.DateTime  `json:"date_created"`
+	DateApproved    utils.DateTime  `json:"date_approved"`
+	Attr            json.RawMessage `json:"attr"`
+}
+
+// PaymentWebhook is an event received from a payment provider
+type PaymentWebhook struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	Provider    PayProvider     `json:"provider"`
+	Event       string          `json:"event" sql:",notnull"`
+	Reference   string          `json:"reference" sql:",notnull"`
+	Status      int             `json:"status" sql:",notnull"`
+	PaymentID   string          `json:"payment_id"`
+	Payload     json.RawMessage `json:"payload"`
+	Error       string          `json:"error" sql:",notnull"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// IdempotencyKey is the stored response of a request sent with an Idempotency-Key header
+type IdempotencyKey struct {
+	ID             string         `json:"id"`
+	SiteID         string         `json:"site_id" sql:",notnull"`
+	UserID         string         `json:"user_id"`
+	Key            string         `json:"key"`
+	Method         string         `json:"method"`
+	Path           string         `json:"path"`
+	RequestHash    string         `json:"request_hash"`
+	Status         int            `json:"status" sql:",notnull"`
+	ResponseStatus int            `json:"response_status" sql:",notnull"`
+	ContentType    string         `json:"content_type" sql:",notnull"`
+	ResponseBody   []byte         `json:"-"`
+	DateCreated    utils.DateTime `json:"date_created"`
 }
 
 type PaymentPending struct {
@@ -289,10 +455,288 @@ type PaymentPending struct {
 	Narration    string          `json:"narration" sql:",notnull"`
 	Amount       decimal.Decimal `json:"amount"`
 	PayMode      int             `json:"pay_mode"`
+	Allocation   int             `json:"allocation" sql:",notnull"`
+	Dues         json.RawMessage `json:"dues"`
+	Attr         json.RawMessage `json:"attr"`
+}
+
+// CreditNote reduces what a resident owes without deleting invoices or payments
+type CreditNote struct {
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id"`
+	ResidentID   string          `json:"resident_id"`
+	InvoiceID    string          `json:"invoice_id"`
+	Reference    string          `json:"reference"`
+	Type         int             `json:"type" sql:",notnull"`
+	Status       int             `json:"status" sql:",notnull"`
+	Percentage   decimal.Decimal `json:"percentage" sql:",notnull"`
+	Amount       decimal.Decimal `json:"amount" sql:",notnull"`
 	Dues         json.RawMessage `json:"dues"`
+	Reason       string          `json:"reason" sql:",notnull"`
+	RequestedBy  UserDetails     `json:"requested_by"`
+	ApprovedBy   UserDetails     `json:"approved_by"`
+	DateCreated  utils.DateTime  `json:"date_created"`
+	DateApproved utils.DateTime  `json:"date_approved"`
 	Attr         json.RawMessage `json:"attr"`
 }
 
+// Wallet holds the credit a primary resident has paid ahead, the balance is the sum of
+// its movements
+type Wallet struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	ResidentID  string          `json:"resident_id"`
+	Balance     decimal.Decimal `json:"balance" sql:"-"`
+	AutoApply   bool            `json:"auto_apply" sql:",notnull"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// WalletMovement is a single funding or use of a wallet
+type WalletMovement struct {
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id"`
+	WalletID     string          `json:"wallet_id"`
+	ResidentID   string          `json:"resident_id"`
+	Type         int             `json:"type" sql:",notnull"`
+	Amount       decimal.Decimal `json:"amount" sql:",notnull"`
+	PaymentID    string          `json:"payment_id"`
+	CreditNoteID string          `json:"credit_note_id"`
+	InvoiceID    string          `json:"invoice_id"`
+	Narration    string          `json:"narration" sql:",notnull"`
+	CreatedBy    UserDetails     `json:"created_by"`
+	DateTrx      utils.DateTime  `json:"date_trx"`
+}
+
+// DunningPolicy is how a site chases overdue accounts, Stages holds []DunningStage
+type DunningPolicy struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	Name        string          `json:"name" sql:",notnull"`
+	Active      bool            `json:"active" sql:",notnull"`
+	MinBalance  decimal.Decimal `json:"min_balance" sql:",notnull"`
+	RunHour     int             `json:"run_hour" sql:",notnull"`
+	Stages      json.RawMessage `json:"stages"`
+	DateLastRun utils.DateTime  `json:"date_last_run"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// DunningStage is reached when the oldest unpaid invoice of a resident is Days old.
+// Template is a jet template in the templates folder, dunning_notice.jet.html by default
+type DunningStage struct {
+	Days             int    `json:"days"`
+	Name             string `json:"name"`
+	Subject          string `json:"subject"`
+	Message          string `json:"message"`
+	Template         string `json:"template"`
+	Email            bool   `json:"email"`
+	Push             bool   `json:"push"`
+	Final            bool   `json:"final"`
+	RestrictGatePass bool   `json:"restrict_gate_pass"`
+	FlagAtGate       bool   `json:"flag_at_gate"`
+}
+
+// ResidentDunning is the stage a resident has reached
+type ResidentDunning struct {
+	ResidentID       string          `json:"resident_id" sql:",pk"`
+	SiteID           string          `json:"site_id"`
+	PolicyID         string          `json:"policy_id"`
+	Stage            int             `json:"stage" sql:",notnull"`
+	StageName        string          `json:"stage_name" sql:",notnull"`
+	DaysOverdue      int             `json:"days_overdue" sql:",notnull"`
+	Balance          decimal.Decimal `json:"balance" sql:",notnull"`
+	RestrictGatePass bool            `json:"restrict_gate_pass" sql:",notnull"`
+	FlagAtGate       bool            `json:"flag_at_gate" sql:",notnull"`
+	DateStarted      utils.DateTime  `json:"date_started"`
+	DateUpdated      utils.DateTime  `json:"date_updated"`
+}
+
+// DunningHistory records each reminder sent to a resident and the settlement of the account
+type DunningHistory struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	ResidentID  string          `json:"resident_id"`
+	PolicyID    string          `json:"policy_id"`
+	Stage       int             `json:"stage" sql:",notnull"`
+	StageName   string          `json:"stage_name" sql:",notnull"`
+	DaysOverdue int             `json:"days_overdue" sql:",notnull"`
+	Balance     decimal.Decimal `json:"balance" sql:",notnull"`
+	Email       bool            `json:"email" sql:",notnull"`
+	Push        bool            `json:"push" sql:",notnull"`
+	Actions     json.RawMessage `json:"actions"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// PaymentPlan spreads a residents arrears over a schedule of installments
+type PaymentPlan struct {
+	ID           string                   `json:"id"`
+	SiteID       string                   `json:"site_id"`
+	ResidentID   string                   `json:"resident_id"`
+	Arrears      decimal.Decimal          `json:"arrears" sql:",notnull"`
+	Installments int                      `json:"installments" sql:",notnull"`
+	Frequency    int                      `json:"frequency" sql:",notnull"`
+	StartDate    utils.DateTime           `json:"start_date"`
+	Status       int                      `json:"status" sql:",notnull"`
+	Note         string                   `json:"note" sql:",notnull"`
+	CreatedBy    UserDetails              `json:"created_by"`
+	DateCreated  utils.DateTime           `json:"date_created"`
+	Schedule     []PaymentPlanInstallment `json:"schedule" sql:"-"`
+}
+
+// PaymentPlanInstallment ...
+type PaymentPlanInstallment struct {
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id"`
+	PlanID       string          `json:"plan_id"`
+	ResidentID   string          `json:"resident_id"`
+	Number       int             `json:"number" sql:",notnull"`
+	DueDate      utils.DateTime  `json:"due_date"`
+	Amount       decimal.Decimal `json:"amount" sql:",notnull"`
+	Paid         decimal.Decimal `json:"paid" sql:",notnull"`
+	Status       int             `json:"status" sql:",notnull"`
+	DatePaid     utils.DateTime  `json:"date_paid"`
+	DateNotified utils.DateTime  `json:"date_notified"`
+}
+
+// PaymentPlanPayment is the part of a payment applied to an installment
+type PaymentPlanPayment struct {
+	ID            string          `json:"id"`
+	SiteID        string          `json:"site_id"`
+	PlanID        string          `json:"plan_id"`
+	InstallmentID string          `json:"installment_id"`
+	PaymentID     string          `json:"payment_id"`
+	Amount        decimal.Decimal `json:"amount" sql:",notnull"`
+	DateCreated   utils.DateTime  `json:"date_created"`
+}
+
+// ExpenseCategory ...
+type ExpenseCategory struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description" sql:",notnull"`
+	DueID       string         `json:"due_id"`
+	Status      int            `json:"status"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// Vendor is a supplier the association pays
+type Vendor struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	Name        string          `json:"name"`
+	Phone       string          `json:"phone" sql:",notnull"`
+	Email       string          `json:"email" sql:",notnull"`
+	Address     string          `json:"address" sql:",notnull"`
+	Attr        json.RawMessage `json:"attr"`
+	Status      int             `json:"status"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// Expense is money spent by the association, it is posted to the ledger once approved
+type Expense struct {
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id"`
+	CategoryID   string          `json:"category_id"`
+	VendorID     string          `json:"vendor_id"`
+	DueID        string          `json:"due_id"`
+	DateTrx      utils.DateTime  `json:"date_trx"`
+	Amount       decimal.Decimal `json:"amount" sql:",notnull"`
+	Description  string          `json:"description" sql:",notnull"`
+	Reference    string          `json:"reference" sql:",notnull"`
+	PayMode      int             `json:"pay_mode" sql:",notnull"`
+	Receipts     json.RawMessage `json:"receipts"`
+	Status       int             `json:"status" sql:",notnull"`
+	RequestedBy  UserDetails     `json:"requested_by"`
+	ApprovedBy   UserDetails     `json:"approved_by"`
+	DateApproved utils.DateTime  `json:"date_approved"`
+	DateCreated  utils.DateTime  `json:"date_created"`
+}
+
+// Budget is the amount planned for a due in a year
+type Budget struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	Year        int             `json:"year"`
+	DueID       string          `json:"due_id"`
+	Amount      decimal.Decimal `json:"amount" sql:",notnull"`
+	Note        string          `json:"note" sql:",notnull"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// LedgerAccount is an account in a sites chart of accounts. Accounts the system posts
+// to have a Kind and Ref (due id or pay mode), other accounts are kept by officials
+type LedgerAccount struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	Code        string         `json:"code"`
+	Name        string         `json:"name"`
+	Type        int            `json:"type"`
+	Kind        int            `json:"kind" sql:",notnull"`
+	Ref         string         `json:"ref" sql:",notnull"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// Journal is a balanced double entry posting for a document
+type Journal struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	ResidentID  string         `json:"resident_id"`
+	DateTrx     utils.DateTime `json:"date_trx"`
+	SourceType  int            `json:"source_type"`
+	SourceID    string         `json:"source_id" sql:",notnull"`
+	Narration   string         `json:"narration" sql:",notnull"`
+	ReversalOf  string         `json:"reversal_of"`
+	Reversed    bool           `json:"reversed" sql:",notnull"`
+	CreatedBy   UserDetails    `json:"created_by"`
+	DateCreated utils.DateTime `json:"date_created"`
+	Lines       []JournalLine  `json:"lines" sql:"-"`
+}
+
+// JournalLine ...
+type JournalLine struct {
+	ID        string          `json:"id"`
+	SiteID    string          `json:"site_id"`
+	JournalID string          `json:"journal_id"`
+	AccountID string          `json:"account_id"`
+	Debit     decimal.Decimal `json:"debit" sql:",notnull"`
+	Credit    decimal.Decimal `json:"credit" sql:",notnull"`
+}
+
+// BankStatement is a bank statement file imported by an official
+type BankStatement struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	FileName    string         `json:"file_name" sql:",notnull"`
+	Format      string         `json:"format"`
+	Account     string         `json:"account" sql:",notnull"`
+	DateFrom    utils.DateTime `json:"date_from"`
+	DateTo      utils.DateTime `json:"date_to"`
+	Credits     int            `json:"credits" sql:",notnull"`
+	Duplicates  int            `json:"duplicates" sql:",notnull"`
+	ImportedBy  UserDetails    `json:"imported_by"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// BankStatementLine is a credit on a bank statement and the pending payment or
+// resident it was matched to
+type BankStatementLine struct {
+	ID             string          `json:"id"`
+	SiteID         string          `json:"site_id"`
+	StatementID    string          `json:"statement_id"`
+	DateTrx        utils.DateTime  `json:"date_trx"`
+	Amount         decimal.Decimal `json:"amount"`
+	Narration      string          `json:"narration" sql:",notnull"`
+	Reference      string          `json:"reference"`
+	Status         int             `json:"status" sql:",notnull"`
+	MatchType      int             `json:"match_type" sql:",notnull"`
+	PendingID      string          `json:"pending_id"`
+	ResidentID     string          `json:"resident_id"`
+	Score          int             `json:"score" sql:",notnull"`
+	PaymentID      string          `json:"payment_id"`
+	ReconciledBy   UserDetails     `json:"reconciled_by"`
+	DateReconciled utils.DateTime  `json:"date_reconciled"`
+}
+
 // LoginForm ...
 type LoginForm struct {
 	Email      string `json:"email"`
@@ -348,20 +792,39 @@ type PaymentProviders struct {
 }
 
 type InitializePaystackRequest struct {
-	Email  string `json:"email"`
-	Amount string `json:"amount"`
-}
-
-type PayResponse struct {
-	AuthorizationUrl string `json:"authorization_url"`
-	AccessCode       string `json:"access_code"`
-	Reference        string `json:"reference"`
+	Email     string          `json:"email"`
+	Amount    string          `json:"amount"`
+	Reference string          `json:"reference,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
 }
 
-type InitializePaystackResponse struct {
-	Status  bool        `json:"status"`
-	Message string      `json:"message"`
-	Data    PayResponse `json:"data"`
+// InitializePaymentRequest starts an online payment, the amount is in naira
+type InitializePaymentRequest struct {
+	Email       string          `json:"email"`
+	Name        string          `json:"name"`
+	Phone       string          `json:"phone"`
+	Amount      decimal.Decimal `json:"amount"`
+	Reference   string          `json:"reference"`
+	Description string          `json:"description"`
+	CallbackURL string          `json:"callback_url"`
+	Metadata    json.RawMessage `json:"metadata"`
+}
+
+// SitePaymentProvider are the keys a site uses with a payment provider, sites without
+// keys use the platform keys
+type SitePaymentProvider struct {
+	ID            string         `json:"id"`
+	SiteID        string         `json:"site_id"`
+	ProviderID    PayProvider    `json:"provider_id"`
+	PublicKey     string         `json:"public_key" sql:",notnull"`
+	SecretKey     string         `json:"secret_key" sql:",notnull"`
+	EncryptionKey string         `json:"encryption_key" sql:",notnull"`
+	WebhookHash   string         `json:"webhook_hash" sql:",notnull"`
+	MerchantID    string         `json:"merchant_id" sql:",notnull"`
+	ServiceTypeID string         `json:"service_type_id" sql:",notnull"`
+	Live          bool           `json:"live" sql:",notnull"`
+	Active        bool           `json:"active" sql:",notnull"`
+	DateCreated   utils.DateTime `json:"date_created"`
 }
 
 type PaymentLog struct {
@@ -397,23 +860,127 @@ type ResidentDashboard struct {
 	Name           string          `json:"name"`
 	ResidentDues   ResidentDues    `json:"resident_dues"`
 	GatePassList   GatePassList    `json:"gate_pass_list"`
+	ActivePasses   GatePassList    `json:"active_passes"`
+	UpcomingPasses GatePassList    `json:"upcoming_passes"`
 	SubResidents   SubResidents    `json:"sub_residents"`
 	Notification   NoticeBoards    `json:"notification"`
 	InDebt         bool            `json:"in_debt"`
 	AccountBalance decimal.Decimal `json:"account_balance"`
+	Wallet         WalletSummary   `json:"wallet"`
 }
 
 type ResidentAlerts struct {
+	ID              string          `json:"id"`
+	SiteID          string          `json:"site_id"`
+	ResidentID      string          `json:"resident_id"`
+	Name            string          `json:"name"`
+	PhoneNumber     string          `json:"phone_number"`
+	Address         string          `json:"Address"`
+	Status          ResidentAlert   `json:"status"`
+	Attr            json.RawMessage `json:"attr"`
+	TimeLogged      utils.DateTime  `json:"time_logged"`
+	TimeResponded   utils.DateTime  `json:"time_responded"`
+	RespondedBy     string          `json:"responded_by"`
+	TimeResolved    utils.DateTime  `json:"time_resolved"`
+	ResolvedBy      string          `json:"resolved_by"`
+	EscalationLevel int             `json:"escalation_level" sql:",notnull"`
+	TimeEscalated   utils.DateTime  `json:"time_escalated"`
+	Category        string          `json:"category" sql:",notnull"`
+	Note            string          `json:"note" sql:",notnull"`
+	Photos          json.RawMessage `json:"photos"`
+	UnitID          string          `json:"unit_id"`
+	StreetID        string          `json:"street_id"`
+}
+
+// GuardShift is a shift a guard is scheduled for, the guard clocks in and out from the app
+type GuardShift struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	GuardID     string         `json:"guard_id"`
+	Name        string         `json:"name" sql:",notnull"`
+	DateStart   utils.DateTime `json:"date_start"`
+	DateEnd     utils.DateTime `json:"date_end"`
+	Status      int            `json:"status" sql:",notnull"`
+	ClockIn     utils.DateTime `json:"clock_in"`
+	ClockOut    utils.DateTime `json:"clock_out"`
+	Note        string         `json:"note" sql:",notnull"`
+	CreatedBy   UserDetails    `json:"created_by"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// PatrolCheckpoint is a point guards scan on patrol, its code is printed on the checkpoint
+type PatrolCheckpoint struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	Name        string         `json:"name"`
+	Code        string         `json:"code"`
+	Location    string         `json:"location" sql:",notnull"`
+	StreetID    string         `json:"street_id"`
+	Active      bool           `json:"active" sql:",notnull"`
+	DateCreated utils.DateTime `json:"date_created"`
+}
+
+// PatrolScan is a checkpoint scanned by a guard on shift
+type PatrolScan struct {
+	ID           string         `json:"id"`
+	SiteID       string         `json:"site_id"`
+	CheckpointID string         `json:"checkpoint_id"`
+	ShiftID      string         `json:"shift_id"`
+	GuardID      string         `json:"guard_id"`
+	Note         string         `json:"note" sql:",notnull"`
+	DateCreated  utils.DateTime `json:"date_created"`
+}
+
+// Incident is the report a guard files after responding to an alert, officials sign it off
+type Incident struct {
 	ID            string          `json:"id"`
 	SiteID        string          `json:"site_id"`
-	ResidentID    string          `json:"resident_id"`
-	Name          string          `json:"name"`
-	PhoneNumber   string          `json:"phone_number"`
-	Address       string          `json:"Address"`
-	Status        ResidentAlert   `json:"status"`
-	Attr          json.RawMessage `json:"attr"`
-	TimeLogged    utils.DateTime  `json:"time_logged"`
-	TimeResponded utils.DateTime  `json:"time_responded"`
+	AlertID       string          `json:"alert_id"`
+	Category      string          `json:"category" sql:",notnull"`
+	Title         string          `json:"title" sql:",notnull"`
+	Description   string          `json:"description" sql:",notnull"`
+	Location      string          `json:"location" sql:",notnull"`
+	UnitID        string          `json:"unit_id"`
+	StreetID      string          `json:"street_id"`
+	DateOccurred  utils.DateTime  `json:"date_occurred"`
+	Attachments   json.RawMessage `json:"attachments"`
+	Status        int             `json:"status" sql:",notnull"`
+	ReportedBy    UserDetails     `json:"reported_by"`
+	DateSubmitted utils.DateTime  `json:"date_submitted"`
+	ReviewedBy    UserDetails     `json:"reviewed_by"`
+	ReviewNote    string          `json:"review_note" sql:",notnull"`
+	DateReviewed  utils.DateTime  `json:"date_reviewed"`
+	DateCreated   utils.DateTime  `json:"date_created"`
+}
+
+// AlertEscalationPolicy escalates the alerts of a site security has not acknowledged
+type AlertEscalationPolicy struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	Active      bool            `json:"active" sql:",notnull"`
+	Tiers       json.RawMessage `json:"tiers"`
+	OnShiftOnly bool            `json:"on_shift_only" sql:",notnull"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// AlertEscalationTier is reached when an alert is AfterSeconds old and still not
+// acknowledged. Target is security, every guard of the site, or officials
+type AlertEscalationTier struct {
+	AfterSeconds int    `json:"after_seconds"`
+	Target       string `json:"target"`
+	Push         bool   `json:"push"`
+	Email        bool   `json:"email"`
+}
+
+// AlertEscalation is a tier an alert reached
+type AlertEscalation struct {
+	ID          string         `json:"id"`
+	SiteID      string         `json:"site_id"`
+	AlertID     string         `json:"alert_id"`
+	Level       int            `json:"level"`
+	Target      string         `json:"target"`
+	Notified    int            `json:"notified" sql:",notnull"`
+	DateCreated utils.DateTime `json:"date_created"`
 }
 
 type (
@@ -436,4 +1003,10 @@ type (
 		List  []NoticeBoard `json:"list"`
 		Count int           `json:"count"`
 	}
+
+	WalletSummary struct {
+		Balance   decimal.Decimal  `json:"balance"`
+		AutoApply bool             `json:"auto_apply"`
+		Movements []WalletMovement `json:"movements"`
+	}
 )
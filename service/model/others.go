@@ -1,11 +1,5 @@
 package model
 
-import (
-	"encoding/json"
-	"errors"
-	"fmt"
-)
-
 // PayProvider ...
 type PayProvider int
 
@@ -61,6 +55,9 @@ const (
 	ProviderPaystack
 	ProviderRemita
 	ProviderFlutterwave
+	// ProviderFake is an in memory provider, only built with the fake tag and never
+	// reachable by name
+	ProviderFake
 )
 
 type ResidentAlert int
@@ -74,9 +71,9 @@ const (
 
 // PaymentProviders ...
 var paymentProviders = map[PayProvider]PayEntity{
-	ProviderPaystack:    {Name: "paystack", Value: ProviderPaystack, URL: "https://api.paystack.co/transaction/verify"},
+	ProviderPaystack:    {Name: "paystack", Value: ProviderPaystack},
 	ProviderRemita:      {Name: "remita", Value: ProviderRemita},
-	ProviderFlutterwave: {Name: "flutterwave", Value: ProviderFlutterwave, URL: "https://api.flutterwave.com/v3/transactions"},
+	ProviderFlutterwave: {Name: "flutterwave", Value: ProviderFlutterwave},
 }
 
 // payment types
@@ -86,30 +83,239 @@ const (
 	BankTransaction
 )
 
+// transaction types
+const (
+	TrxPayment int = iota + 1
+	TrxInvoice
+	TrxCreditNote
+	TrxReversal
+)
+
+// payment statuses
+const (
+	PaymentActive int = iota
+	PaymentReversalPending
+	PaymentReversed
+)
+
+// payment reversal statuses
+const (
+	ReversalPending int = iota
+	ReversalApproved
+	ReversalRejected
+)
+
+// refund statuses of a reversal
+const (
+	RefundNone int = iota
+	RefundProcessed
+	RefundManual
+	RefundPending
+	RefundProcessing
+	RefundFailed
+)
+
+// payment allocation strategies
+const (
+	AllocateFIFO int = iota + 1
+	AllocateProportional
+	AllocateExplicit
+)
+
+// wallet movement types
+const (
+	WalletFunded int = iota + 1
+	WalletApplied
+	WalletReversed
+)
+
+// payment plan statuses
+const (
+	PlanActive int = iota + 1
+	PlanCompleted
+	PlanCancelled
+)
+
+// installment statuses
+const (
+	InstallmentPending int = iota
+	InstallmentPaid
+	InstallmentMissed
+)
+
+// ledger account types
+const (
+	AccountAsset int = iota + 1
+	AccountLiability
+	AccountEquity
+	AccountIncome
+	AccountExpense
+)
+
+// ledger accounts the system posts to
+const (
+	LedgerOther int = iota
+	LedgerBank
+	LedgerReceivable
+	LedgerWallet
+	LedgerIncome
+	LedgerAllowance
+	LedgerExpense
+)
+
+// journal sources
+const (
+	JournalPayment int = iota + 1
+	JournalInvoice
+	JournalCreditNote
+	JournalWallet
+	JournalManual
+	JournalExpense
+)
+
+// expense statuses
+const (
+	ExpensePending int = iota
+	ExpenseApproved
+	ExpenseRejected
+)
+
+// bank statement line statuses
+const (
+	StatementLineUnmatched int = iota
+	StatementLineMatched
+	StatementLineReconciled
+	StatementLineIgnored
+)
+
+// what a bank statement line was matched to
+const (
+	MatchPendingPayment int = iota + 1
+	MatchResident
+)
+
+// payment webhook statuses
+const (
+	WebhookRecorded int = iota + 1
+	WebhookReconciled
+	WebhookIgnored
+	WebhookUnmatched
+	WebhookFailed
+)
+
+// idempotency key statuses
+const (
+	IdempotencyInProgress int = iota
+	IdempotencyComplete
+)
+
+// gate pass types, passes without a type allow entry and exit
 const (
-	PaymentDelete PaymentOPerations = "Delete"
-	PaymentInsert                   = "Insert"
+	GatePassInOut int = iota
+	GatePassEntry
+	GatePassExit
+	GatePassEntryExit
+)
+
+// gate pass statuses
+const (
+	GatePassUnused int = iota
+	GatePassCheckedIn
+	GatePassCheckedOut
+	GatePassUsed
+	GatePassExpired
+	GatePassRevoked
+)
+
+// gate pass log actions
+const (
+	GateRejected int = iota
+	GateCheckIn
+	GateCheckOut
+)
+
+// alert escalation targets
+const (
+	EscalateSecurity  = "security"
+	EscalateOfficials = "officials"
+)
+
+// alert categories, alerts raised without one are panic alerts
+const (
+	AlertPanic     = "panic"
+	AlertMedical   = "medical"
+	AlertFire      = "fire"
+	AlertIntrusion = "intrusion"
+	AlertNoise     = "noise"
+)
+
+// incident statuses
+const (
+	IncidentDraft int = iota
+	IncidentSubmitted
+	IncidentSignedOff
+	IncidentReturned
+)
+
+// guard shift statuses
+const (
+	ShiftScheduled int = iota
+	ShiftOnDuty
+	ShiftCompleted
+	ShiftCancelled
+)
+
+// visitor registration types
+const (
+	VisitorByResident = iota + 1
+	VisitorBySecurity
+)
+
+// visitor statuses
+const (
+	VisitorExpected = iota
+	VisitorIn
+	VisitorOut
+	VisitorDenied
+)
+
+// owners of a vehicle at the gate
+const (
+	VehicleResident = "resident"
+	VehicleVisitor  = "visitor"
+	VehicleUnknown  = "unknown"
+)
+
+// watchlist actions
+const (
+	WatchlistDeny = iota + 1
+	WatchlistEscort
+)
+
+// credit note types
+const (
+	CreditNoteCredit int = iota + 1
+	CreditNoteDiscount
+	CreditNoteWaiver
+)
+
+// credit note statuses
+const (
+	CreditNotePending int = iota
+	CreditNoteApproved
+	CreditNoteRejected
+)
+
+const (
+	PaymentDelete  PaymentOPerations = "Delete"
+	PaymentInsert                    = "Insert"
+	PaymentReverse                   = "Reverse"
 )
 
 // PayEntity ...
 type PayEntity struct {
 	Name  string
 	Value PayProvider
-	URL   string
-}
-
-// PaymentProviderResponse ...
-type PaymentProviderResponse struct {
-	Status  bool            `json:"status"`
-	Message string          `json:"message"`
-	Data    json.RawMessage `json:"data"`
-}
-
-// PaystackResponse ...
-type PaystackResponse struct {
-	Status  bool        `json:"status"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
 }
 
 type UserDetails struct {
@@ -118,34 +324,20 @@ type UserDetails struct {
 	Name     string `json:"name"`
 }
 
-// FlutterwaveResponse ...
-type FlutterwaveResponse struct {
-	Status  string      `json:"status"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
-}
-
 // GetProvider ...
 func GetProvider(id PayProvider) PayEntity {
 	return paymentProviders[id]
 }
 
-// GetURL ...
-func (p *PayEntity) GetURL(txRef string) (url string, err error) {
-
-	if p.Value == ProviderPaystack {
-		url = fmt.Sprintf("%s/%s", p.URL, txRef)
-	}
-
-	if p.Value == ProviderFlutterwave {
-		url = fmt.Sprintf("%s/%s/verify", p.URL, txRef)
-	}
-
-	if url == "" {
-		return url, errors.New("empty url")
+// GetProviderByName ...
+func GetProviderByName(name string) (PayEntity, bool) {
+	for _, p := range paymentProviders {
+		if p.Name == name {
+			return p, true
+		}
 	}
 
-	return
+	return PayEntity{}, false
 }
 
 func GetSession(usr int) string {
@@ -179,6 +179,15 @@ type GatePassList struct {
 	ResidentType int             `json:"resident_type"`
 	ResidencyID  string          `json:"residency_id"`
 	PlateNumber  string          `json:"plate_number"`
+	Type         int             `json:"type"`
+	MaxUses      int             `json:"max_uses"`
+	Uses         int             `json:"uses"`
+	DateCheckin  utils.DateTime  `json:"date_checkin"`
+	DateCheckout utils.DateTime  `json:"date_checkout"`
+	ValidFrom    utils.DateTime  `json:"valid_from"`
+	ValidUntil   utils.DateTime  `json:"valid_until"`
+	Schedule     json.RawMessage `json:"schedule"`
+	DateRevoked  utils.DateTime  `json:"date_revoked"`
 }
 
 // ActiveNotice ...
@@ -220,6 +229,12 @@ type VisitorList struct {
 	Resident         string          `json:"resident"`
 	Security         string          `json:"security"`
 	Attr             json.RawMessage `json:"attr"`
+	ExpectedFrom     utils.DateTime  `json:"expected_from"`
+	ExpectedUntil    utils.DateTime  `json:"expected_until"`
+	DateCheckin      utils.DateTime  `json:"date_checkin"`
+	DateCheckout     utils.DateTime  `json:"date_checkout"`
+	CheckoutBy       string          `json:"checkout_by"`
+	DateDenied       utils.DateTime  `json:"date_denied"`
 }
 
 // ResidentList ...
@@ -267,6 +282,9 @@ type SecurityResidentList struct {
 	Unit   string `json:"unit"`
 	Type   int    `json:"type"`
 	InDebt bool   `json:"in_debt" sql:"-"`
+	OnPlan bool   `json:"on_plan" sql:"-"`
+	// flagged by the dunning policy of the site
+	Flagged bool `json:"flagged" sql:"-"`
 }
 
 // InvoiceMasterList ...
@@ -292,6 +310,7 @@ type InvoiceList struct {
 	LastName      string          `json:"last_name"`
 	Address       string          `json:"address"`
 	InvoiceNumber int64           `json:"invoice_number"`
+	InvoiceNo     string          `json:"invoice_no"`
 	Month         int             `json:"month"`
 	Year          int             `json:"year"`
 	DateCreated   utils.DateTime  `json:"date_created"`
@@ -320,6 +339,7 @@ type PaymentList struct {
 	PayMode       int             `json:"pay_mode"`
 	Attr          json.RawMessage `json:"attr"`
 	ReferenceID   string          `json:"reference_id"`
+	Status        int             `json:"status"`
 }
 
 // ResidentDue is not a view, used as a mount point to query for data
@@ -508,3 +528,206 @@ type ReportingInvoice struct {
 	Amount        decimal.Decimal `json:"amount"`
 	Dues          json.RawMessage `json:"dues"`
 }
+
+// CreditNoteList ...
+type CreditNoteList struct {
+	ID            string          `json:"id"`
+	SiteID        string          `json:"site_id"`
+	ResidentID    string          `json:"resident_id"`
+	Resident      string          `json:"resident"`
+	InvoiceID     string          `json:"invoice_id"`
+	InvoiceNumber string          `json:"invoice_number"`
+	Reference     string          `json:"reference"`
+	Type          int             `json:"type"`
+	Status        int             `json:"status"`
+	Percentage    decimal.Decimal `json:"percentage"`
+	Amount        decimal.Decimal `json:"amount"`
+	Dues          json.RawMessage `json:"dues"`
+	Reason        string          `json:"reason"`
+	RequestedBy   json.RawMessage `json:"requested_by"`
+	ApprovedBy    json.RawMessage `json:"approved_by"`
+	DateCreated   utils.DateTime  `json:"date_created"`
+	DateApproved  utils.DateTime  `json:"date_approved"`
+}
+
+// DunningHistoryList ...
+type DunningHistoryList struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	ResidentID  string          `json:"resident_id"`
+	Resident    string          `json:"resident"`
+	PolicyID    string          `json:"policy_id"`
+	Stage       int             `json:"stage"`
+	StageName   string          `json:"stage_name"`
+	DaysOverdue int             `json:"days_overdue"`
+	Balance     decimal.Decimal `json:"balance"`
+	Email       bool            `json:"email"`
+	Push        bool            `json:"push"`
+	Actions     json.RawMessage `json:"actions"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// PaymentReversalList ...
+type PaymentReversalList struct {
+	ID              string          `json:"id"`
+	SiteID          string          `json:"site_id"`
+	PaymentID       string          `json:"payment_id"`
+	ResidentID      string          `json:"resident_id"`
+	Resident        string          `json:"resident"`
+	Reference       string          `json:"reference"`
+	Amount          decimal.Decimal `json:"amount"`
+	Reason          string          `json:"reason"`
+	Status          int             `json:"status"`
+	RefundStatus    int             `json:"refund_status"`
+	RefundReference string          `json:"refund_reference"`
+	RequestedBy     json.RawMessage `json:"requested_by"`
+	ApprovedBy      json.RawMessage `json:"approved_by"`
+	DateCreated     utils.DateTime  `json:"date_created"`
+	DateApproved    utils.DateTime  `json:"date_approved"`
+	DateTrx         utils.DateTime  `json:"date_trx"`
+	PayMode         int             `json:"pay_mode"`
+	ReferenceID     string          `json:"reference_id"`
+}
+
+// WalletList ...
+type WalletList struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	ResidentID  string          `json:"resident_id"`
+	Resident    string          `json:"resident"`
+	Balance     decimal.Decimal `json:"balance"`
+	AutoApply   bool            `json:"auto_apply"`
+	DateCreated utils.DateTime  `json:"date_created"`
+}
+
+// PaymentPlanList ...
+type PaymentPlanList struct {
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id"`
+	ResidentID   string          `json:"resident_id"`
+	Resident     string          `json:"resident"`
+	Arrears      decimal.Decimal `json:"arrears"`
+	Installments int             `json:"installments"`
+	Frequency    int             `json:"frequency"`
+	StartDate    utils.DateTime  `json:"start_date"`
+	Status       int             `json:"status"`
+	Note         string          `json:"note"`
+	Paid         decimal.Decimal `json:"paid"`
+	Outstanding  decimal.Decimal `json:"outstanding"`
+	Missed       int             `json:"missed"`
+	NextDueDate  utils.DateTime  `json:"next_due_date"`
+	NextAmount   decimal.Decimal `json:"next_amount"`
+	DateCreated  utils.DateTime  `json:"date_created"`
+}
+
+// LedgerList is a journal line with its account and journal, Balance is the running
+// balance of the account
+type LedgerList struct {
+	ID          string          `json:"id"`
+	SiteID      string          `json:"site_id"`
+	JournalID   string          `json:"journal_id"`
+	AccountID   string          `json:"account_id"`
+	AccountCode string          `json:"account_code"`
+	Account     string          `json:"account"`
+	AccountType int             `json:"account_type"`
+	ResidentID  string          `json:"resident_id"`
+	Resident    string          `json:"resident"`
+	DateTrx     utils.DateTime  `json:"date_trx"`
+	SourceType  int             `json:"source_type"`
+	SourceID    string          `json:"source_id"`
+	Narration   string          `json:"narration"`
+	Debit       decimal.Decimal `json:"debit"`
+	Credit      decimal.Decimal `json:"credit"`
+	Balance     decimal.Decimal `json:"balance"`
+}
+
+// TrialBalance ...
+type TrialBalance struct {
+	ID      string          `json:"id"`
+	SiteID  string          `json:"site_id"`
+	Code    string          `json:"code"`
+	Name    string          `json:"name"`
+	Type    int             `json:"type"`
+	Kind    int             `json:"kind"`
+	Debit   decimal.Decimal `json:"debit"`
+	Credit  decimal.Decimal `json:"credit"`
+	Balance decimal.Decimal `json:"balance"`
+}
+
+// ExpenseList ...
+type ExpenseList struct {
+	ID           string          `json:"id"`
+	SiteID       string          `json:"site_id"`
+	CategoryID   string          `json:"category_id"`
+	Category     string          `json:"category"`
+	VendorID     string          `json:"vendor_id"`
+	Vendor       string          `json:"vendor"`
+	DueID        string          `json:"due_id"`
+	Due          string          `json:"due"`
+	DateTrx      utils.DateTime  `json:"date_trx"`
+	Amount       decimal.Decimal `json:"amount"`
+	Description  string          `json:"description"`
+	Reference    string          `json:"reference"`
+	PayMode      int             `json:"pay_mode"`
+	Receipts     json.RawMessage `json:"receipts"`
+	Status       int             `json:"status"`
+	RequestedBy  json.RawMessage `json:"requested_by"`
+	ApprovedBy   json.RawMessage `json:"approved_by"`
+	DateApproved utils.DateTime  `json:"date_approved"`
+	DateCreated  utils.DateTime  `json:"date_created"`
+}
+
+// BudgetVsActual compares the budget of a due with what was invoiced, collected and spent
+type BudgetVsActual struct {
+	ID        string          `json:"id"`
+	SiteID    string          `json:"site_id"`
+	Year      int             `json:"year"`
+	DueID     string          `json:"due_id"`
+	Due       string          `json:"due"`
+	Budget    decimal.Decimal `json:"budget"`
+	Invoiced  decimal.Decimal `json:"invoiced"`
+	Collected decimal.Decimal `json:"collected"`
+	Spent     decimal.Decimal `json:"spent"`
+	Variance  decimal.Decimal `json:"variance"`
+	Surplus   decimal.Decimal `json:"surplus"`
+}
+
+// BankStatementLineList ...
+type BankStatementLineList struct {
+	ID               string          `json:"id"`
+	SiteID           string          `json:"site_id"`
+	StatementID      string          `json:"statement_id"`
+	DateTrx          utils.DateTime  `json:"date_trx"`
+	Amount           decimal.Decimal `json:"amount"`
+	Narration        string          `json:"narration"`
+	Reference        string          `json:"reference"`
+	Status           int             `json:"status"`
+	MatchType        int             `json:"match_type"`
+	PendingID        string          `json:"pending_id"`
+	ResidentID       string          `json:"resident_id"`
+	Score            int             `json:"score"`
+	PaymentID        string          `json:"payment_id"`
+	ReconciledBy     json.RawMessage `json:"reconciled_by"`
+	DateReconciled   utils.DateTime  `json:"date_reconciled"`
+	Resident         string          `json:"resident"`
+	PendingNarration string          `json:"pending_narration"`
+	PendingAmount    decimal.Decimal `json:"pending_amount"`
+	PendingDate      utils.DateTime  `json:"pending_date"`
+}
+
+// VehicleList ...
+type VehicleList struct {
+	ID            string         `json:"id"`
+	SiteID        string         `json:"site_id"`
+	ResidencyID   string         `json:"residency_id"`
+	ResidentID    string         `json:"resident_id"`
+	PlateNumber   string         `json:"plate_number"`
+	Make          string         `json:"make"`
+	Colour        string         `json:"colour"`
+	StickerNumber string         `json:"sticker_number"`
+	Active        bool           `json:"active"`
+	DateCreated   utils.DateTime `json:"date_created"`
+	Unit          string         `json:"unit"`
+	Street        string         `json:"street"`
+	Resident      string         `json:"resident"`
+}
@@ -0,0 +1,394 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"eve/service/model"
+	"eve/utils"
+	"fmt"
+	"time"
+
+	"github.com/CloudyKit/jet/v3"
+	"github.com/go-pg/pg"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+)
+
+const defaultDunningTemplate = "dunning_notice.jet.html"
+
+// dunningDebtor is a resident with an overdue balance
+type dunningDebtor struct {
+	ResidentID  string
+	Balance     decimal.Decimal
+	DaysOverdue int
+}
+
+// DunningMonitor runs the dunning policy of each site once a day at the policies hour,
+// errors are logged and retried on the next run
+func DunningMonitor() {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	for {
+		policies := []model.DunningPolicy{}
+		err := dbc.Model(&policies).
+			Where("active and run_hour <= ?", time.Now().Hour()).
+			Where("date_last_run is null or date_last_run::date < current_date").
+			Select()
+		if err != nil && err != pg.ErrNoRows {
+			log.Error(err)
+		}
+
+		for _, p := range policies {
+			if _, err := RunDunningPolicy(p.ID); err != nil {
+				log.Error(err)
+			}
+		}
+
+		time.Sleep(15 * time.Minute)
+	}
+}
+
+// RunDunningPolicy moves the debtors of a site to the stage their oldest unpaid invoice
+// has reached and settles residents that no longer owe. It returns the number of
+// residents that were sent a reminder
+func RunDunningPolicy(policyID string) (int, error) {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	policy := model.DunningPolicy{}
+	if err := dbc.Model(&policy).Where("id = ?", policyID).Select(); err != nil {
+		log.Debug(err)
+		return 0, err
+	}
+
+	stages := []model.DunningStage{}
+	if err := json.Unmarshal(policy.Stages, &stages); err != nil {
+		log.Debug(err)
+		return 0, err
+	}
+
+	// residents keeping up with an active payment plan are not chased
+	debtors := []dunningDebtor{}
+	_, err := dbc.Query(&debtors, `
+		select
+			b.id as resident_id, b.balance, current_date - min(u.date_created)::date as days_overdue
+		from
+			resident_billing_summary as b
+		join (
+			select
+				t.resident_id, i.date_created
+			from
+				transaction as t
+			join invoice as i
+				on i.id = t.invoice_id
+			group by
+				t.resident_id, t.invoice_id, i.date_created
+			having
+				sum(t.amount) < 0
+		) as u
+			on u.resident_id = b.id
+		where
+			b.site_id = ?0 and b.balance < ?1 * -1 and b.balance < 0 and
+			not exists (
+				select 1 from payment_plan_list as pl
+				where pl.resident_id = b.id and pl.status = ?2 and pl.missed = 0
+			)
+		group by
+			b.id, b.balance
+	`, policy.SiteID, policy.MinBalance, model.PlanActive)
+	if err != nil {
+		log.Debug(err)
+		return 0, err
+	}
+
+	sent := 0
+	owing := map[string]bool{}
+	for _, d := range debtors {
+		owing[d.ResidentID] = true
+
+		notified := false
+		err := utils.Transact(dbc, log, func(tx *pg.Tx) (err error) {
+			notified, err = dunResident(tx, &policy, stages, d)
+			return
+		})
+		if err != nil {
+			log.Debug(err)
+			continue
+		}
+		if notified {
+			sent++
+		}
+	}
+
+	current := []model.ResidentDunning{}
+	if err := dbc.Model(&current).Where("site_id = ?", policy.SiteID).Select(); err != nil {
+		log.Debug(err)
+		return sent, err
+	}
+
+	for i := range current {
+		if owing[current[i].ResidentID] {
+			continue
+		}
+
+		err := utils.Transact(dbc, log, func(tx *pg.Tx) error {
+			return settleDunning(tx, &current[i])
+		})
+		if err != nil {
+			log.Debug(err)
+		}
+	}
+
+	_, err = dbc.Model(&policy).
+		Set("date_last_run = ?", utils.DateTime{}.Now()).
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return sent, err
+	}
+
+	return sent, nil
+}
+
+// dunResident notifies a debtor when they reach a new stage. Only the latest stage
+// reached is sent, actions of the earlier stages stay in force
+func dunResident(tx *pg.Tx, policy *model.DunningPolicy, stages []model.DunningStage, debtor dunningDebtor) (bool, error) {
+	log := utils.Env.Log
+
+	state := &model.ResidentDunning{}
+	err := tx.Model(state).
+		Where("resident_id = ?", debtor.ResidentID).
+		For("update").
+		Select()
+	if err != nil && err != pg.ErrNoRows {
+		log.Debug(err)
+		return false, err
+	}
+	isNew := err == pg.ErrNoRows
+
+	reached := 0
+	for i, s := range stages {
+		if debtor.DaysOverdue >= s.Days {
+			reached = i + 1
+		}
+	}
+
+	state.DaysOverdue = debtor.DaysOverdue
+	state.Balance = debtor.Balance
+	state.DateUpdated = utils.DateTime{}.Now()
+
+	notify := reached > state.Stage
+	if notify {
+		state.Stage = reached
+		state.StageName = stages[reached-1].Name
+		for _, s := range stages[:reached] {
+			state.RestrictGatePass = state.RestrictGatePass || s.RestrictGatePass
+			state.FlagAtGate = state.FlagAtGate || s.FlagAtGate
+		}
+	}
+
+	if isNew {
+		if reached == 0 {
+			return false, nil
+		}
+
+		state.ResidentID = debtor.ResidentID
+		state.SiteID = policy.SiteID
+		state.PolicyID = policy.ID
+		state.DateStarted = utils.DateTime{}.Now()
+		if _, err := tx.Model(state).Insert(); err != nil {
+			log.Debug(err)
+			return false, err
+		}
+	} else {
+		_, err := tx.Model(state).
+			Column("stage", "stage_name", "days_overdue", "balance", "restrict_gate_pass", "flag_at_gate", "date_updated").
+			WherePK().
+			Update()
+		if err != nil {
+			log.Debug(err)
+			return false, err
+		}
+	}
+
+	if !notify {
+		return false, nil
+	}
+
+	stage := stages[reached-1]
+	history := &model.DunningHistory{
+		ID:          xid.New().String(),
+		SiteID:      policy.SiteID,
+		ResidentID:  debtor.ResidentID,
+		PolicyID:    policy.ID,
+		Stage:       reached,
+		StageName:   stage.Name,
+		DaysOverdue: debtor.DaysOverdue,
+		Balance:     debtor.Balance,
+		DateCreated: utils.DateTime{}.Now(),
+	}
+
+	actions := []string{}
+	if stage.RestrictGatePass {
+		actions = append(actions, "restrict_gate_pass")
+	}
+	if stage.FlagAtGate {
+		actions = append(actions, "flag_at_gate")
+	}
+	if history.Actions, err = json.Marshal(actions); err != nil {
+		return false, err
+	}
+
+	if history.Email, history.Push, err = sendDunningNotice(tx, policy, stage, debtor); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Model(history).Insert(); err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// settleDunning lifts the actions of a resident that no longer owes
+func settleDunning(tx *pg.Tx, state *model.ResidentDunning) error {
+	log := utils.Env.Log
+
+	if _, err := tx.Model(state).WherePK().Delete(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	history := &model.DunningHistory{
+		ID:          xid.New().String(),
+		SiteID:      state.SiteID,
+		ResidentID:  state.ResidentID,
+		PolicyID:    state.PolicyID,
+		StageName:   "Account settled",
+		Actions:     json.RawMessage("[]"),
+		DateCreated: utils.DateTime{}.Now(),
+	}
+	if _, err := tx.Model(history).Insert(); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return nil
+}
+
+// sendDunningNotice queues the email and push notification of a stage
+func sendDunningNotice(tx *pg.Tx, policy *model.DunningPolicy, stage model.DunningStage, debtor dunningDebtor) (email, push bool, err error) {
+	log := utils.Env.Log
+
+	resident := struct {
+		FirstName string
+		LastName  string
+		Email     string
+		PushToken string
+	}{}
+	_, err = tx.QueryOne(&resident, `
+		select first_name, last_name, email, push_token from resident where id = ?
+	`, debtor.ResidentID)
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+
+	site := model.Site{}
+	if _, err = tx.QueryOne(&site, "select * from site where id=?", policy.SiteID); err != nil {
+		log.Debug(err)
+		return
+	}
+
+	subject := stage.Subject
+	if len(subject) == 0 {
+		subject = fmt.Sprintf("%s: %s", site.Name, stage.Name)
+	}
+
+	if stage.Email && len(resident.Email) > 0 {
+		eml, err := MakeDunningNotice(stage, site.Name, fmt.Sprintf("%s %s", resident.FirstName, resident.LastName), debtor)
+		if err != nil {
+			return false, false, err
+		}
+		eml.To = resident.Email
+		eml.Subject = subject
+
+		_, err = tx.Exec(`
+		insert into task_queue (site_id, type, data)
+			values(?, 1, ?)
+		`, policy.SiteID, &eml)
+		if err != nil {
+			log.Debug(err)
+			return false, false, err
+		}
+		email = true
+	}
+
+	if stage.Push && len(resident.PushToken) > 0 {
+		body := stage.Message
+		if len(body) == 0 {
+			body = fmt.Sprintf("Your account is %d days overdue, %s is outstanding", debtor.DaysOverdue, debtor.Balance.Neg().StringFixed(2))
+		}
+
+		task := PushTask{
+			To:    resident.PushToken,
+			Title: subject,
+			Body:  body,
+			Data:  map[string]string{"type": "dunning", "resident_id": debtor.ResidentID},
+		}
+		_, err = tx.Exec(`
+		insert into task_queue (site_id, type, data)
+			values(?, 2, ?)
+		`, policy.SiteID, &task)
+		if err != nil {
+			log.Debug(err)
+			return
+		}
+		push = true
+	}
+
+	return email, push, nil
+}
+
+// MakeDunningNotice ...
+func MakeDunningNotice(stage model.DunningStage, association, name string, debtor dunningDebtor) (*EMailMsg, error) {
+	log := utils.Env.Log
+
+	templates.SetDevelopmentMode(true)
+	templates.AddGlobalFunc("fmtMoney", fmtMoney)
+
+	tmpl := stage.Template
+	if len(tmpl) == 0 {
+		tmpl = defaultDunningTemplate
+	}
+
+	t, err := templates.GetTemplate(tmpl)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	vars := make(jet.VarMap)
+	vars.Set("name", name)
+	vars.Set("stage", stage)
+	vars.Set("daysOverdue", debtor.DaysOverdue)
+	vars.Set("outstanding", debtor.Balance.Neg())
+	vars.Set("association", association)
+
+	var w bytes.Buffer
+	if err = t.Execute(&w, vars, nil); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	eml, err := HTMLToEMail(w.Bytes())
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return eml, nil
+}
@@ -2,6 +2,7 @@ package shared
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"eve/service/model"
 	"eve/service/view"
@@ -29,10 +30,32 @@ var moneyFormat = accounting.Accounting{Symbol: "₦ ", Precision: 2}
 
 // EMailMsg ...
 type EMailMsg struct {
-	To      string `json:"to,omitempty"`
-	Subject string `json:"subject,omitempty"`
-	HTML    string `json:"html,omitempty"`
-	Text    string `json:"text,omitempty"`
+	To          string       `json:"to,omitempty"`
+	Subject     string       `json:"subject,omitempty"`
+	HTML        string       `json:"html,omitempty"`
+	Text        string       `json:"text,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file sent with an email, Data is base64 encoded
+type Attachment struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+// AttachPDF converts the rendered html to pdf and attaches it to the email
+func (s *EMailMsg) AttachPDF(name string, html []byte) error {
+	pdf, err := HTMLToPDF(html)
+	if err != nil {
+		return err
+	}
+
+	s.Attachments = append(s.Attachments, Attachment{
+		Name: name,
+		Data: base64.StdEncoding.EncodeToString(pdf),
+	})
+
+	return nil
 }
 
 func fmtMoney(args jet.Arguments) reflect.Value {
@@ -77,31 +100,81 @@ type invDetail struct {
 
 // MakeInvoice ...
 func MakeInvoice(tx *pg.Tx, invID string) (*EMailMsg, error) {
+	log := utils.Env.Log
+
+	vars, record, site, err := invoiceVars(tx, invID)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := execTemplate("invoice.jet.html", vars)
+	if err != nil {
+		return nil, err
+	}
+
+	eml, err := HTMLToEMail(w)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	eml.Subject = fmt.Sprintf("%s %s Invoice", site.Name, record.DateCreated.Format("January 2 2006"))
+
+	// attach a printable copy
+	w, err = execTemplate("invoice.pdf.jet.html", vars)
+	if err != nil {
+		return nil, err
+	}
+	if err := eml.AttachPDF(fmt.Sprintf("invoice-%s.pdf", invoiceNo(record)), w); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return eml, nil
+}
+
+// MakeInvoicePDF ...
+func MakeInvoicePDF(tx *pg.Tx, invID string) ([]byte, error) {
+	vars, _, _, err := invoiceVars(tx, invID)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := execTemplate("invoice.pdf.jet.html", vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return HTMLToPDF(w)
+}
+
+// invoiceVars loads the invoice template variables
+func invoiceVars(tx *pg.Tx, invID string) (jet.VarMap, *view.InvoiceList, *model.Site, error) {
 	dbc := tx
 	log := utils.Env.Log
 	// decimal.DivisionPrecision = 2
 
 	// get invoice record
-	record := view.InvoiceList{}
-	_, err := dbc.QueryOne(&record, "select * from invoice_list where id=?", invID)
+	record := &view.InvoiceList{}
+	_, err := dbc.QueryOne(record, "select * from invoice_list where id=?", invID)
 	if err != nil {
 		log.Debug(err)
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	// get site record
-	site := model.Site{}
-	_, err = dbc.QueryOne(&site, "select * from site where id=?", record.SiteID)
+	site := &model.Site{}
+	_, err = dbc.QueryOne(site, "select * from site where id=?", record.SiteID)
 	if err != nil {
 		log.Debug(err)
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	// unmarshal records.Dues to invDetail{}
 	details := []invDetail{}
 	if err := json.Unmarshal(record.Dues, &details); err != nil {
 		log.Debug(err)
-		return nil, err
+		return nil, nil, nil, err
 	}
 	// divide amount by 12
 	twv, _ := decimal.NewFromString("12.00")
@@ -109,36 +182,24 @@ func MakeInvoice(tx *pg.Tx, invID string) (*EMailMsg, error) {
 		details[i].Amount = details[i].Amount.DivRound(twv, 2)
 	}
 
-	templates.SetDevelopmentMode(true)
-	templates.AddGlobalFunc("fmtMoney", fmtMoney)
-
-	t, err := templates.GetTemplate("invoice.jet.html")
-	if err != nil {
-		log.Debug(err)
-		return nil, err
-	}
 	vars := make(jet.VarMap)
 	vars.Set("invoice", record)
 	vars.Set("invDate", record.DateCreated.Format("January 2 2006"))
-	vars.Set("invNumber", fmt.Sprintf("%04d", record.InvoiceNumber))
+	vars.Set("invNumber", invoiceNo(record))
 	vars.Set("invDetails", details)
 	vars.Set("association", site.Name)
 
-	var w bytes.Buffer
-	if err = t.Execute(&w, vars, nil); err != nil {
-		log.Debug(err)
-		return nil, err
-	}
+	return vars, record, site, nil
+}
 
-	eml, err := HTMLToEMail(w.Bytes())
-	if err != nil {
-		log.Debug(err)
-		return nil, err
+// invoiceNo is the site series number, invoices from before the series keep their global
+// number padded to 8 digits as they were migrated
+func invoiceNo(record *view.InvoiceList) string {
+	if len(record.InvoiceNo) > 0 {
+		return record.InvoiceNo
 	}
 
-	eml.Subject = fmt.Sprintf("%s %s Invoice", site.Name, record.DateCreated.Format("January 2 2006"))
-
-	return eml, nil
+	return fmt.Sprintf("%08d", record.InvoiceNumber)
 }
 
 type payDetail struct {
@@ -148,73 +209,120 @@ type payDetail struct {
 
 // MakeReceipt ...
 func MakeReceipt(tx *pg.Tx, payID string) (*EMailMsg, error) {
-	dbc := tx
 	log := utils.Env.Log
-	// decimal.DivisionPrecision = 2
 
-	// get payment record
-	record := view.PaymentList{}
-	_, err := dbc.QueryOne(&record, "select * from payment_list where id=?", payID)
+	vars, record, site, err := receiptVars(tx, payID)
+	if err != nil {
+		return nil, err
+	}
 
+	// get resident record
+	resident := new(model.Resident)
+	_, err = tx.QueryOne(resident, "select email from resident where id=?", record.ResidentID)
 	if err != nil {
 		log.Debug(err)
 		return nil, err
 	}
 
-	// get site record
-	site := model.Site{}
-	_, err = dbc.QueryOne(&site, "select * from site where id=?", record.SiteID)
+	w, err := execTemplate("receipt.jet.html", vars)
 	if err != nil {
-		log.Debug(err)
 		return nil, err
 	}
 
-	// get resident record
-	resident := new(model.Resident)
-	_, err = dbc.QueryOne(resident, "select email from resident where id=?", record.ResidentID)
+	eml, err := HTMLToEMail(w)
 	if err != nil {
 		log.Debug(err)
 		return nil, err
 	}
 
-	// unmarshal records.Dues to payDetail{}
-	details := []payDetail{}
-	if err := json.Unmarshal(record.Dues, &details); err != nil {
+	eml.Subject = fmt.Sprintf("%s Receipt", site.Name)
+	eml.To = resident.Email
+
+	// attach a printable copy
+	w, err = execTemplate("receipt.pdf.jet.html", vars)
+	if err != nil {
+		return nil, err
+	}
+	if err := eml.AttachPDF(fmt.Sprintf("receipt-%s.pdf", record.DateTrx.Format("2006-01-02")), w); err != nil {
 		log.Debug(err)
 		return nil, err
 	}
 
-	templates.SetDevelopmentMode(true)
-	templates.AddGlobalFunc("fmtMoney", fmtMoney)
+	return eml, nil
+}
 
-	t, err := templates.GetTemplate("receipt.jet.html")
+// MakeReceiptPDF ...
+func MakeReceiptPDF(tx *pg.Tx, payID string) ([]byte, error) {
+	vars, _, _, err := receiptVars(tx, payID)
 	if err != nil {
-		log.Debug(err)
 		return nil, err
 	}
 
+	w, err := execTemplate("receipt.pdf.jet.html", vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return HTMLToPDF(w)
+}
+
+// receiptVars loads the receipt template variables
+func receiptVars(tx *pg.Tx, payID string) (jet.VarMap, *view.PaymentList, *model.Site, error) {
+	dbc := tx
+	log := utils.Env.Log
+
+	// get payment record
+	record := &view.PaymentList{}
+	_, err := dbc.QueryOne(record, "select * from payment_list where id=?", payID)
+	if err != nil {
+		log.Debug(err)
+		return nil, nil, nil, err
+	}
+
+	// get site record
+	site := &model.Site{}
+	_, err = dbc.QueryOne(site, "select * from site where id=?", record.SiteID)
+	if err != nil {
+		log.Debug(err)
+		return nil, nil, nil, err
+	}
+
+	// unmarshal records.Dues to payDetail{}
+	details := []payDetail{}
+	if err := json.Unmarshal(record.Dues, &details); err != nil {
+		log.Debug(err)
+		return nil, nil, nil, err
+	}
+
 	vars := make(jet.VarMap)
 	vars.Set("payment", record)
 	vars.Set("payDate", record.DateTrx.Format("January 2 2006"))
 	vars.Set("payDetails", details)
 	vars.Set("association", site.Name)
 
-	var w bytes.Buffer
-	if err = t.Execute(&w, vars, nil); err != nil {
+	return vars, record, site, nil
+}
+
+// execTemplate renders a template from the templates folder
+func execTemplate(name string, vars jet.VarMap) ([]byte, error) {
+	log := utils.Env.Log
+
+	templates.SetDevelopmentMode(true)
+	templates.AddGlobalFunc("fmtMoney", fmtMoney)
+
+	t, err := templates.GetTemplate(name)
+	if err != nil {
 		log.Debug(err)
 		return nil, err
 	}
 
-	eml, err := HTMLToEMail(w.Bytes())
-	if err != nil {
+	var w bytes.Buffer
+	if err = t.Execute(&w, vars, nil); err != nil {
 		log.Debug(err)
 		return nil, err
 	}
 
-	eml.Subject = fmt.Sprintf("%s Receipt", site.Name)
-	eml.To = resident.Email
-
-	return eml, nil
+	return w.Bytes(), nil
 }
 
 // MakeRegConfirmation ...
@@ -0,0 +1,259 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/CloudyKit/jet/v3"
+	"github.com/go-pg/pg"
+	"github.com/rs/xid"
+)
+
+const alertEscalationTemplate = "alert_escalation.jet.html"
+
+// pendingAlert is an alert security has not acknowledged, Age is in seconds
+type pendingAlert struct {
+	model.ResidentAlerts
+	Age int
+}
+
+// AlertEscalationMonitor escalates unacknowledged alerts every 10 seconds, errors are
+// logged and retried on the next run
+func AlertEscalationMonitor() {
+	log := utils.Env.Log
+
+	for {
+		if err := EscalateAlerts(); err != nil {
+			log.Error(err)
+		}
+
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// EscalateAlerts moves the unacknowledged alerts of every site with an active policy to
+// the tiers they have reached
+func EscalateAlerts() error {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	policies := []model.AlertEscalationPolicy{}
+	if err := dbc.Model(&policies).Where("active").Select(); err != nil && err != pg.ErrNoRows {
+		log.Debug(err)
+		return err
+	}
+
+	for _, p := range policies {
+		tiers := []model.AlertEscalationTier{}
+		if err := json.Unmarshal(p.Tiers, &tiers); err != nil || len(tiers) == 0 {
+			continue
+		}
+
+		alerts := []pendingAlert{}
+		_, err := dbc.Query(&alerts, `
+			select *, extract(epoch from localtimestamp - time_logged)::int as age
+			from resident_alerts
+			where site_id = ? and status = ? and escalation_level < ?
+		`, p.SiteID, model.AlertSent, len(tiers))
+		if err != nil {
+			// the other sites are still escalated
+			log.Error(err)
+			continue
+		}
+
+		for _, a := range alerts {
+			reached := 0
+			for i, t := range tiers {
+				if a.Age >= t.AfterSeconds {
+					reached = i + 1
+				}
+			}
+			if reached <= a.EscalationLevel {
+				continue
+			}
+
+			err := utils.Transact(dbc, log, func(tx *pg.Tx) error {
+				return escalateAlert(tx, a.ID, tiers, reached)
+			})
+			if err != nil {
+				log.Debug(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// escalateAlert notifies every tier the alert reached since it was last escalated, a
+// guard acknowledging it in the meantime stops the escalation
+func escalateAlert(tx *pg.Tx, alertID string, tiers []model.AlertEscalationTier, reached int) error {
+	log := utils.Env.Log
+
+	alert := &model.ResidentAlerts{}
+	err := tx.Model(alert).
+		Where("id = ? and status = ? and escalation_level < ?", alertID, model.AlertSent, reached).
+		For("update skip locked").
+		Select()
+	if err == pg.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	site := model.Site{}
+	if _, err := tx.QueryOne(&site, "select * from site where id=?", alert.SiteID); err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	for level := alert.EscalationLevel + 1; level <= reached; level++ {
+		tier := tiers[level-1]
+
+		notified, err := notifyTier(tx, &site, alert, tier)
+		if err != nil {
+			return err
+		}
+
+		escalation := &model.AlertEscalation{
+			ID:          xid.New().String(),
+			SiteID:      alert.SiteID,
+			AlertID:     alert.ID,
+			Level:       level,
+			Target:      tier.Target,
+			Notified:    notified,
+			DateCreated: utils.DateTime{}.Now(),
+		}
+		if _, err := tx.Model(escalation).Insert(); err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	alert.EscalationLevel = reached
+	alert.TimeEscalated = utils.DateTime{}.Now()
+	_, err = tx.Model(alert).
+		Column("escalation_level", "time_escalated").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	return nil
+}
+
+// notifyTier returns the number of push notifications and emails queued. Tiers reach every
+// user they target, guards off shift included: only the first dispatch of an alert follows
+// the shift routing of the site
+func notifyTier(tx *pg.Tx, site *model.Site, alert *model.ResidentAlerts, tier model.AlertEscalationTier) (int, error) {
+	log := utils.Env.Log
+
+	userType := publishEscalation(alert, tier)
+
+	waited := (time.Duration(tier.AfterSeconds) * time.Second).String()
+	title := "Unanswered emergency alert"
+	body := fmt.Sprintf("%s (%s) raised a %s alert %s ago that security has not acknowledged", alert.Name, alert.Address, alert.Category, waited)
+	data := map[string]string{"type": "alert_escalated", "alert_id": alert.ID}
+	notified := 0
+
+	if tier.Push {
+		var sent int
+		var err error
+		if userType == model.SecurityUser {
+			sent, err = QueueSecurityPush(tx, alert.SiteID, title, body, data)
+		} else {
+			sent, err = QueueRolePush(tx, alert.SiteID, userType, title, body, data)
+		}
+		if err != nil {
+			return 0, err
+		}
+		notified += sent
+	}
+
+	if tier.Email {
+		emails := []string{}
+		err := tx.Model((*model.User)(nil)).
+			Column("email").
+			Where("site_id = ? and type = ? and status = ? and email <> ''", alert.SiteID, userType, model.IsEnabled).
+			Select(&emails)
+		if err != nil {
+			log.Debug(err)
+			return 0, err
+		}
+
+		for _, to := range emails {
+			eml, err := MakeAlertEscalation(alert, site.Name, waited)
+			if err != nil {
+				return 0, err
+			}
+			eml.To = to
+			eml.Subject = fmt.Sprintf("%s: unanswered emergency alert", site.Name)
+
+			_, err = tx.Exec(`
+			insert into task_queue (site_id, type, data)
+				values(?, 1, ?)
+			`, alert.SiteID, &eml)
+			if err != nil {
+				log.Debug(err)
+				return 0, err
+			}
+			notified++
+		}
+	}
+
+	return notified, nil
+}
+
+// publishEscalation sends the escalated alert to every connected user the tier targets and
+// returns their user type
+func publishEscalation(alert *model.ResidentAlerts, tier model.AlertEscalationTier) int {
+	userType := model.SecurityUser
+	if tier.Target == model.EscalateOfficials {
+		userType = model.OfficialUser
+	}
+
+	Publish(alert.SiteID, "alert.escalated", alert, RoleChannel(userType))
+
+	return userType
+}
+
+// MakeAlertEscalation ...
+func MakeAlertEscalation(alert *model.ResidentAlerts, association, waited string) (*EMailMsg, error) {
+	log := utils.Env.Log
+
+	templates.SetDevelopmentMode(true)
+
+	t, err := templates.GetTemplate(alertEscalationTemplate)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	vars := make(jet.VarMap)
+	vars.Set("alert", alert)
+	vars.Set("waited", waited)
+	vars.Set("raisedAt", alert.TimeLogged.Format(utils.FormatYYYYMMDDHHmmSS))
+	vars.Set("association", association)
+
+	var w bytes.Buffer
+	if err = t.Execute(&w, vars, nil); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	eml, err := HTMLToEMail(w.Bytes())
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return eml, nil
+}
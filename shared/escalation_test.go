@@ -0,0 +1,68 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+
+	"eve/service/model"
+)
+
+// received returns the event types queued for a client
+func received(c *WSClient) []string {
+	types := []string{}
+	for len(c.send) > 0 {
+		evt := Event{}
+		json.Unmarshal(<-c.send, &evt)
+		if evt.Type != "ready" {
+			types = append(types, evt.Type)
+		}
+	}
+	return types
+}
+
+func TestEscalationReachesOffShiftGuards(t *testing.T) {
+	onShift := newWSClient(nil, "esc", "g1", model.SecurityUser)
+	offShift := newWSClient(nil, "esc", "g2", model.SecurityUser)
+	official := newWSClient(nil, "esc", "o1", model.OfficialUser)
+	for _, c := range []*WSClient{onShift, offShift, official} {
+		hub.register(c, 0)
+		defer hub.unregister(c)
+	}
+
+	alert := &model.ResidentAlerts{ID: "a1", SiteID: "esc"}
+
+	// the first dispatch only goes to the guards on shift
+	Publish(alert.SiteID, "alert.new", alert, GuardChannels([]string{"g1"})...)
+
+	tests := []struct {
+		name     string
+		tier     model.AlertEscalationTier
+		userType int
+		reached  map[*WSClient]bool
+	}{
+		{"security tier", model.AlertEscalationTier{Target: model.EscalateSecurity}, model.SecurityUser,
+			map[*WSClient]bool{onShift: true, offShift: true}},
+		{"officials tier", model.AlertEscalationTier{Target: model.EscalateOfficials}, model.OfficialUser,
+			map[*WSClient]bool{official: true}},
+	}
+
+	if got := received(offShift); len(got) != 0 {
+		t.Fatalf("off shift guard received %v on the first dispatch", got)
+	}
+	received(onShift)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if userType := publishEscalation(alert, tt.tier); userType != tt.userType {
+				t.Errorf("user type = %d, want %d", userType, tt.userType)
+			}
+
+			for _, c := range []*WSClient{onShift, offShift, official} {
+				got := received(c)
+				if reached := len(got) == 1 && got[0] == "alert.escalated"; reached != tt.reached[c] {
+					t.Errorf("%s received %v, want reached %v", c.UserID, got, tt.reached[c])
+				}
+			}
+		})
+	}
+}
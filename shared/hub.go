@@ -0,0 +1,269 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"eve/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// events kept per site for clients that reconnect
+const (
+	hubReplayEvents = 500
+	hubReplayAge    = 30 * time.Minute
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 50 * time.Second
+	wsSendBuffer = 64
+)
+
+// Event is sent to the websocket clients of a site. Event ids increase per site so a
+// client that reconnects with ?last_event= gets the events it missed
+type Event struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+	Time time.Time   `json:"time"`
+
+	targets []string
+	payload []byte
+}
+
+// WSClient is a websocket connection of a signed in user, it listens on its role and
+// user channels
+type WSClient struct {
+	SiteID   string
+	UserID   string
+	UserType int
+
+	conn     *websocket.Conn
+	send     chan []byte
+	channels map[string]bool
+	closed   bool
+}
+
+type siteHub struct {
+	clients map[*WSClient]bool
+	seq     int64
+	events  []Event
+}
+
+// Hub routes events to the websocket clients of each site
+type Hub struct {
+	mu    sync.Mutex
+	sites map[string]*siteHub
+}
+
+var hub = &Hub{sites: map[string]*siteHub{}}
+
+// RoleChannel reaches every user of a type, eg. model.SecurityUser
+func RoleChannel(userType int) string {
+	return fmt.Sprintf("role:%d", userType)
+}
+
+// UserChannel reaches one user
+func UserChannel(userID string) string {
+	return "user:" + userID
+}
+
+// Publish sends an event to the clients of a site listening on any of the channels
+func Publish(siteID, eventType string, data interface{}, channels ...string) {
+	hub.publish(siteID, eventType, data, channels)
+}
+
+// ServeWS runs a websocket client until the connection closes. Events after lastEvent
+// that are still kept are sent first
+func ServeWS(conn *websocket.Conn, siteID, userID string, userType int, lastEvent int64) {
+	client := newWSClient(conn, siteID, userID, userType)
+
+	hub.register(client, lastEvent)
+	go client.writePump()
+	client.readPump()
+	hub.unregister(client)
+}
+
+// newWSClient the send buffer holds the ready event and every kept event on top of the
+// live buffer, so a reconnecting client is never dropped during its own replay
+func newWSClient(conn *websocket.Conn, siteID, userID string, userType int) *WSClient {
+	return &WSClient{
+		SiteID:   siteID,
+		UserID:   userID,
+		UserType: userType,
+		conn:     conn,
+		send:     make(chan []byte, 1+hubReplayEvents+wsSendBuffer),
+		channels: map[string]bool{RoleChannel(userType): true, UserChannel(userID): true},
+	}
+}
+
+func (h *Hub) site(siteID string) *siteHub {
+	s, ok := h.sites[siteID]
+	if !ok {
+		s = &siteHub{clients: map[*WSClient]bool{}}
+		h.sites[siteID] = s
+	}
+	return s
+}
+
+func (h *Hub) publish(siteID, eventType string, data interface{}, channels []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.site(siteID)
+	s.seq++
+
+	evt := Event{ID: s.seq, Type: eventType, Data: data, Time: time.Now(), targets: channels}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		utils.Env.Log.Error(err)
+		return
+	}
+	evt.payload = payload
+
+	// keep the latest events that are not too old
+	s.events = append(s.events, evt)
+	cut := 0
+	for cut < len(s.events) && (len(s.events)-cut > hubReplayEvents || time.Since(s.events[cut].Time) > hubReplayAge) {
+		cut++
+	}
+	s.events = s.events[cut:]
+
+	for c := range s.clients {
+		if c.listens(evt) {
+			h.deliver(s, c, payload)
+		}
+	}
+}
+
+// register adds a client and queues the events it missed, both under the lock so no
+// event is lost or sent twice
+func (h *Hub) register(c *WSClient, lastEvent int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.site(c.SiteID)
+	s.clients[c] = true
+
+	ready, _ := json.Marshal(Event{Type: "ready", Data: map[string]int64{"last_event": s.seq}, Time: time.Now()})
+	h.deliver(s, c, ready)
+
+	if lastEvent <= 0 {
+		return
+	}
+
+	// ids restart with the server, a client ahead of us gets everything kept
+	if lastEvent > s.seq {
+		lastEvent = 0
+	}
+
+	for _, evt := range s.events {
+		if evt.ID > lastEvent && c.listens(evt) {
+			h.deliver(s, c, evt.payload)
+		}
+	}
+}
+
+func (h *Hub) unregister(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.sites[c.SiteID]; ok {
+		delete(s.clients, c)
+	}
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// deliver drops clients that are too slow to keep up, they replay what they missed when
+// they reconnect
+func (h *Hub) deliver(s *siteHub, c *WSClient, payload []byte) {
+	if c.closed {
+		return
+	}
+
+	select {
+	case c.send <- payload:
+	default:
+		delete(s.clients, c)
+		c.closed = true
+		close(c.send)
+	}
+}
+
+func (c *WSClient) listens(evt Event) bool {
+	for _, ch := range evt.targets {
+		if c.channels[ch] {
+			return true
+		}
+	}
+	return false
+}
+
+// readPump only keeps the connection alive, clients act through the http api
+func (c *WSClient) readPump() {
+	c.conn.SetReadLimit(4096)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *WSClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Online returns the users of a type with an open connection on a site
+func Online(siteID string, userType int) []string {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	users := []string{}
+	seen := map[string]bool{}
+	if s, ok := hub.sites[siteID]; ok {
+		for c := range s.clients {
+			if c.UserType == userType && !seen[c.UserID] {
+				seen[c.UserID] = true
+				users = append(users, c.UserID)
+			}
+		}
+	}
+
+	return users
+}
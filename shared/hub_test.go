@@ -0,0 +1,66 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHubReplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		published int
+		lastEvent int64
+		want      int
+	}{
+		{"new connection", 10, 0, 0},
+		{"few missed", 10, 5, 5},
+		{"more than the send buffer", wsSendBuffer * 3, 1, wsSendBuffer*3 - 1},
+		{"everything kept", hubReplayEvents + 20, 1, hubReplayEvents - 1},
+		{"ids restarted", 100, 1000, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Hub{sites: map[string]*siteHub{}}
+			for i := 0; i < tt.published; i++ {
+				h.publish("s1", "alert.new", i, []string{RoleChannel(3)})
+			}
+			h.publish("s1", "alert.new", "other", []string{RoleChannel(1)})
+
+			c := newWSClient(nil, "s1", "g1", 3)
+			h.register(c, tt.lastEvent)
+
+			if c.closed || !h.sites["s1"].clients[c] {
+				t.Fatal("client was dropped during its replay")
+			}
+			if got := len(c.send) - 1; got != tt.want {
+				t.Fatalf("replayed %d events, want %d", got, tt.want)
+			}
+
+			evt := Event{}
+			if err := json.Unmarshal(<-c.send, &evt); err != nil || evt.Type != "ready" {
+				t.Fatalf("first event = %+v, want ready", evt)
+			}
+
+			last := tt.lastEvent
+			if tt.lastEvent > int64(tt.published+1) {
+				last = 0
+			}
+			for len(c.send) > 0 {
+				if err := json.Unmarshal(<-c.send, &evt); err != nil {
+					t.Fatal(err)
+				}
+				if evt.ID <= last {
+					t.Fatalf("event %d replayed after %d", evt.ID, last)
+				}
+				last = evt.ID
+			}
+
+			// live events still reach the client after the replay
+			h.publish("s1", "alert.new", "live", []string{RoleChannel(3)})
+			if c.closed || len(c.send) != 1 {
+				t.Error("live event did not reach the client")
+			}
+		})
+	}
+}
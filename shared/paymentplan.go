@@ -0,0 +1,150 @@
+package shared
+
+import (
+	"bytes"
+	"eve/service/model"
+	"eve/utils"
+	"fmt"
+	"time"
+
+	"github.com/CloudyKit/jet/v3"
+	"github.com/go-pg/pg"
+)
+
+// PaymentPlanMonitor flags installments that were not paid by their due date and
+// notifies the resident and the site officials, errors are logged and retried on the
+// next run
+func PaymentPlanMonitor() {
+	dbc := utils.Env.Db
+	log := utils.Env.Log
+
+	for {
+		records := []model.PaymentPlanInstallment{}
+		err := dbc.Model(&records).
+			Join("join payment_plan as p on p.id = payment_plan_installment.plan_id").
+			Where("p.status = ?", model.PlanActive).
+			Where("payment_plan_installment.status = ?", model.InstallmentPending).
+			Where("payment_plan_installment.due_date < current_date").
+			Select()
+		if err != nil && err != pg.ErrNoRows {
+			log.Error(err)
+		}
+
+		for i := range records {
+			err := utils.Transact(dbc, log, func(tx *pg.Tx) error {
+				return missedInstallment(tx, &records[i])
+			})
+			if err != nil {
+				log.Debug(err)
+			}
+		}
+
+		time.Sleep(60 * time.Minute)
+	}
+}
+
+func missedInstallment(tx *pg.Tx, record *model.PaymentPlanInstallment) error {
+	log := utils.Env.Log
+
+	record.Status = model.InstallmentMissed
+	record.DateNotified = utils.DateTime{}.Now()
+	_, err := tx.Model(record).
+		Column("status", "date_notified").
+		WherePK().
+		Update()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	resident := model.Resident{}
+	if err := tx.Model(&resident).Where("id = ?", record.ResidentID).Select(); err != nil {
+		log.Debug(err)
+		return err
+	}
+	residentName := fmt.Sprintf("%s %s", resident.FirstName, resident.LastName)
+
+	officials := []model.User{}
+	err = tx.Model(&officials).
+		Where("site_id = ? and type = ? and status = ?", record.SiteID, model.OfficialUser, model.IsEnabled).
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+
+	type recipient struct{ Name, Email string }
+
+	recipients := []recipient{{residentName, resident.Email}}
+	for _, o := range officials {
+		recipients = append(recipients, recipient{fmt.Sprintf("%s %s", o.FirstName, o.LastName), o.Email})
+	}
+
+	for _, r := range recipients {
+		if len(r.Email) == 0 {
+			continue
+		}
+
+		eml, err := MakeMissedInstallment(tx, record, r.Name, residentName)
+		if err != nil {
+			return err
+		}
+		eml.To = r.Email
+
+		_, err = tx.Exec(`
+		insert into task_queue (site_id, type, data)
+			values(?, 1, ?)
+		`, record.SiteID, &eml)
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MakeMissedInstallment ...
+func MakeMissedInstallment(tx *pg.Tx, record *model.PaymentPlanInstallment, name, residentName string) (*EMailMsg, error) {
+	log := utils.Env.Log
+
+	site := model.Site{}
+	_, err := tx.QueryOne(&site, "select * from site where id=?", record.SiteID)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	templates.SetDevelopmentMode(true)
+	templates.AddGlobalFunc("fmtMoney", fmtMoney)
+
+	t, err := templates.GetTemplate("installment_missed.jet.html")
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	vars := make(jet.VarMap)
+	vars.Set("name", name)
+	vars.Set("resident", residentName)
+	vars.Set("installment", record)
+	vars.Set("dueDate", record.DueDate.Format("January 2 2006"))
+	vars.Set("outstanding", record.Amount.Sub(record.Paid))
+	vars.Set("association", site.Name)
+
+	var w bytes.Buffer
+	if err = t.Execute(&w, vars, nil); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	eml, err := HTMLToEMail(w.Bytes())
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	eml.Subject = fmt.Sprintf("%s: missed payment plan installment", site.Name)
+
+	return eml, nil
+}
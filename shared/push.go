@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"eve/service/model"
+	"eve/utils"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+// expo push service, the mobile apps register expo push tokens
+const defaultPushURL = "https://exp.host/--/api/v2/push/send"
+
+// PushTask is a push notification queued with task type 2
+type PushTask struct {
+	To    string            `json:"to"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+func sendPush(task model.TaskQueue, gMon *GroupMonitor) (success bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			success = false
+		}
+		gMon.Done()
+	}()
+
+	log := utils.Env.Log
+	cfg := utils.Env.Cfg
+
+	push := PushTask{}
+	if err := json.Unmarshal(task.Data, &push); err != nil {
+		log.Debug(err)
+		return false
+	}
+
+	url := cfg.Section("push").Key("url").String()
+	if len(url) == 0 {
+		url = defaultPushURL
+	}
+
+	body, err := json.Marshal(push)
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if token := cfg.Section("push").Key("access_token").String(); len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		log.Debug(fmt.Errorf("push notification failed (%d)", res.StatusCode))
+		return false
+	}
+
+	log.Debug("Push Sent")
+
+	return true
+}
+
+// QueueSecurityPush queues a push notification to every enabled security user of a site
+// that registered a device, it returns the number of notifications queued
+func QueueSecurityPush(db orm.DB, siteID, title, body string, data map[string]string) (int, error) {
+	return QueueRolePush(db, siteID, model.SecurityUser, title, body, data)
+}
+
+// QueueRolePush queues a push notification to every enabled user of a type on a site
+func QueueRolePush(db orm.DB, siteID string, userType int, title, body string, data map[string]string) (int, error) {
+	log := utils.Env.Log
+
+	tokens := []string{}
+	_, err := db.Query(&tokens, `
+		select push_token from "user" where site_id = ? and type = ? and status = ? and push_token <> ''
+	`, siteID, userType, model.IsEnabled)
+	if err != nil {
+		log.Debug(err)
+		return 0, err
+	}
+
+	for _, token := range tokens {
+		task := PushTask{To: token, Title: title, Body: body, Data: data}
+		_, err := db.Exec(`
+		insert into task_queue (site_id, type, data)
+			values(?, 2, ?)
+		`, siteID, &task)
+		if err != nil {
+			log.Debug(err)
+			return 0, err
+		}
+	}
+
+	return len(tokens), nil
+}
+
+// QueueResidentPush queues a push notification to a resident, false when the resident has
+// not registered a device
+func QueueResidentPush(db orm.DB, siteID, residentID, title, body string, data map[string]string) (bool, error) {
+	log := utils.Env.Log
+
+	token := ""
+	_, err := db.QueryOne(pg.Scan(&token), `
+		select coalesce(push_token, '') from resident where id = ?
+	`, residentID)
+	if err != nil && err != pg.ErrNoRows {
+		log.Debug(err)
+		return false, err
+	}
+	if len(token) == 0 {
+		return false, nil
+	}
+
+	task := PushTask{To: token, Title: title, Body: body, Data: data}
+	_, err = db.Exec(`
+		insert into task_queue (site_id, type, data)
+			values(?, 2, ?)
+	`, siteID, &task)
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -12,11 +12,12 @@ import (
 
 // EmailTask ...
 type EmailTask struct {
-	To      string `json:"to"`
-	From    string `json:"from"`
-	Subject string `json:"subject"`
-	HTML    string `json:"html"`
-	Text    string `json:"text"`
+	To          string       `json:"to"`
+	From        string       `json:"from"`
+	Subject     string       `json:"subject"`
+	HTML        string       `json:"html"`
+	Text        string       `json:"text"`
+	Attachments []Attachment `json:"attachments"`
 }
 
 func sendEmail(task model.TaskQueue, gMon *GroupMonitor) (success bool) {
@@ -90,6 +91,10 @@ func sendEmail(task model.TaskQueue, gMon *GroupMonitor) (success bool) {
 	email.SetBody(mail.TextHTML, mailTask.HTML)
 	email.AddAlternative(mail.TextPlain, mailTask.Text)
 
+	for _, a := range mailTask.Attachments {
+		email.AddAttachmentBase64(a.Data, a.Name)
+	}
+
 	//Call Send and pass the client
 	if err = email.Send(smtpClient); err != nil {
 		log.Debug(err)
@@ -23,6 +23,9 @@ type Server struct {
 	Log     *zap.Logger
 	log     *zap.SugaredLogger
 
+	// Middleware runs after the session middleware, before the handlers
+	Middleware []echo.MiddlewareFunc
+
 	serviceList map[string]interface{}
 }
 
@@ -115,7 +118,9 @@ func (s *Server) initRouter() error {
 		AllowHeaders: []string{
 			echo.HeaderOrigin, echo.HeaderContentType,
 			echo.HeaderAccept, echo.HeaderXRequestedWith,
+			"Idempotency-Key",
 		},
+		ExposeHeaders: []string{"Idempotent-Replayed"},
 	}))
 
 	rtr.Use(middleware.Gzip())
@@ -123,6 +128,7 @@ func (s *Server) initRouter() error {
 	rtr.Use(middleware.Recover())
 	rtr.Use(session.Middleware(sessions.NewFilesystemStore("./tmp", []byte("!chidinmaisafinegirl!"))))
 	// rtr.Use(handlers.SiteIDMw(s.Dbc, s.log))
+	rtr.Use(s.Middleware...)
 
 	return nil
 }
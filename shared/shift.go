@@ -0,0 +1,98 @@
+package shared
+
+import (
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+// OnShiftGrace a guard who forgot to clock out is off duty this long after the shift ended
+const OnShiftGrace = "2 hours"
+
+// OnShift returns the guards clocked in on a shift of a site
+func OnShift(db orm.DB, siteID string) ([]string, error) {
+	log := utils.Env.Log
+
+	guards := []string{}
+	_, err := db.Query(&guards, `
+		select distinct guard_id from guard_shift
+		where
+			site_id = ? and status = ? and clock_out is null and
+			localtimestamp < date_end + interval '`+OnShiftGrace+`'
+	`, siteID, model.ShiftOnDuty)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return guards, nil
+}
+
+// AlertGuards returns the guards an alert of a site goes to. It is empty, meaning every
+// guard, unless the escalation policy routes alerts to the guards on shift and someone is
+func AlertGuards(db orm.DB, siteID string) ([]string, error) {
+	log := utils.Env.Log
+
+	count, err := db.Model((*model.AlertEscalationPolicy)(nil)).
+		Where("site_id = ? and active and on_shift_only", siteID).
+		Count()
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+	if count == 0 {
+		return []string{}, nil
+	}
+
+	return OnShift(db, siteID)
+}
+
+// GuardChannels returns the websocket channels of guards, the security role when guards is
+// empty
+func GuardChannels(guards []string) []string {
+	if len(guards) == 0 {
+		return []string{RoleChannel(model.SecurityUser)}
+	}
+
+	channels := []string{}
+	for _, g := range guards {
+		channels = append(channels, UserChannel(g))
+	}
+
+	return channels
+}
+
+// QueueGuardPush queues a push notification to guards, every security user of the site
+// when guards is empty
+func QueueGuardPush(db orm.DB, siteID string, guards []string, title, body string, data map[string]string) (int, error) {
+	log := utils.Env.Log
+
+	if len(guards) == 0 {
+		return QueueSecurityPush(db, siteID, title, body, data)
+	}
+
+	tokens := []string{}
+	_, err := db.Query(&tokens, `
+		select push_token from "user" where site_id = ? and id in (?) and status = ? and push_token <> ''
+	`, siteID, pg.In(guards), model.IsEnabled)
+	if err != nil {
+		log.Debug(err)
+		return 0, err
+	}
+
+	for _, token := range tokens {
+		task := PushTask{To: token, Title: title, Body: body, Data: data}
+		_, err := db.Exec(`
+		insert into task_queue (site_id, type, data)
+			values(?, 2, ?)
+		`, siteID, &task)
+		if err != nil {
+			log.Debug(err)
+			return 0, err
+		}
+	}
+
+	return len(tokens), nil
+}
@@ -0,0 +1,249 @@
+package shared
+
+import (
+	"eve/service/model"
+	"eve/utils"
+	"fmt"
+	"time"
+
+	"github.com/CloudyKit/jet/v3"
+	"github.com/go-pg/pg"
+	"github.com/shopspring/decimal"
+	"jaytaylor.com/html2text"
+)
+
+// Statement is a residents account activity over a period
+type Statement struct {
+	ResidentID     string          `json:"resident_id"`
+	SiteID         string          `json:"site_id"`
+	Name           string          `json:"name"`
+	Email          string          `json:"email"`
+	Address        string          `json:"address"`
+	DateFrom       utils.DateTime  `json:"date_from"`
+	DateTo         utils.DateTime  `json:"date_to"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	Lines          []StatementLine `json:"lines"`
+	WalletBalance  decimal.Decimal `json:"wallet_balance"`
+	Wallet         []StatementLine `json:"wallet"`
+}
+
+// StatementLine ...
+type StatementLine struct {
+	Date        string          `json:"date"`
+	Type        int             `json:"type"`
+	DocumentID  string          `json:"document_id"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+	Balance     decimal.Decimal `json:"balance"`
+}
+
+// documentNames describes account_history rows by transaction type
+var documentNames = map[int]string{
+	model.TrxPayment:    "Payment",
+	model.TrxInvoice:    "Invoice",
+	model.TrxCreditNote: "Credit note",
+	model.TrxReversal:   "Reversal",
+}
+
+// accountHistory is a row of the account_history view
+type accountHistory struct {
+	DocumentID    string
+	DateTrx       utils.DateTime
+	Type          int
+	Amount        decimal.Decimal
+	InvoiceNumber string
+}
+
+// statementLines runs the balance through the history, rows that do not move it are left out
+func statementLines(opening decimal.Decimal, history []accountHistory) ([]StatementLine, decimal.Decimal) {
+	lines := []StatementLine{}
+	balance := opening
+
+	for _, h := range history {
+		if h.Amount.Sign() == 0 {
+			continue
+		}
+
+		balance = balance.Add(h.Amount)
+		lines = append(lines, StatementLine{
+			Date:        h.DateTrx.Format("2006-01-02"),
+			Type:        h.Type,
+			DocumentID:  h.DocumentID,
+			Description: fmt.Sprintf("%s %s", documentNames[h.Type], h.InvoiceNumber),
+			Amount:      h.Amount,
+			Balance:     balance,
+		})
+	}
+
+	return lines, balance
+}
+
+// GetStatement builds the statement of a resident for the period from - to (inclusive)
+func GetStatement(tx *pg.Tx, residentID string, from, to time.Time) (*Statement, error) {
+	log := utils.Env.Log
+	end := to.AddDate(0, 0, 1)
+
+	stmt := &Statement{
+		ResidentID: residentID,
+		DateFrom:   utils.NewDateTime(from),
+		DateTo:     utils.NewDateTime(to),
+		Lines:      []StatementLine{},
+		Wallet:     []StatementLine{},
+	}
+
+	_, err := tx.QueryOne(stmt, `
+		select
+			r.id as resident_id, rs.site_id, r.email,
+			concat(r.first_name, ' ', r.last_name) as "name",
+			concat(
+				(case when u.attr->>'unit_number' is not null then u.attr->>'unit_number'||', ' else '' end)
+				, s.name, ', '||u.label
+			) as "address"
+		from
+			resident as r
+		left join residency as rs
+			on rs.id = r.residency_id
+		left join unit as u
+			on u.id = rs.unit_id
+		left join "street" as s
+			on s.id = u.street_id
+		where
+			r.id = ?
+	`, residentID)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	_, err = tx.QueryOne(pg.Scan(&stmt.OpeningBalance), `
+		select coalesce(sum(amount), 0) from transaction where resident_id = ? and date_trx < ?
+	`, residentID, from)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	history := []accountHistory{}
+	_, err = tx.Query(&history, `
+		select
+			document_id, date_trx, type, amount, invoice_number
+		from
+			account_history
+		where
+			resident_id = ? and date_trx >= ? and date_trx < ?
+		order by
+			date_trx
+	`, residentID, from, end)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	stmt.Lines, stmt.ClosingBalance = statementLines(stmt.OpeningBalance, history)
+
+	movements := []model.WalletMovement{}
+	err = tx.Model(&movements).
+		Where("resident_id = ? and date_trx >= ? and date_trx < ?", residentID, from, end).
+		Order("date_trx").
+		Select()
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	for _, m := range movements {
+		stmt.Wallet = append(stmt.Wallet, StatementLine{
+			Date:        m.DateTrx.Format("2006-01-02"),
+			Type:        m.Type,
+			Description: m.Narration,
+			Amount:      m.Amount,
+		})
+	}
+
+	_, err = tx.QueryOne(pg.Scan(&stmt.WalletBalance), `
+		select coalesce(sum(amount), 0) from wallet_movement where resident_id = ?
+	`, residentID)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// MakeStatement renders a statement as an email
+func MakeStatement(tx *pg.Tx, stmt *Statement) (*EMailMsg, error) {
+	log := utils.Env.Log
+
+	w, site, err := renderStatement(tx, stmt, "statement.jet.html")
+	if err != nil {
+		return nil, err
+	}
+
+	eml, err := HTMLToEMail(w)
+	if err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	eml.Subject = fmt.Sprintf("%s Statement %s - %s", site.Name,
+		stmt.DateFrom.Format("January 2 2006"), stmt.DateTo.Format("January 2 2006"))
+	eml.To = stmt.Email
+
+	// attach a printable copy
+	w, _, err = renderStatement(tx, stmt, "statement.pdf.jet.html")
+	if err != nil {
+		return nil, err
+	}
+	if err := eml.AttachPDF(fmt.Sprintf("statement-%s.pdf", stmt.DateTo.Format("2006-01-02")), w); err != nil {
+		log.Debug(err)
+		return nil, err
+	}
+
+	return eml, nil
+}
+
+// MakeStatementPDF renders a statement as a pdf document
+func MakeStatementPDF(tx *pg.Tx, stmt *Statement) ([]byte, error) {
+	w, _, err := renderStatement(tx, stmt, "statement.pdf.jet.html")
+	if err != nil {
+		return nil, err
+	}
+
+	return HTMLToPDF(w)
+}
+
+func renderStatement(tx *pg.Tx, stmt *Statement, tpl string) ([]byte, *model.Site, error) {
+	log := utils.Env.Log
+
+	site := &model.Site{}
+	_, err := tx.QueryOne(site, "select * from site where id=?", stmt.SiteID)
+	if err != nil {
+		log.Debug(err)
+		return nil, nil, err
+	}
+
+	vars := make(jet.VarMap)
+	vars.Set("statement", stmt)
+	vars.Set("dateFrom", stmt.DateFrom.Format("January 2 2006"))
+	vars.Set("dateTo", stmt.DateTo.Format("January 2 2006"))
+	vars.Set("association", site.Name)
+
+	w, err := execTemplate(tpl, vars)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return w, site, nil
+}
+
+// HTMLToPDF converts rendered html to a text layout pdf document
+func HTMLToPDF(b []byte) ([]byte, error) {
+	text, err := html2text.FromString(string(b), html2text.Options{PrettyTables: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.TextToPDF(text), nil
+}
@@ -0,0 +1,58 @@
+package shared
+
+import (
+	"testing"
+	"time"
+
+	"eve/service/model"
+	"eve/utils"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestStatementLines(t *testing.T) {
+	day := func(d int) utils.DateTime {
+		return utils.DateTime{Time: time.Date(2026, 10, d, 9, 0, 0, 0, time.Local)}
+	}
+	amount := decimal.RequireFromString
+
+	history := []accountHistory{
+		{DocumentID: "i1", DateTrx: day(1), Type: model.TrxInvoice, Amount: amount("-150"), InvoiceNumber: "00000012"},
+		{DocumentID: "p1", DateTrx: day(2), Type: model.TrxPayment, Amount: amount("100"), InvoiceNumber: "PAY-1"},
+		{DocumentID: "c1", DateTrx: day(3), Type: model.TrxCreditNote, Amount: amount("20"), InvoiceNumber: "CN-1"},
+		{DocumentID: "x1", DateTrx: day(3), Type: model.TrxPayment, Amount: amount("0"), InvoiceNumber: "PAY-0"},
+		{DocumentID: "r1", DateTrx: day(4), Type: model.TrxReversal, Amount: amount("-100"), InvoiceNumber: "REV-1"},
+	}
+
+	want := []StatementLine{
+		{Date: "2026-10-01", Type: model.TrxInvoice, DocumentID: "i1", Description: "Invoice 00000012", Amount: amount("-150"), Balance: amount("-100")},
+		{Date: "2026-10-02", Type: model.TrxPayment, DocumentID: "p1", Description: "Payment PAY-1", Amount: amount("100"), Balance: amount("0")},
+		{Date: "2026-10-03", Type: model.TrxCreditNote, DocumentID: "c1", Description: "Credit note CN-1", Amount: amount("20"), Balance: amount("20")},
+		{Date: "2026-10-04", Type: model.TrxReversal, DocumentID: "r1", Description: "Reversal REV-1", Amount: amount("-100"), Balance: amount("-80")},
+	}
+
+	lines, closing := statementLines(amount("50"), history)
+
+	if !closing.Equal(amount("-80")) {
+		t.Errorf("closing balance = %s, want -80", closing)
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("lines = %+v, want %+v", lines, want)
+	}
+
+	for k, w := range want {
+		l := lines[k]
+		if l.Date != w.Date || l.Type != w.Type || l.DocumentID != w.DocumentID || l.Description != w.Description ||
+			!l.Amount.Equal(w.Amount) || !l.Balance.Equal(w.Balance) {
+			t.Errorf("line %d = %+v, want %+v", k, l, w)
+		}
+	}
+}
+
+func TestDocumentNames(t *testing.T) {
+	for _, trxType := range []int{model.TrxPayment, model.TrxInvoice, model.TrxCreditNote, model.TrxReversal} {
+		if len(documentNames[trxType]) == 0 {
+			t.Errorf("transaction type %d has no document name", trxType)
+		}
+	}
+}
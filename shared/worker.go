@@ -124,6 +124,12 @@ func distribute(tasks []model.TaskQueue, gMon *GroupMonitor, maxWorkers int) err
 			func() {
 				setTaskMode(sendEmail(t, gMon), t.ID)
 			}()
+		case 2:
+			// send push notification
+			gMon.Add(1)
+			func() {
+				setTaskMode(!sendPush(t, gMon), t.ID)
+			}()
 		}
 
 		// if worker limit has been reached, wait for a free worker
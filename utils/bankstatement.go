@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BankLine is a single entry of a bank statement, credits are positive
+type BankLine struct {
+	Date      time.Time
+	Amount    decimal.Decimal
+	Narration string
+	Reference string
+}
+
+// BankStatement is a parsed bank statement file
+type BankStatement struct {
+	Format  string
+	Account string
+	Lines   []BankLine
+}
+
+// bankDateFormats are tried in order on csv dates, day first as used by local banks
+var bankDateFormats = []string{
+	"2006-01-02",
+	"02/01/2006",
+	"2/1/2006",
+	"02-01-2006",
+	"02-Jan-2006",
+	"02-Jan-06",
+	"2 Jan 2006",
+	"02 Jan 2006",
+	"Jan 2, 2006",
+	"2006/01/02",
+	"02.01.2006",
+	"2006-01-02 15:04:05",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+}
+
+// csv column names by field, matched against the lower case header
+var bankColumns = map[string][]string{
+	"date":      {"date", "transaction date", "trans date", "txn date", "posting date", "value date", "tran date"},
+	"narration": {"narration", "description", "details", "remarks", "particulars", "memo", "transaction details"},
+	"credit":    {"credit", "credits", "deposit", "deposits", "credit amount", "money in", "lodgement", "lodgements"},
+	"debit":     {"debit", "debits", "withdrawal", "withdrawals", "debit amount", "money out"},
+	"amount":    {"amount", "transaction amount"},
+	"reference": {"reference", "ref", "reference no", "ref no", "transaction reference", "cheque no", "fitid"},
+}
+
+var ofxAccount = regexp.MustCompile(`(?i)<ACCTID>([^<\r\n]+)`)
+
+// ParseBankStatement reads a csv or ofx bank statement
+func ParseBankStatement(name string, data []byte) (*BankStatement, error) {
+	head := data
+	if len(head) > 2048 {
+		head = head[:2048]
+	}
+
+	if bytes.Contains(bytes.ToUpper(head), []byte("OFX")) || strings.HasSuffix(strings.ToLower(name), ".ofx") {
+		return parseOFX(data)
+	}
+
+	return parseCSV(data)
+}
+
+func parseOFX(data []byte) (*BankStatement, error) {
+	stmt := &BankStatement{Format: "ofx", Lines: []BankLine{}}
+
+	if m := ofxAccount.FindSubmatch(data); m != nil {
+		stmt.Account = strings.TrimSpace(string(m[1]))
+	}
+
+	for _, block := range ofxTransactions(string(data)) {
+		amount, err := decimal.NewFromString(strings.Replace(ofxTag(block, "TRNAMT"), ",", "", -1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount in ofx transaction %s", ofxTag(block, "FITID"))
+		}
+
+		date, err := ofxDate(ofxTag(block, "DTPOSTED"))
+		if err != nil {
+			return nil, err
+		}
+
+		narration := strings.TrimSpace(strings.Join([]string{ofxTag(block, "NAME"), ofxTag(block, "MEMO")}, " "))
+
+		stmt.Lines = append(stmt.Lines, BankLine{
+			Date:      date,
+			Amount:    amount,
+			Narration: narration,
+			Reference: ofxTag(block, "FITID"),
+		})
+	}
+
+	if len(stmt.Lines) == 0 {
+		return nil, fmt.Errorf("no transactions found in ofx statement")
+	}
+
+	return stmt, nil
+}
+
+// ofxTransactions splits the <STMTTRN> blocks, closing tags are optional in ofx 1.x
+func ofxTransactions(data string) []string {
+	upper := strings.ToUpper(data)
+	blocks := []string{}
+
+	for {
+		start := strings.Index(upper, "<STMTTRN>")
+		if start < 0 {
+			break
+		}
+		data, upper = data[start+9:], upper[start+9:]
+
+		end := len(upper)
+		for _, tag := range []string{"</STMTTRN>", "<STMTTRN>", "</BANKTRANLIST>"} {
+			if i := strings.Index(upper, tag); i >= 0 && i < end {
+				end = i
+			}
+		}
+		blocks = append(blocks, data[:end])
+	}
+
+	return blocks
+}
+
+// ofxTag returns the value of a tag, ofx 1.x (sgml) does not close its tags
+func ofxTag(block, tag string) string {
+	re := regexp.MustCompile(`(?i)<` + tag + `>([^<\r\n]*)`)
+	if m := re.FindStringSubmatch(block); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+
+	return ""
+}
+
+// ofxDate parses YYYYMMDD[HHMMSS[.XXX]][TZ]
+func ofxDate(s string) (time.Time, error) {
+	if len(s) < 8 {
+		return time.Time{}, fmt.Errorf("invalid ofx date %q", s)
+	}
+
+	if len(s) >= 14 {
+		if t, err := time.ParseInLocation("20060102150405", s[:14], time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.ParseInLocation("20060102", s[:8], time.Local)
+}
+
+func parseCSV(data []byte) (*BankStatement, error) {
+	stmt := &BankStatement{Format: "csv", Lines: []BankLine{}}
+
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+
+	// banks put account details above the table, the header is the first row naming a date column
+	var cols map[string]int
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if cols == nil {
+			cols = csvColumns(row)
+			continue
+		}
+
+		line, ok, err := csvLine(cols, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			stmt.Lines = append(stmt.Lines, line)
+		}
+	}
+
+	if cols == nil {
+		return nil, fmt.Errorf("no header row with a date and an amount column found")
+	}
+
+	return stmt, nil
+}
+
+// csvColumns maps fields to column indexes, it returns nil unless the row is a header
+func csvColumns(row []string) map[string]int {
+	cols := map[string]int{}
+	for i, h := range row {
+		h = strings.ToLower(strings.TrimSpace(h))
+		for field, names := range bankColumns {
+			if _, found := cols[field]; found {
+				continue
+			}
+			for _, n := range names {
+				if h == n {
+					cols[field] = i
+				}
+			}
+		}
+	}
+
+	_, date := cols["date"]
+	_, credit := cols["credit"]
+	_, amount := cols["amount"]
+	if !date || (!credit && !amount) {
+		return nil
+	}
+
+	return cols
+}
+
+func csvLine(cols map[string]int, row []string) (BankLine, bool, error) {
+	line := BankLine{}
+
+	field := func(name string) string {
+		i, found := cols[name]
+		if !found || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	value := field("date")
+	if len(value) == 0 {
+		// totals and blank rows
+		return line, false, nil
+	}
+
+	date, err := bankDate(value)
+	if err != nil {
+		return line, false, err
+	}
+
+	if _, found := cols["credit"]; found {
+		// separate credit and debit columns
+		if line.Amount, err = bankAmount(field("credit")); err != nil {
+			return line, false, err
+		}
+		if line.Amount.IsZero() {
+			if line.Amount, err = bankAmount(field("debit")); err != nil {
+				return line, false, err
+			}
+			line.Amount = line.Amount.Abs().Neg()
+		}
+	} else if line.Amount, err = bankAmount(field("amount")); err != nil {
+		return line, false, err
+	}
+
+	line.Date = date
+	line.Narration = field("narration")
+	line.Reference = field("reference")
+
+	return line, true, nil
+}
+
+func bankDate(s string) (time.Time, error) {
+	for _, f := range bankDateFormats {
+		if t, err := time.ParseInLocation(f, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
+}
+
+// bankAmount parses amounts like "1,500.00", "NGN 1500" or "(200.00)"
+func bankAmount(s string) (decimal.Decimal, error) {
+	neg := strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")
+
+	clean := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(strings.Trim(clean, ".-")) == 0 {
+		return decimal.Zero, nil
+	}
+
+	d, err := decimal.NewFromString(clean)
+	if err != nil {
+		return d, fmt.Errorf("invalid amount %q", s)
+	}
+	if neg {
+		d = d.Abs().Neg()
+	}
+
+	return d, nil
+}
+
+// LineReference identifies a statement line, lines without a bank reference are
+// identified by their content
+func (s BankLine) LineReference() string {
+	if len(s.Reference) > 0 {
+		return s.Reference
+	}
+
+	h := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s", s.Date.Format("2006-01-02"), s.Amount.StringFixed(2), s.Narration)))
+	return hex.EncodeToString(h[:10])
+}
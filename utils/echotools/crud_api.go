@@ -138,6 +138,23 @@ func getSiteID(c echo.Context) string {
 	return "unknown"
 }
 
+// AfterCommit runs fn once the transaction of a save or delete hook commits, for side
+// effects like websocket events that must not be seen when the save rolls back
+func AfterCommit(c echo.Context, fn func()) {
+	fns, _ := c.Get("afterCommit").([]func())
+	c.Set("afterCommit", append(fns, fn))
+}
+
+// runAfterCommit runs the functions queued by the hooks of the request
+func runAfterCommit(c echo.Context) {
+	fns, _ := c.Get("afterCommit").([]func())
+	c.Set("afterCommit", nil)
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
 func (s CrudAPI) findModel(name string, usrType int) *ModelInfo {
 
 	for i := range s.Models {
@@ -560,6 +577,7 @@ func (s *CrudAPI) Save(c echo.Context) (err error) {
 	if err != nil {
 		return nil
 	}
+	runAfterCommit(c)
 
 	// return additional data
 	// _list=category|comments:1234
@@ -652,6 +670,7 @@ func (s *CrudAPI) Delete(c echo.Context) (err error) {
 		if err != nil {
 			return
 		}
+		runAfterCommit(c)
 	}
 
 	// return additional data
@@ -0,0 +1,31 @@
+package echotools
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAfterCommit(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+
+	ran := []string{}
+	AfterCommit(c, func() { ran = append(ran, "first") })
+	AfterCommit(c, func() { ran = append(ran, "second") })
+
+	if len(ran) != 0 {
+		t.Fatalf("ran %v before the commit", ran)
+	}
+
+	runAfterCommit(c)
+	if len(ran) != 2 || ran[0] != "first" || ran[1] != "second" {
+		t.Fatalf("ran %v, want first and second in order", ran)
+	}
+
+	runAfterCommit(c)
+	if len(ran) != 2 {
+		t.Errorf("ran %v, functions ran twice", ran)
+	}
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page layout in points for TextToPDF
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 36
+	pdfFontSize   = 8
+	pdfLeading    = 10
+)
+
+// pdfRunes maps characters outside the standard font encoding to printable text
+var pdfRunes = map[rune]string{
+	'₦': "NGN",
+	'–': "-",
+	'—': "-",
+	'‘': "'",
+	'’': "'",
+	'“': "\"",
+	'”': "\"",
+	'•': "*",
+}
+
+// TextToPDF lays out plain text on A4 pages using the built in Courier font. It is meant
+// for documents rendered to text (see html2text) so tables keep their alignment
+func TextToPDF(text string) []byte {
+	perLine := (pdfPageWidth - 2*pdfMargin) * 10 / (pdfFontSize * 6)
+	perPage := (pdfPageHeight - 2*pdfMargin) / pdfLeading
+
+	// wrap long lines and split into pages
+	lines := []string{}
+	for _, l := range strings.Split(strings.Replace(text, "\r", "", -1), "\n") {
+		l = pdfEncode(strings.Replace(l, "\t", "    ", -1))
+		for len(l) > perLine {
+			lines = append(lines, l[:perLine])
+			l = l[perLine:]
+		}
+		lines = append(lines, l)
+	}
+
+	pages := [][]string{}
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	var buf bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: catalog, 2: page tree, 3: font, then a page and content object per page
+	kids := []string{}
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+i*2))
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, l := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(l))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+i*2,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// pdfEncode converts text to single byte (latin-1) characters
+func pdfEncode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if v, ok := pdfRunes[r]; ok {
+			b.WriteString(v)
+		} else if r < 256 {
+			b.WriteByte(byte(r))
+		} else {
+			b.WriteByte('?')
+		}
+	}
+
+	return b.String()
+}
+
+func pdfEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+	return r.Replace(s)
+}